@@ -6,6 +6,7 @@ require (
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/go-redis/redis/v8 v8.4.2
 	github.com/google/uuid v1.1.2
+	github.com/klauspost/compress v1.11.4
 	github.com/ory/dockertest/v3 v3.6.2
 	github.com/pkg/errors v0.9.1
 	github.com/prometheus/client_golang v1.7.1
@@ -47,10 +47,13 @@ func NewAdmin(ctx context.Context, cfg *Config) (*Admin, error) {
 	cfg.SetDefault()
 
 	a := &Admin{
-		ctx: ctx,
-		cfg: cfg,
-		log: logger.GetPackageLogger(ctx, empty{}),
-		mux: http.NewServeMux(),
+		ctx:           ctx,
+		cfg:           cfg,
+		log:           logger.GetPackageLogger(ctx, empty{}),
+		mux:           http.NewServeMux(),
+		metrics:       make(metrics.MapMetricsOptions),
+		aliveHandlers: make(metrics.MapCheckFunc),
+		readyHandlers: make(metrics.MapCheckFunc),
 	}
 
 	// Alive
@@ -95,6 +98,7 @@ func (a *Admin) errAnswer(w http.ResponseWriter, msg, code string) {
 
 func (a *Admin) aliveHandler(w http.ResponseWriter, r *http.Request) {
 	a.aliveCheckMutex.RLock()
+	defer a.aliveCheckMutex.RUnlock()
 	for key, f := range a.aliveHandlers {
 		result, msg := f()
 		if !result {
@@ -102,7 +106,6 @@ func (a *Admin) aliveHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	a.aliveCheckMutex.Unlock()
 
 	answ := ResultAnswer{Body: "ok"}
 	err := answ.WriteJSON(w)
@@ -113,6 +116,7 @@ func (a *Admin) aliveHandler(w http.ResponseWriter, r *http.Request) {
 
 func (a *Admin) readyCheckHandler(w http.ResponseWriter, r *http.Request) {
 	a.readyCheckMutex.RLock()
+	defer a.readyCheckMutex.RUnlock()
 	for key, f := range a.readyHandlers {
 		result, msg := f()
 		if !result {
@@ -120,7 +124,6 @@ func (a *Admin) readyCheckHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	a.aliveCheckMutex.Unlock()
 
 	answ := ResultAnswer{Body: "ok"}
 	err := answ.WriteJSON(w)
@@ -129,15 +132,21 @@ func (a *Admin) readyCheckHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// prometheusMiddleware updates metrics before each scrape
 func (a *Admin) prometheusMiddleware(handler http.Handler) http.Handler {
-	a.metricsMutex.RLock()
-	for name, v := range a.metrics {
-		v.MetricFunc(v.Metric)
-		a.log.Debug().Msg("run metric " + name)
-	}
-	a.metricsMutex.Unlock()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.metricsMutex.RLock()
+		for name, v := range a.metrics {
+			if v.MetricFunc == nil {
+				continue
+			}
+			v.MetricFunc(v.Metric)
+			a.log.Debug().Msg("run metric " + name)
+		}
+		a.metricsMutex.RUnlock()
 
-	return handler
+		handler.ServeHTTP(w, r)
+	})
 }
 
 // RegisterMetric should register a metric of defined type. Passed
@@ -163,6 +172,24 @@ func (a *Admin) RegisterMetric(metricName string, options interface{}) error {
 	return nil
 }
 
+// RegisterEndpoint should register a handler for endpoint on admin server.
+// Endpoint must be registered before admin server started.
+func (a *Admin) RegisterEndpoint(endpoint string, handler http.HandlerFunc) error {
+	if endpoint == "" {
+		a.log.Error().Msg("endpoint is empty")
+		return ErrEmptyEndpoint
+	}
+
+	if handler == nil {
+		a.log.Error().Msg("handler is null")
+		return ErrHandlerIsNil
+	}
+
+	a.mux.HandleFunc(endpoint, handler)
+
+	return nil
+}
+
 // RegisterReadyCheck should register a function for /health/ready
 // endpoint.
 func (a *Admin) RegisterReadyCheck(dependencyName string, checkFunc metrics.CheckFunc) error {
@@ -218,9 +245,14 @@ func (a *Admin) Start(m metrics.MapMetricsOptions, aliveHandlers, readyHandlers
 
 	a.log.Debug().Msg("start admin server")
 
-	return a.srv.ListenAndServe()
+	return a.srv.Start()
 }
 
 func (a *Admin) Shutdown() error {
 	return a.srv.Shutdown()
 }
+
+// Errors returns channel of serving error of admin server
+func (a *Admin) Errors() <-chan error {
+	return a.srv.Errors()
+}
@@ -21,5 +21,8 @@ func Registrate(ctx context.Context, cfg *Config) (context.Context, error) {
 }
 
 func Get(ctx context.Context) *Admin {
-	return accp.GetByName(ctx, ProviderName).(*Admin)
+	if v, ok := accp.GetByName(ctx, ProviderName).(*Admin); ok {
+		return v
+	}
+	return nil
 }
@@ -10,6 +10,8 @@ var (
 	ErrEmptyDependencyName = errors.New("empty dependency name")
 	ErrCheckFuncIsNil      = errors.New("pointer to checkFunc is nil")
 	ErrEmptyMetricName     = errors.New("empty metric name")
+	ErrEmptyEndpoint       = errors.New("empty endpoint")
+	ErrHandlerIsNil        = errors.New("pointer to handler is nil")
 )
 
 func ErrInvalidProviderOptions(iface interface{}) error {
@@ -14,28 +14,51 @@ import (
 	"github.com/soldatov-s/accp/internal/metrics"
 	"github.com/soldatov-s/accp/internal/rabbitmq"
 	"github.com/soldatov-s/accp/internal/redis"
+	"github.com/soldatov-s/accp/internal/upstream"
 	"github.com/soldatov-s/accp/internal/utils"
 )
 
-// Loop is application loop, exit on SIGTERM
-func Loop(ctx context.Context) {
+// Loop is application loop, exit on SIGTERM or on error of serving, the error is returned
+func Loop(ctx context.Context) error {
 	var closeSignal chan os.Signal
 	m := meta.Get(ctx)
 	log := logger.Get(ctx).GetLogger(m.Name, nil)
 
-	exit := make(chan struct{})
 	closeSignal = make(chan os.Signal, 1)
 	signal.Notify(closeSignal, os.Interrupt, syscall.SIGTERM)
 
-	go func() {
-		<-closeSignal
-		_ = Shutdown(ctx)
-		log.Info().Msg("Exit program")
-		close(exit)
-	}()
+	var err error
+	select {
+	case <-closeSignal:
+	case err = <-serveErrors(ctx):
+		log.Error().Err(err).Msg("failed to serve requests")
+	}
+
+	_ = Shutdown(ctx)
+	log.Info().Msg("Exit program")
 
-	// Exit app if chan is closed
-	<-exit
+	return err
+}
+
+// serveErrors returns channel of the first serving error of providers
+func serveErrors(ctx context.Context) <-chan error {
+	errs := make(chan error, 1)
+	accp.Get(ctx).Range(func(_, v interface{}) bool {
+		if s, ok := v.(accp.IServer); ok {
+			go func(serverErrs <-chan error) {
+				err := <-serverErrs
+				// Only the first error is kept
+				select {
+				case errs <- err:
+				default:
+				}
+			}(s.Errors())
+		}
+
+		return true
+	})
+
+	return errs
 }
 
 // getAllMetrics return all metrics from databases and caches
@@ -120,7 +143,13 @@ func StartStatistics(ctx context.Context) error {
 }
 
 func providersOrder() []string {
-	return []string{redis.ProviderName, rabbitmq.ProviderName, httpproxy.ProviderName, admin.ProviderName}
+	return []string{
+		redis.ProviderName,
+		rabbitmq.ProviderName,
+		upstream.ProviderName,
+		httpproxy.ProviderName,
+		admin.ProviderName,
+	}
 }
 
 // Start all providers
@@ -128,8 +157,11 @@ func Start(ctx context.Context) error {
 	provs := accp.Get(ctx)
 	for _, v := range providersOrder() {
 		if p, ok := provs.Load(v); ok {
-			if err := p.(accp.IProvider).Start(); err != nil {
-				return err
+			// admin is not IProvider, it is started by StartStatistics with collected metrics and checks
+			if prov, isProvider := p.(accp.IProvider); isProvider {
+				if err := prov.Start(); err != nil {
+					return err
+				}
 			}
 		}
 	}
@@ -142,8 +174,10 @@ func Shutdown(ctx context.Context) error {
 	provs := accp.Get(ctx)
 	for _, v := range utils.ReverseStringSlice(providersOrder()) {
 		if p, ok := provs.Load(v); ok {
-			if err := p.(accp.IProvider).Shutdown(); err != nil {
-				return err
+			if prov, isShutdowner := p.(accp.IShutdowner); isShutdowner {
+				if err := prov.Shutdown(); err != nil {
+					return err
+				}
 			}
 		}
 	}
@@ -4,19 +4,59 @@ import (
 	"context"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
 	"github.com/soldatov-s/accp/internal/cache/cachedata"
+	"github.com/soldatov-s/accp/internal/cache/disk"
 	"github.com/soldatov-s/accp/internal/cache/errors"
 	"github.com/soldatov-s/accp/internal/cache/external"
 	"github.com/soldatov-s/accp/internal/cache/memory"
+	"github.com/soldatov-s/accp/internal/httputils"
+	"github.com/soldatov-s/accp/internal/logger"
 	rrdata "github.com/soldatov-s/accp/internal/request_response_data"
 )
 
+const (
+	// eventsQueueSize is a size of queue of events from other instances
+	eventsQueueSize = 1024
+	// prolongInterval is an interval of prolongation of TTL in external cache of responses hit in memory
+	prolongInterval = time.Second
+)
+
+type empty struct{}
+
 type Cache struct {
-	Memory         *memory.Cache
+	Memory *memory.Cache
+	// Disk keeps large and long-lived responses across restarts, it is nil if disk cache is not configured
+	Disk           *disk.Cache
 	External       *external.Cache
 	waitAnswerList map[string]chan struct{}
 	waiteAnswerMu  map[string]*sync.Mutex
+	tags           *tagIndex
+	// urls is an index of request URIs of cached responses
+	urls *tagIndex
+	// vary is an index of Vary of cached responses
+	vary *varyIndex
+	// requests are requests of responses on disk, the request is not stored on disk,
+	// so it is kept for refresh of response which is not in memory
+	requestsMu sync.Mutex
+	requests   map[string]*rrdata.RequestData
+	// events are events of other instances, they are applied by worker, so the subscription is not blocked
+	events chan *external.Event
+	// hits are keys of responses hit in memory, their TTL in external cache is prolonged by worker
+	hitsMu sync.Mutex
+	hits   map[string]struct{}
+	// dropped are keys of events which didn't fit in queue, their local copies are dropped by worker
+	droppedMu sync.Mutex
+	dropped   map[string]struct{}
+	// flush is 1 if events may be lost, all local copies are dropped by worker
+	flush int32
+	// id marks events of cache, so the cache ignores own events
+	id  string
+	log zerolog.Logger
 }
 
 func NewCache(ctx context.Context, cfg *Config, storage external.Storage) *Cache {
@@ -24,18 +64,376 @@ func NewCache(ctx context.Context, cfg *Config, storage external.Storage) *Cache
 		return nil
 	}
 
-	return &Cache{
+	c := &Cache{
 		Memory:         memory.NewCache(ctx, cfg.Memory),
 		External:       external.NewCache(ctx, cfg.External, storage),
 		waitAnswerList: make(map[string]chan struct{}),
 		waiteAnswerMu:  make(map[string]*sync.Mutex),
+		tags:           newTagIndex(),
+		urls:           newTagIndex(),
+		vary:           newVaryIndex(),
+		requests:       make(map[string]*rrdata.RequestData),
+		id:             uuid.New().String(),
+		log:            logger.GetPackageLogger(ctx, empty{}),
+	}
+
+	if cfg.Disk.Enabled() {
+		var err error
+		if c.Disk, err = disk.NewCache(ctx, cfg.Disk); err != nil {
+			c.log.Err(err).Msg("failed to create disk cache, it is disabled")
+		}
+	}
+
+	// Tags and URI of response are forgotten when response is removed from memory and disk by any reason
+	c.Memory.OnRemove(func(key string) {
+		if c.Disk == nil || !c.Disk.Has(key) {
+			c.forget(key)
+		}
+	})
+
+	if c.Disk != nil {
+		c.Disk.OnRemove(func(key string) {
+			if !c.Memory.Has(key) {
+				c.forget(key)
+			}
+		})
+
+		// Responses on disk survive restart, so they may be purged by tags and URIs
+		for _, entry := range c.Disk.Entries() {
+			c.tags.set(entry.Key, entry.Tags)
+			if entry.URI != "" {
+				c.urls.set(entry.Key, []string{entry.URI})
+			}
+			if len(entry.Vary) > 0 {
+				c.vary.set(entry.Base, entry.Key, entry.Vary)
+			}
+		}
+	}
+
+	// Other instances notify about changes of items, so inmemory copies are coherent
+	// without checking of external cache on every hit
+	if c.External != nil {
+		c.events = make(chan *external.Event, eventsQueueSize)
+		c.hits = make(map[string]struct{})
+		c.dropped = make(map[string]struct{})
+		go c.worker(ctx)
+
+		if err := c.External.SubscribeEvents(c.queueEvent); err != nil {
+			c.log.Err(err).Msg("failed to subscribe to events of external cache")
+		}
+
+		// The events published while subscription was lost are not received, so local copies may be stale
+		if err := c.External.OnEventsResubscribe(func() { atomic.StoreInt32(&c.flush, 1) }); err != nil {
+			c.log.Err(err).Msg("failed to subscribe to restoring of events subscription")
+		}
+	}
+
+	return c
+}
+
+// worker applies events of other instances and prolongs TTL of responses hit in memory
+func (c *Cache) worker(ctx context.Context) {
+	ticker := time.NewTicker(prolongInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-c.events:
+			c.handleEvent(event)
+		case <-ticker.C:
+			c.dropStale()
+			c.prolong()
+		}
+	}
+}
+
+// queueEvent passes event to worker, if worker is overloaded the local copies are marked to be dropped
+// by worker, so the subscription isn't blocked by disk
+func (c *Cache) queueEvent(event *external.Event) {
+	if event.Origin == c.id {
+		return
+	}
+
+	select {
+	case c.events <- event:
+	default:
+		c.droppedMu.Lock()
+		if len(c.dropped) < eventsQueueSize {
+			c.dropped[event.Key] = struct{}{}
+		} else {
+			// Too many events are missed, all local copies are dropped
+			atomic.StoreInt32(&c.flush, 1)
+		}
+		c.droppedMu.Unlock()
+	}
+}
+
+// dropStale drops local copies which may be stale because their events weren't applied
+func (c *Cache) dropStale() {
+	c.droppedMu.Lock()
+	dropped := c.dropped
+	c.dropped = make(map[string]struct{})
+	c.droppedMu.Unlock()
+
+	if atomic.CompareAndSwapInt32(&c.flush, 1, 0) {
+		c.log.Info().Msg("events of other instances may be lost, local copies are dropped")
+		c.flushLocal()
+		return
+	}
+
+	for key := range dropped {
+		if err := c.deleteLocal(key); err != nil {
+			c.log.Err(err).Msgf("failed to invalidate %s", key)
+		}
+	}
+}
+
+// flushLocal drops all items from memory and disk, they are selected from external cache again
+func (c *Cache) flushLocal() {
+	keys := make(map[string]struct{})
+	c.Memory.Range(func(key, _ interface{}) bool {
+		keys[key.(string)] = struct{}{}
+		return true
+	})
+
+	if c.Disk != nil {
+		for _, entry := range c.Disk.Entries() {
+			keys[entry.Key] = struct{}{}
+		}
+	}
+
+	for key := range keys {
+		if err := c.deleteLocal(key); err != nil {
+			c.log.Err(err).Msgf("failed to invalidate %s", key)
+		}
+	}
+}
+
+// hit remembers response hit in memory, its TTL in external cache is prolonged by worker
+func (c *Cache) hit(key string) {
+	c.hitsMu.Lock()
+	c.hits[key] = struct{}{}
+	c.hitsMu.Unlock()
+}
+
+// prolong prolongs TTL of responses hit in memory since previous call
+func (c *Cache) prolong() {
+	c.hitsMu.Lock()
+	hits := c.hits
+	c.hits = make(map[string]struct{}, len(hits))
+	c.hitsMu.Unlock()
+
+	for key := range hits {
+		if err := c.External.Expire(key); err != nil {
+			c.log.Debug().Err(err).Msgf("failed to prolong %s", key)
+		}
+	}
+}
+
+// forget removes key from indexes of tags, URIs, Vary and requests
+func (c *Cache) forget(key string) {
+	c.tags.remove(key)
+	c.urls.remove(key)
+	c.vary.remove(key)
+
+	c.requestsMu.Lock()
+	delete(c.requests, key)
+	c.requestsMu.Unlock()
+}
+
+// Key returns key of response to request with base key, the variant of response is selected by request
+// headers from Vary of response
+func (c *Cache) Key(baseKey string, req *http.Request) string {
+	headers, ok := c.vary.get(baseKey)
+	if !ok {
+		headers = c.externalVary(baseKey)
+	}
+
+	key := httputils.HashWithHeaders(baseKey, req, headers)
+	// The headers from external cache are kept while variant is in memory or on disk
+	if !ok && key != baseKey && c.Has(key) {
+		c.vary.set(baseKey, key, headers)
 	}
+
+	return key
+}
+
+// Vary returns headers from Vary of responses to request with base key
+func (c *Cache) Vary(baseKey string) []string {
+	if headers, ok := c.vary.get(baseKey); ok {
+		return headers
+	}
+
+	return c.externalVary(baseKey)
+}
+
+// externalVary returns headers from Vary of responses to request with base key from external cache
+func (c *Cache) externalVary(baseKey string) []string {
+	// The response without Vary is cached by base key
+	if c.External == nil || c.Has(baseKey) {
+		return nil
+	}
+
+	headers, err := c.External.Vary(baseKey)
+	if err != nil {
+		c.log.Debug().Err(err).Msgf("failed to get vary of %s", baseKey)
+		return nil
+	}
+
+	return headers
+}
+
+// SetVary remembers headers from Vary of response to request with base key, the response is cached by key.
+// The headers are forgotten locally when the last variant is removed from memory and disk.
+func (c *Cache) SetVary(baseKey, key string, headers []string) error {
+	if len(headers) == 0 || c.Has(key) {
+		c.vary.set(baseKey, key, headers)
+	}
+
+	if c.Disk != nil && len(headers) > 0 {
+		if err := c.Disk.SetVary(key, baseKey, headers); err != nil {
+			return err
+		}
+	}
+
+	if c.External == nil {
+		return nil
+	}
+
+	return c.External.SetVary(baseKey, headers)
+}
+
+// keepRequest remembers request of data which is written to disk
+func (c *Cache) keepRequest(key string, data cachedata.CacheData) {
+	if value, ok := data.(*rrdata.RequestResponseData); ok && value.Request != nil {
+		c.requestsMu.Lock()
+		c.requests[key] = value.Request
+		c.requestsMu.Unlock()
+	}
+}
+
+// requestOf returns request of response on disk, it is nil if request is unknown,
+// e.g. response was loaded on start or was got from external cache
+func (c *Cache) requestOf(key string) *rrdata.RequestData {
+	c.requestsMu.Lock()
+	defer c.requestsMu.Unlock()
+
+	return c.requests[key]
+}
+
+// publish notifies other instances about change of item
+func (c *Cache) publish(eventType external.EventType, key string) error {
+	return c.External.PublishEvent(&external.Event{Origin: c.id, Type: eventType, Key: key})
+}
+
+// handleEvent drops or replaces inmemory copy of item changed by other instance
+func (c *Cache) handleEvent(event *external.Event) {
+	if event.Origin == c.id {
+		return
+	}
+
+	switch event.Type {
+	case external.EventInvalidate:
+		if err := c.deleteLocal(event.Key); err != nil {
+			c.log.Err(err).Msgf("failed to invalidate %s", event.Key)
+		}
+	case external.EventRefresh:
+		if err := c.replace(event.Key); err != nil {
+			c.log.Err(err).Msgf("failed to replace %s", event.Key)
+		}
+	}
+}
+
+// replace replaces local copies of item by item from external cache, the item which is not in memory
+// is only dropped from disk
+func (c *Cache) replace(key string) error {
+	v, err := c.Memory.Select(key)
+	if err == errors.ErrNotFound {
+		if c.Disk == nil {
+			return nil
+		}
+		return c.Disk.Delete(key)
+	} else if err != nil {
+		return err
+	}
+
+	value := &rrdata.RequestResponseData{}
+	if err = c.External.Select(key, value); err != nil {
+		// The item is not readable anymore, so the local copies are dropped
+		return c.deleteLocal(key)
+	}
+
+	// The request is not stored in external cache, the inmemory copy keeps it
+	if old, ok := v.(*rrdata.RequestResponseData); ok {
+		value.Request = old.Request
+	}
+
+	uris := c.urls.of(key)
+	if err = c.Memory.Delete(key); err != nil {
+		return err
+	}
+
+	if err = c.Memory.Add(key, value); err != nil {
+		return err
+	}
+	c.tags.set(key, value.Tags())
+	c.urls.set(key, uris)
+
+	return c.addDisk(key, value, uris)
+}
+
+// addDisk writes data to disk cache with request URIs of data
+func (c *Cache) addDisk(key string, data cachedata.CacheData, uris []string) error {
+	if c.Disk == nil {
+		return nil
+	}
+
+	if err := c.Disk.Add(key, data); err != nil {
+		return err
+	}
+	c.keepRequest(key, data)
+
+	for _, uri := range uris {
+		if err := c.Disk.SetURI(key, uri); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteLocal deletes data from memory and disk caches, the data in external cache is kept
+func (c *Cache) DeleteLocal(key string) error {
+	return c.deleteLocal(key)
+}
+
+// deleteLocal deletes item from memory and disk
+func (c *Cache) deleteLocal(key string) error {
+	if err := c.Memory.Delete(key); err != nil {
+		return err
+	}
+
+	if c.Disk == nil {
+		return nil
+	}
+
+	return c.Disk.Delete(key)
 }
 
 func (c *Cache) Add(key string, data cachedata.CacheData) error {
 	if err := c.Memory.Add(key, data); err != nil {
 		return err
 	}
+	c.tags.set(key, cachedata.TagsOf(data))
+
+	if c.Disk != nil {
+		if err := c.Disk.Add(key, data); err != nil {
+			return err
+		}
+		c.keepRequest(key, data)
+	}
 
 	if c.External == nil {
 		return nil
@@ -45,9 +443,199 @@ func (c *Cache) Add(key string, data cachedata.CacheData) error {
 		return err
 	}
 
+	if err := c.publish(external.EventInvalidate, key); err != nil {
+		return err
+	}
+
+	return c.addExternalTags(key, data)
+}
+
+// Update accounts size and tags of data which was changed in memory and updates data in disk and external caches
+func (c *Cache) Update(key string, data cachedata.CacheData) error {
+	c.tags.set(key, cachedata.TagsOf(data))
+
+	// The size of refreshed response is changed
+	if err := c.Memory.Update(key, data); err != nil {
+		return err
+	}
+
+	if err := c.addDisk(key, data, c.urls.of(key)); err != nil {
+		return err
+	}
+
+	if c.External == nil {
+		return nil
+	}
+
+	if err := c.External.Update(key, data); err != nil {
+		return err
+	}
+
+	if err := c.publish(external.EventRefresh, key); err != nil {
+		return err
+	}
+
+	return c.addExternalTags(key, data)
+}
+
+func (c *Cache) addExternalTags(key string, data cachedata.CacheData) error {
+	for _, tag := range cachedata.TagsOf(data) {
+		if err := c.External.AddTag(tag, key); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// AddURL indexes response by request URI, so it may be purged by URI
+func (c *Cache) AddURL(key, uri string) error {
+	c.urls.set(key, []string{uri})
+
+	if c.Disk != nil {
+		if err := c.Disk.SetURI(key, uri); err != nil {
+			return err
+		}
+	}
+
+	if c.External == nil {
+		return nil
+	}
+
+	return c.External.AddURL(uri, key)
+}
+
+// scope identifies storage of responses, the caches with the same external cache share responses
+func (c *Cache) scope() string {
+	if c.External != nil {
+		return "external:" + c.External.KeyPrefix()
+	}
+
+	return "local:" + c.id
+}
+
+// PurgeTag deletes all responses tagged by tag from memory and external cache, the responses
+// and indexes which are in purged already are not deleted from external cache again.
+// It returns count of deleted responses which were not in purged, purged may be nil.
+func (c *Cache) PurgeTag(tag string, purged *Purged) (int, error) {
+	if purged == nil {
+		purged = NewPurged()
+	}
+
+	keys := c.tags.keysOf(tag)
+
+	purgeExternal := c.External != nil && purged.addIndex(c.scope(), "tag:"+tag)
+	if purgeExternal {
+		externalKeys, err := c.External.TagKeys(tag)
+		if err != nil {
+			return 0, err
+		}
+
+		keys = mergeKeys(keys, externalKeys)
+	}
+
+	count, err := c.purgeKeys(keys, purged)
+	if err != nil {
+		return count, err
+	}
+
+	if purgeExternal {
+		if err = c.External.DeleteTag(tag); err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// PurgeURL deletes all responses to request URI from memory and external cache, the responses
+// and indexes which are in purged already are not deleted from external cache again.
+// It returns count of deleted responses which were not in purged, purged may be nil.
+func (c *Cache) PurgeURL(uri string, purged *Purged) (int, error) {
+	if purged == nil {
+		purged = NewPurged()
+	}
+
+	keys := c.urls.keysOf(uri)
+
+	purgeExternal := c.External != nil && purged.addIndex(c.scope(), "url:"+uri)
+	if purgeExternal {
+		externalKeys, err := c.External.URLKeys(uri)
+		if err != nil {
+			return 0, err
+		}
+
+		keys = mergeKeys(keys, externalKeys)
+	}
+
+	count, err := c.purgeKeys(keys, purged)
+	if err != nil {
+		return count, err
+	}
+
+	if purgeExternal {
+		if err = c.External.DeleteURL(uri); err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// Purge deletes all responses to request URIs matched by match from memory and external cache,
+// it returns count of deleted responses which were not in purged, purged may be nil
+func (c *Cache) Purge(match func(uri string) bool, purged *Purged) (int, error) {
+	if purged == nil {
+		purged = NewPurged()
+	}
+
+	uris := c.urls.all()
+
+	if c.External != nil && purged.addIndex(c.scope(), "urls") {
+		externalURIs, err := c.External.URLs()
+		if err != nil {
+			return 0, err
+		}
+
+		uris = mergeKeys(uris, externalURIs)
+	}
+
+	count := 0
+	for _, uri := range uris {
+		if !match(uri) {
+			continue
+		}
+
+		n, err := c.PurgeURL(uri, purged)
+		if err != nil {
+			return count, err
+		}
+		count += n
+	}
+
+	return count, nil
+}
+
+// purgeKeys deletes responses, the response which is in purged already is deleted only from memory and disk
+func (c *Cache) purgeKeys(keys []string, purged *Purged) (int, error) {
+	count := 0
+	for _, key := range keys {
+		if !purged.addKey(c.scope(), key) {
+			if err := c.deleteLocal(key); err != nil {
+				return count, err
+			}
+			continue
+		}
+
+		if err := c.Delete(key); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
 func (c *Cache) waitAnswer(hk string, ch chan struct{}) (*rrdata.RequestResponseData, error) {
 	<-ch
 
@@ -72,27 +660,23 @@ func (c *Cache) Select(key string) (*rrdata.RequestResponseData, error) {
 		return nil, err
 	}
 
-	// If we found key in memory cache we need to expire it in external cache
-	// and to check UUID
-	if value != nil && c.External != nil {
-		if value.Response.StatusCode < http.StatusBadRequest {
-			if err := c.External.Expire(key); err != nil {
-				return nil, err
-			}
+	// If we found key in memory cache we need to expire it in external cache, it is done in background,
+	// the changes of item by other instances come by events
+	if value != nil {
+		// data with own lifetime must not be prolonged
+		if c.External != nil && value.Response.StatusCode < http.StatusBadRequest && cachedata.ExpiresAt(value).IsZero() {
+			c.hit(key)
 		}
 
-		// Checking that item in external cache not changed
-		var UUID string
-		if err := c.External.GetUUID(key, &UUID); err != nil {
-			return nil, err
-		}
-
-		if value.Response.UUID.String() == UUID {
-			return value, nil
-		}
-	} else if value != nil {
 		return value, nil
-	} else if c.External == nil {
+	}
+
+	// Search in disk cache, the response from disk is kept in memory as well
+	if value, err := c.selectDisk(key); err != errors.ErrNotFound {
+		return value, err
+	}
+
+	if c.External == nil {
 		return nil, errors.ErrNotFound
 	}
 
@@ -136,6 +720,12 @@ func (c *Cache) Select(key string) (*rrdata.RequestResponseData, error) {
 				endWait()
 				return nil, err
 			}
+			c.tags.set(key, value.Tags())
+
+			if err := c.addDisk(key, value, nil); err != nil {
+				endWait()
+				return nil, err
+			}
 			endWait()
 			return value, nil
 		} else {
@@ -147,8 +737,67 @@ func (c *Cache) Select(key string) (*rrdata.RequestResponseData, error) {
 	}
 }
 
+// selectDisk selects data from disk cache and adds it to memory cache, the data which is too large
+// for memory is not added, its body is streamed from disk
+func (c *Cache) selectDisk(key string) (*rrdata.RequestResponseData, error) {
+	if c.Disk == nil {
+		return nil, errors.ErrNotFound
+	}
+
+	size, ok := c.Disk.SizeOf(key)
+	if !ok {
+		return nil, errors.ErrNotFound
+	}
+
+	value := &rrdata.RequestResponseData{}
+	if !c.Memory.Fits(size) {
+		if err := c.Disk.Stream(key, value); err != nil {
+			return nil, err
+		}
+		value.Request = c.requestOf(key)
+
+		return value, nil
+	}
+
+	if err := c.Disk.Select(key, value); err != nil {
+		return nil, err
+	}
+	value.Request = c.requestOf(key)
+
+	if err := c.Memory.Add(key, value); err != nil {
+		return nil, err
+	}
+	c.tags.set(key, value.Tags())
+
+	return value, nil
+}
+
+// Peek returns data from memory or disk cache, the data doesn't become recently used and it is not
+// added to memory, so the cold data expires
+func (c *Cache) Peek(key string) (*rrdata.RequestResponseData, error) {
+	v, err := c.Memory.Peek(key)
+	if err == nil {
+		return v.(*rrdata.RequestResponseData), nil
+	} else if err != errors.ErrNotFound || c.Disk == nil {
+		return nil, err
+	}
+
+	value := &rrdata.RequestResponseData{}
+	if err = c.Disk.Peek(key, value); err != nil {
+		return nil, err
+	}
+	value.Request = c.requestOf(key)
+
+	return value, nil
+}
+
+// Has checks that data is in memory or disk cache
+func (c *Cache) Has(key string) bool {
+	return c.Memory.Has(key) || (c.Disk != nil && c.Disk.Has(key))
+}
+
 func (c *Cache) Delete(key string) error {
-	if err := c.Memory.Delete(key); err != nil {
+	if err := c.deleteLocal(key); err != nil {
 		return err
 	}
 
@@ -156,5 +805,9 @@ func (c *Cache) Delete(key string) error {
 		return nil
 	}
 
-	return c.External.JSONDelete(key, ".")
+	if err := c.External.JSONDelete(key, "."); err != nil {
+		return err
+	}
+
+	return c.publish(external.EventInvalidate, key)
 }
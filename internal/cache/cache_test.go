@@ -6,13 +6,18 @@ import (
 	"errors"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/soldatov-s/accp/internal/cache/disk"
 	"github.com/soldatov-s/accp/internal/cache/external"
 	"github.com/soldatov-s/accp/internal/cache/memory"
+	"github.com/soldatov-s/accp/internal/httputils"
 	"github.com/soldatov-s/accp/internal/logger"
 	"github.com/soldatov-s/accp/internal/meta"
 	"github.com/soldatov-s/accp/internal/redis"
@@ -408,3 +413,274 @@ func TestDelete(t *testing.T) {
 	require.NotNil(t, err)
 	require.Nil(t, result)
 }
+
+func TestPurgeURL(t *testing.T) {
+	c, _ := initCache(t, "")
+
+	uris := map[string]string{
+		"key1": "/api/v1/users/1",
+		"key2": "/api/v1/users/1?fields=name",
+		"key3": "/api/v1/users/2",
+		"key4": "/api/v1/orders/1",
+	}
+	for key, uri := range uris {
+		err := c.Add(key, &testCacheDataWithUUID{Data: &testCacheData{Name: key, StatusCode: http.StatusOK}})
+		require.Nil(t, err)
+		err = c.AddURL(key, uri)
+		require.Nil(t, err)
+	}
+
+	count, err := c.PurgeURL("/api/v1/users/1", nil)
+	require.Nil(t, err)
+	require.Equal(t, 1, count)
+	_, err = c.Memory.Select("key1")
+	require.NotNil(t, err)
+	_, err = c.Memory.Select("key2")
+	require.Nil(t, err)
+
+	count, err = c.Purge(func(uri string) bool { return strings.HasPrefix(uri, "/api/v1/users/") }, nil)
+	require.Nil(t, err)
+	require.Equal(t, 2, count)
+	require.Equal(t, 1, c.Memory.Size())
+
+	_, err = c.Memory.Select("key4")
+	require.Nil(t, err)
+	require.Equal(t, []string{"/api/v1/orders/1"}, c.urls.all())
+}
+
+func TestHandleEvent(t *testing.T) {
+	c, _ := initCache(t, "")
+
+	err := c.Add(defaultKey, initRequestResponseData(nil))
+	require.Nil(t, err)
+	err = c.AddURL(defaultKey, "/api/v1/users/1")
+	require.Nil(t, err)
+
+	// Own event is ignored
+	c.handleEvent(&external.Event{Origin: c.id, Type: external.EventInvalidate, Key: defaultKey})
+	_, err = c.Memory.Select(defaultKey)
+	require.Nil(t, err)
+
+	c.handleEvent(&external.Event{Origin: "other", Type: external.EventInvalidate, Key: defaultKey})
+	_, err = c.Memory.Select(defaultKey)
+	require.NotNil(t, err)
+	require.Empty(t, c.urls.all())
+}
+
+func TestQueueEvent(t *testing.T) {
+	c, _ := initCache(t, "")
+	c.events = make(chan *external.Event, 1)
+	c.dropped = make(map[string]struct{})
+
+	err := c.Add(defaultKey, initRequestResponseData(nil))
+	require.Nil(t, err)
+
+	// The event is applied by worker later
+	c.queueEvent(&external.Event{Origin: "other", Type: external.EventRefresh, Key: defaultKey})
+	require.Equal(t, 1, len(c.events))
+	require.True(t, c.Memory.Has(defaultKey))
+
+	// The local copy is dropped by worker if worker is overloaded
+	c.queueEvent(&external.Event{Origin: "other", Type: external.EventRefresh, Key: defaultKey})
+	require.Equal(t, 1, len(c.events))
+	require.True(t, c.Memory.Has(defaultKey))
+	c.dropStale()
+	require.False(t, c.Memory.Has(defaultKey))
+}
+
+func TestFlushLocal(t *testing.T) {
+	c, _ := initCache(t, "")
+	c.dropped = make(map[string]struct{})
+
+	err := c.Add(defaultKey, initRequestResponseData(nil))
+	require.Nil(t, err)
+	err = c.Add("other", initRequestResponseData(nil))
+	require.Nil(t, err)
+
+	// All local copies are dropped if events may be lost
+	atomic.StoreInt32(&c.flush, 1)
+	c.dropStale()
+	require.Equal(t, 0, c.Memory.Size())
+	require.Equal(t, int32(0), atomic.LoadInt32(&c.flush))
+}
+
+func TestDiskCache(t *testing.T) {
+	ctx := initLogger(initApp(context.Background()))
+	cfg := &Config{
+		Memory: &memory.Config{TTL: 5 * time.Second, TTLErr: 3 * time.Second},
+		Disk:   &disk.Config{Path: t.TempDir()},
+	}
+
+	c := NewCache(ctx, cfg, nil)
+	require.NotNil(t, c.Disk)
+
+	err := c.Add(defaultKey, initRequestResponseData(nil))
+	require.Nil(t, err)
+	err = c.AddURL(defaultKey, "/api/v1/users/1")
+	require.Nil(t, err)
+
+	// The response removed from memory is selected from disk and kept in memory again
+	err = c.Memory.Delete(defaultKey)
+	require.Nil(t, err)
+	require.Equal(t, []string{"/api/v1/users/1"}, c.urls.all())
+
+	value, err := c.Select(defaultKey)
+	require.Nil(t, err)
+	require.Equal(t, "test body", value.Response.Body)
+	require.True(t, c.Memory.Has(defaultKey))
+
+	// The response on disk survives restart and may be purged by URI
+	c = NewCache(ctx, cfg, nil)
+	require.Equal(t, 0, c.Memory.Size())
+
+	value, err = c.Select(defaultKey)
+	require.Nil(t, err)
+	require.Equal(t, "test body", value.Response.Body)
+
+	count, err := c.PurgeURL("/api/v1/users/1", nil)
+	require.Nil(t, err)
+	require.Equal(t, 1, count)
+	require.False(t, c.Disk.Has(defaultKey))
+	require.False(t, c.Memory.Has(defaultKey))
+
+	_, err = c.Select(defaultKey)
+	require.NotNil(t, err)
+}
+
+func TestDiskCacheLarge(t *testing.T) {
+	ctx := initLogger(initApp(context.Background()))
+	cfg := &Config{
+		Memory: &memory.Config{TTL: 5 * time.Second, TTLErr: 3 * time.Second, MaxBytes: 100},
+		Disk:   &disk.Config{Path: t.TempDir()},
+	}
+
+	c := NewCache(ctx, cfg, nil)
+	require.NotNil(t, c.Disk)
+
+	testData := initRequestResponseData(nil)
+	testData.Response.Body = strings.Repeat("large body ", 100)
+	testData.Request = &rrdata.RequestData{URL: "http://localhost/api/v1/users/1", Method: http.MethodGet}
+	err := c.Add(defaultKey, testData)
+	require.Nil(t, err)
+
+	// The response which doesn't fit in memory is kept only on disk, its body is streamed on hit
+	require.False(t, c.Memory.Has(defaultKey))
+	require.True(t, c.Has(defaultKey))
+
+	value, err := c.Select(defaultKey)
+	require.Nil(t, err)
+	require.Empty(t, value.Response.Body)
+	require.False(t, c.Memory.Has(defaultKey))
+
+	w := httptest.NewRecorder()
+	err = value.Response.WriteConditional(w, httptest.NewRequest(http.MethodGet, "/", nil), rrdata.ResponseCache)
+	require.Nil(t, err)
+	require.Equal(t, testData.Response.Body, w.Body.String())
+
+	// The response on disk may be refreshed, the request is kept
+	value, err = c.Peek(defaultKey)
+	require.Nil(t, err)
+	require.Equal(t, testData.Response.Body, value.Response.Body)
+	require.Equal(t, testData.Request, value.Request)
+
+	err = c.Delete(defaultKey)
+	require.Nil(t, err)
+	require.False(t, c.Has(defaultKey))
+	require.Nil(t, c.requestOf(defaultKey))
+}
+
+func TestVary(t *testing.T) {
+	ctx := initLogger(initApp(context.Background()))
+	cfg := &Config{
+		Memory: &memory.Config{TTL: 5 * time.Second, TTLErr: 3 * time.Second},
+		Disk:   &disk.Config{Path: t.TempDir()},
+	}
+
+	c := NewCache(ctx, cfg, nil)
+	require.NotNil(t, c.Disk)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Language", "ru")
+	headers := []string{"Accept-Language"}
+	key := httputils.HashWithHeaders(defaultKey, req, headers)
+	require.Equal(t, defaultKey, c.Key(defaultKey, req))
+
+	require.Nil(t, c.Add(key, initRequestResponseData(nil)))
+	require.Nil(t, c.SetVary(defaultKey, key, headers))
+	require.Equal(t, key, c.Key(defaultKey, req))
+	require.Equal(t, headers, c.Vary(defaultKey))
+
+	// The Vary of response on disk survives restart
+	c = NewCache(ctx, cfg, nil)
+	require.Equal(t, key, c.Key(defaultKey, req))
+
+	// The Vary is forgotten with the last variant
+	require.Nil(t, c.Delete(key))
+	require.Empty(t, c.Vary(defaultKey))
+	require.Equal(t, defaultKey, c.Key(defaultKey, req))
+}
+
+func TestCoherence(t *testing.T) {
+	dsn, err := dockertest.RunRedis()
+	require.Nil(t, err)
+	defer dockertest.KillAllDockers()
+
+	c1, client := initCache(t, dsn)
+	c2 := NewCache(initLogger(initApp(context.Background())), initConfig(), client)
+
+	testData := initRequestResponseData(c1.External)
+	err = c1.Add(defaultKey, testData)
+	require.Nil(t, err)
+
+	// The second instance loads item to memory
+	result, err := c2.Select(defaultKey)
+	require.Nil(t, err)
+	require.Equal(t, testData.Response.Body, result.Response.Body)
+
+	// The refreshed item is replaced in memory of the second instance
+	testData.Response.Body = "refreshed body"
+	err = c1.Update(defaultKey, testData)
+	require.Nil(t, err)
+	require.Eventually(t, func() bool {
+		v, errSelect := c2.Memory.Select(defaultKey)
+		return errSelect == nil && v.(*rrdata.RequestResponseData).Response.Body == "refreshed body"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The deleted item is dropped from memory of the second instance
+	err = c1.Delete(defaultKey)
+	require.Nil(t, err)
+	require.Eventually(t, func() bool {
+		_, errSelect := c2.Memory.Select(defaultKey)
+		return errSelect != nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPurgeSharedExternal(t *testing.T) {
+	dsn, err := dockertest.RunRedis()
+	require.Nil(t, err)
+	defer dockertest.KillAllDockers()
+
+	c1, client := initCache(t, dsn)
+	c2 := NewCache(initLogger(initApp(context.Background())), initConfig(), client)
+
+	err = c1.Add(defaultKey, initRequestResponseData(c1.External))
+	require.Nil(t, err)
+	err = c1.AddURL(defaultKey, "/api/v1/users/1")
+	require.Nil(t, err)
+
+	_, err = c2.Select(defaultKey)
+	require.Nil(t, err)
+	err = c2.AddURL(defaultKey, "/api/v1/users/1")
+	require.Nil(t, err)
+
+	// The caches share external cache, so the response is deleted from it and counted once
+	purged := NewPurged()
+	count, err := c1.PurgeURL("/api/v1/users/1", purged)
+	require.Nil(t, err)
+	require.Equal(t, 1, count)
+
+	count, err = c2.PurgeURL("/api/v1/users/1", purged)
+	require.Nil(t, err)
+	require.Equal(t, 0, count)
+	require.False(t, c2.Memory.Has(defaultKey))
+}
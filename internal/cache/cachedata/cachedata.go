@@ -12,6 +12,87 @@ type CacheData interface {
 	GetStatusCode() int
 }
 
+// Expirable is a data which has own lifetime in cache, the zero time of ExpiresAt
+// means that data has not own lifetime and it is expired by TTL from config
+type Expirable interface {
+	ExpiresAt() time.Time
+}
+
+// ExpiresAt returns expiration time of data, zero time if data has not own lifetime
+func ExpiresAt(data interface{}) time.Time {
+	if e, ok := data.(Expirable); ok {
+		return e.ExpiresAt()
+	}
+
+	return time.Time{}
+}
+
+// Expired checks that data has own lifetime and it is expired
+func Expired(data interface{}, now time.Time) bool {
+	expiresAt := ExpiresAt(data)
+	return !expiresAt.IsZero() && !now.Before(expiresAt)
+}
+
+// CapTTL returns the least of ttl and own lifetime of data
+func CapTTL(data interface{}, ttl time.Duration, now time.Time) time.Duration {
+	expiresAt := ExpiresAt(data)
+	if expiresAt.IsZero() {
+		return ttl
+	}
+
+	if d := expiresAt.Sub(now); d < ttl {
+		return d
+	}
+
+	return ttl
+}
+
+// Sizer is a data which knows own size in bytes
+type Sizer interface {
+	Size() int64
+}
+
+// SizeOf returns size of data in bytes, the size of data which is not Sizer is a length of its binary form
+func SizeOf(data interface{}) int64 {
+	switch d := data.(type) {
+	case Sizer:
+		return d.Size()
+	case CacheData:
+		if b, err := d.MarshalBinary(); err == nil {
+			return int64(len(b))
+		}
+	}
+
+	return 0
+}
+
+// Tagged is a data which has tags, all data with tag may be purged from cache
+type Tagged interface {
+	Tags() []string
+}
+
+// TagsOf returns tags of data
+func TagsOf(data interface{}) []string {
+	if t, ok := data.(Tagged); ok {
+		return t.Tags()
+	}
+
+	return nil
+}
+
+// Streamable is a data which body is kept on disk apart from the rest of data, so the large body
+// is streamed from file on hit instead of reading it to memory
+type Streamable interface {
+	// MarshalHead returns binary form of data without body
+	MarshalHead() ([]byte, error)
+	// StoredBody returns body as it is kept in cache
+	StoredBody() ([]byte, error)
+	// UnmarshalHead reads data without body, the body is read from bodyFile when it is needed
+	UnmarshalHead(data []byte, bodyFile string) error
+	// LoadBody reads body from file, so the data doesn't depend on file anymore
+	LoadBody() error
+}
+
 // CacheItem is an item of cache
 type CacheItem struct {
 	Data      interface{}
@@ -0,0 +1,73 @@
+package cache
+
+import "time"
+
+const (
+	defaultCoalescingLockTTL      = 10 * time.Second
+	defaultCoalescingWait         = 5 * time.Second
+	defaultCoalescingPollInterval = 50 * time.Millisecond
+)
+
+// CoalescingConfig is a config of coalescing of identical requests across instances. The instance
+// which took lock of request in external cache requests backend, other instances wait for response
+// in external cache and request backend themselves after timeout.
+type CoalescingConfig struct {
+	// Distributed enables coalescing by lock in external cache, by default identical requests
+	// are coalesced only within instance
+	Distributed bool
+	// LockTTL is a lifetime of lock, it limits waiting for instance which failed while holding lock
+	LockTTL time.Duration
+	// Wait is a max duration of waiting for response of other instance
+	Wait time.Duration
+	// PollInterval is a period of checking external cache while waiting
+	PollInterval time.Duration
+}
+
+func (c *CoalescingConfig) SetDefault() {
+	if c.LockTTL == 0 {
+		c.LockTTL = defaultCoalescingLockTTL
+	}
+
+	if c.Wait == 0 {
+		c.Wait = defaultCoalescingWait
+	}
+
+	if c.PollInterval == 0 {
+		c.PollInterval = defaultCoalescingPollInterval
+	}
+}
+
+func (c *CoalescingConfig) Merge(target *CoalescingConfig) *CoalescingConfig {
+	if c == nil {
+		return target
+	}
+
+	result := &CoalescingConfig{
+		Distributed:  c.Distributed,
+		LockTTL:      c.LockTTL,
+		Wait:         c.Wait,
+		PollInterval: c.PollInterval,
+	}
+
+	if target == nil {
+		return result
+	}
+
+	if target.Distributed {
+		result.Distributed = true
+	}
+
+	if target.LockTTL > 0 {
+		result.LockTTL = target.LockTTL
+	}
+
+	if target.Wait > 0 {
+		result.Wait = target.Wait
+	}
+
+	if target.PollInterval > 0 {
+		result.PollInterval = target.PollInterval
+	}
+
+	return result
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"github.com/pkg/errors"
+	"github.com/soldatov-s/accp/internal/httputils"
+)
+
+const (
+	defaultCompressionEncoding = httputils.EncodingGzip
+	defaultCompressionMinSize  = 1024
+)
+
+// CompressionConfig is a config of compression of cached bodies. The compressed body is served as is
+// to client which accepts encoding, otherwise it is decompressed on the fly.
+type CompressionConfig struct {
+	// Encoding is gzip or zstd, by default gzip
+	Encoding string
+	// MinSize is a min size of compressed body in bytes, the smaller bodies are kept as is
+	MinSize int
+}
+
+func (c *CompressionConfig) SetDefault() {
+	if c.Encoding == "" {
+		c.Encoding = defaultCompressionEncoding
+	}
+
+	if c.MinSize == 0 {
+		c.MinSize = defaultCompressionMinSize
+	}
+}
+
+// Validate checks that encoding is supported
+func (c *CompressionConfig) Validate() error {
+	if c.Encoding == "" || httputils.ValidEncoding(c.Encoding) {
+		return nil
+	}
+
+	return errors.Wrap(httputils.ErrUnknownEncoding, c.Encoding)
+}
+
+func (c *CompressionConfig) Merge(target *CompressionConfig) *CompressionConfig {
+	if c == nil {
+		return target
+	}
+
+	result := &CompressionConfig{
+		Encoding: c.Encoding,
+		MinSize:  c.MinSize,
+	}
+
+	if target == nil {
+		return result
+	}
+
+	if target.Encoding != "" {
+		result.Encoding = target.Encoding
+	}
+
+	if target.MinSize > 0 {
+		result.MinSize = target.MinSize
+	}
+
+	return result
+}
@@ -1,6 +1,9 @@
 package cache
 
 import (
+	"time"
+
+	"github.com/soldatov-s/accp/internal/cache/disk"
 	"github.com/soldatov-s/accp/internal/cache/external"
 	"github.com/soldatov-s/accp/internal/cache/memory"
 )
@@ -10,8 +13,35 @@ type Config struct {
 	Disabled bool
 	// Memory is a inmemory cache config
 	Memory *memory.Config
+	// Disk is a disk cache config, responses on disk are looked up after memory and before external cache
+	Disk *disk.Config
 	// External is a external cache config
 	External *external.Config
+	// MaxAge is a period during which response is fresh, zero means that response is fresh
+	// until it is refreshed by count or by time
+	MaxAge time.Duration
+	// StaleWhileRevalidate is a period after MaxAge during which stale response is served
+	// immediately while one background refresh runs, after this period response is refreshed
+	// before answer
+	StaleWhileRevalidate time.Duration
+	// StaleIfError is a max stale age (after MaxAge) of response which is served if refresh failed,
+	// zero means that failed refresh replaces response by error
+	StaleIfError time.Duration
+	// RespectCacheControl enables Cache-Control, Expires and Vary of backend responses,
+	// they decide whether response is cached, for how long and which request headers
+	// go into the key, TTL from config is a cap of lifetime of response
+	RespectCacheControl bool
+	// Key is a spec of cache key, by default the key is a hash of request URI, method and body
+	Key *KeyConfig
+	// Compression enables compression of cached bodies, nil means that bodies are not compressed
+	Compression *CompressionConfig
+	// MaxCacheBodySize is a max size of cached response body in bytes, the larger responses are streamed
+	// to client and not cached, the smaller ones are captured while they are streamed. Zero means that
+	// response is read fully before it is written to client.
+	MaxCacheBodySize int64
+	// Coalescing is a config of coalescing of identical requests across instances, nil means that
+	// requests are coalesced only within instance
+	Coalescing *CoalescingConfig
 }
 
 func (c *Config) SetDefault() {
@@ -25,21 +55,61 @@ func (c *Config) SetDefault() {
 
 	c.Memory.SetDefault()
 
+	if c.Disk != nil {
+		c.Disk.SetDefault()
+	}
+
+	if c.Compression != nil {
+		c.Compression.SetDefault()
+	}
+
+	if c.Coalescing != nil {
+		c.Coalescing.SetDefault()
+	}
+
 	if c.External == nil {
 		return
 	}
 	c.External.SetDefault()
 }
 
+// Validate checks parameters which can't be fixed by defaults
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if c.Memory != nil {
+		if err := c.Memory.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Compression != nil {
+		return c.Compression.Validate()
+	}
+
+	return nil
+}
+
 func (c *Config) Merge(target *Config) *Config {
 	if c == nil {
 		return target
 	}
 
 	result := &Config{
-		Disabled: c.Disabled,
-		Memory:   c.Memory,
-		External: c.External,
+		Disabled:             c.Disabled,
+		Memory:               c.Memory,
+		Disk:                 c.Disk,
+		External:             c.External,
+		MaxAge:               c.MaxAge,
+		StaleWhileRevalidate: c.StaleWhileRevalidate,
+		StaleIfError:         c.StaleIfError,
+		RespectCacheControl:  c.RespectCacheControl,
+		Key:                  c.Key,
+		Compression:          c.Compression,
+		MaxCacheBodySize:     c.MaxCacheBodySize,
+		Coalescing:           c.Coalescing,
 	}
 
 	if target == nil {
@@ -59,9 +129,45 @@ func (c *Config) Merge(target *Config) *Config {
 		result.Memory = c.Memory.Merge(target.Memory)
 	}
 
+	if target.Disk != nil {
+		result.Disk = c.Disk.Merge(target.Disk)
+	}
+
 	if target.External != nil {
 		result.External = c.External.Merge(target.External)
 	}
 
+	if target.MaxAge > 0 {
+		result.MaxAge = target.MaxAge
+	}
+
+	if target.StaleWhileRevalidate > 0 {
+		result.StaleWhileRevalidate = target.StaleWhileRevalidate
+	}
+
+	if target.StaleIfError > 0 {
+		result.StaleIfError = target.StaleIfError
+	}
+
+	if target.RespectCacheControl {
+		result.RespectCacheControl = true
+	}
+
+	if target.Key != nil {
+		result.Key = c.Key.Merge(target.Key)
+	}
+
+	if target.Compression != nil {
+		result.Compression = c.Compression.Merge(target.Compression)
+	}
+
+	if target.MaxCacheBodySize > 0 {
+		result.MaxCacheBodySize = target.MaxCacheBodySize
+	}
+
+	if target.Coalescing != nil {
+		result.Coalescing = c.Coalescing.Merge(target.Coalescing)
+	}
+
 	return result
 }
@@ -1,11 +1,15 @@
 package cache
 
 import (
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/soldatov-s/accp/internal/cache/disk"
+	cacheerrors "github.com/soldatov-s/accp/internal/cache/errors"
 	"github.com/soldatov-s/accp/internal/cache/external"
 	"github.com/soldatov-s/accp/internal/cache/memory"
+	"github.com/soldatov-s/accp/internal/httputils"
 	"github.com/stretchr/testify/require"
 )
 
@@ -153,3 +157,74 @@ func TestMerge(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeStale(t *testing.T) {
+	src := &Config{MaxAge: time.Second, StaleIfError: time.Minute}
+	cc := src.Merge(&Config{StaleWhileRevalidate: 5 * time.Second, StaleIfError: time.Hour})
+	require.Equal(t, time.Second, cc.MaxAge)
+	require.Equal(t, 5*time.Second, cc.StaleWhileRevalidate)
+	require.Equal(t, time.Hour, cc.StaleIfError)
+}
+
+func TestMergeRespectCacheControl(t *testing.T) {
+	src := &Config{}
+	require.False(t, src.Merge(&Config{}).RespectCacheControl)
+	require.True(t, src.Merge(&Config{RespectCacheControl: true}).RespectCacheControl)
+	require.True(t, (&Config{RespectCacheControl: true}).Merge(&Config{}).RespectCacheControl)
+}
+
+func TestMergeKey(t *testing.T) {
+	src := &Config{Key: &KeyConfig{QuerySort: true, Headers: []string{"accept-language"}}}
+	cc := src.Merge(&Config{Key: &KeyConfig{Claims: []string{"sub"}}})
+	require.Equal(t, &KeyConfig{QuerySort: true, Headers: []string{"accept-language"}, Claims: []string{"sub"}}, cc.Key)
+	require.Equal(t, src.Key, src.Merge(&Config{}).Key)
+	require.Nil(t, (&Config{}).Merge(&Config{}).Key)
+}
+
+func TestMergeDisk(t *testing.T) {
+	src := &Config{Disk: &disk.Config{Path: "/var/cache/accp", TTL: time.Hour}}
+	cc := src.Merge(&Config{Disk: &disk.Config{MaxBytes: 1 << 30}})
+	require.Equal(t, &disk.Config{Path: "/var/cache/accp", TTL: time.Hour, MaxBytes: 1 << 30}, cc.Disk)
+	require.Equal(t, src.Disk, src.Merge(&Config{}).Disk)
+	require.Nil(t, (&Config{}).Merge(&Config{}).Disk)
+}
+
+func TestMergeCompression(t *testing.T) {
+	src := &Config{Compression: &CompressionConfig{Encoding: "zstd", MinSize: 512}}
+	cc := src.Merge(&Config{Compression: &CompressionConfig{MinSize: 4096}})
+	require.Equal(t, &CompressionConfig{Encoding: "zstd", MinSize: 4096}, cc.Compression)
+	require.Equal(t, src.Compression, src.Merge(&Config{}).Compression)
+	require.Nil(t, (&Config{}).Merge(&Config{}).Compression)
+
+	cfg := &Config{Compression: &CompressionConfig{}}
+	cfg.SetDefault()
+	require.Equal(t, &CompressionConfig{Encoding: defaultCompressionEncoding, MinSize: defaultCompressionMinSize}, cfg.Compression)
+}
+
+func TestValidate(t *testing.T) {
+	require.Nil(t, (*Config)(nil).Validate())
+	require.Nil(t, (&Config{Compression: &CompressionConfig{Encoding: httputils.EncodingZstd}}).Validate())
+	require.True(t, errors.Is((&Config{Compression: &CompressionConfig{Encoding: "br"}}).Validate(), httputils.ErrUnknownEncoding))
+	require.True(t, errors.Is((&Config{Memory: &memory.Config{Eviction: "lfru"}}).Validate(), cacheerrors.ErrUnknownEviction))
+}
+
+func TestMergeMaxCacheBodySize(t *testing.T) {
+	src := &Config{MaxCacheBodySize: 1024}
+	require.Equal(t, int64(1024), src.Merge(&Config{}).MaxCacheBodySize)
+	require.Equal(t, int64(4096), src.Merge(&Config{MaxCacheBodySize: 4096}).MaxCacheBodySize)
+}
+
+func TestMergeCoalescing(t *testing.T) {
+	src := &Config{Coalescing: &CoalescingConfig{Distributed: true, Wait: time.Second}}
+	cc := src.Merge(&Config{Coalescing: &CoalescingConfig{LockTTL: time.Minute}})
+	require.Equal(t, &CoalescingConfig{Distributed: true, LockTTL: time.Minute, Wait: time.Second}, cc.Coalescing)
+	require.Nil(t, (&Config{}).Merge(&Config{}).Coalescing)
+
+	cfg := &Config{Coalescing: &CoalescingConfig{}}
+	cfg.SetDefault()
+	require.Equal(t, &CoalescingConfig{
+		LockTTL:      defaultCoalescingLockTTL,
+		Wait:         defaultCoalescingWait,
+		PollInterval: defaultCoalescingPollInterval,
+	}, cfg.Coalescing)
+}
@@ -0,0 +1,90 @@
+package disk
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTTL    = 24 * time.Hour
+	defaultTTLErr = 5 * time.Second
+	// subdirHashLen is a length of hash in name of directory of route
+	subdirHashLen = 8
+)
+
+type Config struct {
+	// Path is a directory of cache, empty path disables disk cache
+	Path string
+	// TTL is a lifetime of response on disk, it is counted from writing of response
+	TTL    time.Duration
+	TTLErr time.Duration
+	// MaxBytes is a max size of responses on disk, zero means unlimited
+	MaxBytes int64
+}
+
+func (c *Config) SetDefault() {
+	if c.TTL == 0 {
+		c.TTL = defaultTTL
+	}
+
+	if c.TTLErr == 0 {
+		c.TTLErr = defaultTTLErr
+	}
+}
+
+// Enabled checks that disk cache is configured
+func (c *Config) Enabled() bool {
+	return c != nil && c.Path != ""
+}
+
+// Subdir returns config with own directory of route in Path, so routes don't share files.
+// The name of directory is readable name of route with hash of it, so different names don't collide.
+func (c *Config) Subdir(name string) *Config {
+	result := *c
+	readable := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.Trim(name, "/"))
+
+	result.Path = filepath.Join(c.Path, readable+"-"+fileName(name)[:subdirHashLen])
+
+	return &result
+}
+
+func (c *Config) Merge(target *Config) *Config {
+	if c == nil {
+		return target
+	}
+
+	result := &Config{
+		Path:     c.Path,
+		TTL:      c.TTL,
+		TTLErr:   c.TTLErr,
+		MaxBytes: c.MaxBytes,
+	}
+
+	if target == nil {
+		return result
+	}
+
+	if target.Path != "" {
+		result.Path = target.Path
+	}
+
+	if target.TTL > 0 {
+		result.TTL = target.TTL
+	}
+
+	if target.TTLErr > 0 {
+		result.TTLErr = target.TTLErr
+	}
+
+	if target.MaxBytes > 0 {
+		result.MaxBytes = target.MaxBytes
+	}
+
+	return result
+}
@@ -0,0 +1,78 @@
+package disk
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.SetDefault()
+
+	require.Equal(t, defaultTTL, cfg.TTL)
+	require.Equal(t, defaultTTLErr, cfg.TTLErr)
+}
+
+func TestEnabled(t *testing.T) {
+	var cfg *Config
+	require.False(t, cfg.Enabled())
+	require.False(t, (&Config{}).Enabled())
+	require.True(t, (&Config{Path: "/tmp/accp"}).Enabled())
+}
+
+func TestSubdir(t *testing.T) {
+	cfg := &Config{Path: "/tmp/accp", TTL: time.Hour}
+
+	users := cfg.Subdir("/api/v1/users")
+	require.Equal(t, "/tmp/accp", filepath.Dir(users.Path))
+	require.Equal(t, "api_v1_users-"+fileName("/api/v1/users")[:subdirHashLen], filepath.Base(users.Path))
+	require.Equal(t, time.Hour, users.TTL)
+	require.Equal(t, "/tmp/accp", cfg.Path)
+
+	// The names with the same readable part don't collide
+	require.NotEqual(t, users.Path, cfg.Subdir("/api/v1_users").Path)
+	require.Equal(t, "/tmp/accp", filepath.Dir(cfg.Subdir("../..").Path))
+}
+
+// nolint : dupl
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name           string
+		srcConfig      *Config
+		targetConfig   *Config
+		expectedConfig *Config
+	}{
+		{
+			name:           "target is nil",
+			srcConfig:      &Config{Path: "/tmp/accp", TTL: time.Hour},
+			targetConfig:   nil,
+			expectedConfig: &Config{Path: "/tmp/accp", TTL: time.Hour},
+		},
+		{
+			name:           "source is nil",
+			srcConfig:      nil,
+			targetConfig:   &Config{Path: "/tmp/accp"},
+			expectedConfig: &Config{Path: "/tmp/accp"},
+		},
+		{
+			name:      "target overrides source",
+			srcConfig: &Config{Path: "/tmp/accp", TTL: time.Hour, TTLErr: time.Second, MaxBytes: 100},
+			targetConfig: &Config{
+				Path:     "/var/cache/accp",
+				TTL:      2 * time.Hour,
+				MaxBytes: 200,
+			},
+			expectedConfig: &Config{Path: "/var/cache/accp", TTL: 2 * time.Hour, TTLErr: time.Second, MaxBytes: 200},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expectedConfig, tt.srcConfig.Merge(tt.targetConfig))
+		})
+	}
+}
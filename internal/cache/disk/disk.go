@@ -0,0 +1,548 @@
+package disk
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/soldatov-s/accp/internal/cache/cachedata"
+	cacheerrors "github.com/soldatov-s/accp/internal/cache/errors"
+	"github.com/soldatov-s/accp/internal/logger"
+)
+
+const (
+	dataExt = ".data"
+	metaExt = ".meta"
+	tmpExt  = ".tmp"
+	// bodyExt is an extension of file with body of cachedata.Streamable, the data file has the rest of data
+	bodyExt = ".body"
+
+	dirPerm  = 0o755
+	filePerm = 0o644
+)
+
+type empty struct{}
+
+// Entry describes response on disk
+type Entry struct {
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Size      int64     `json:"size"`
+	Tags      []string  `json:"tags,omitempty"`
+	URI       string    `json:"uri,omitempty"`
+	// Base is a base key of request of response which varies by Vary headers
+	Base string   `json:"base,omitempty"`
+	Vary []string `json:"vary,omitempty"`
+	// Streamed says that body is kept in own file, so it may be streamed
+	Streamed bool `json:"streamed,omitempty"`
+}
+
+type item struct {
+	Entry
+	// name is a name of files of item
+	name string
+	elem *list.Element
+}
+
+// Cache keeps responses in files, every response has data file and meta file with Entry.
+// The index of files is loaded on start, so responses survive restarts.
+type Cache struct {
+	ctx        context.Context
+	cfg        *Config
+	log        zerolog.Logger
+	clearTimer *time.Timer
+	// mu guards items, order and bytes
+	mu    sync.Mutex
+	items map[string]*item
+	// order has most recently used item in front
+	order *list.List
+	bytes int64
+	// onRemove is called after item is removed from cache
+	onRemove func(key string)
+}
+
+func NewCache(ctx context.Context, cfg *Config) (*Cache, error) {
+	cfg.SetDefault()
+
+	c := &Cache{
+		ctx:   ctx,
+		cfg:   cfg,
+		log:   logger.GetPackageLogger(ctx, empty{}),
+		items: make(map[string]*item),
+		order: list.New(),
+	}
+
+	if err := os.MkdirAll(cfg.Path, dirPerm); err != nil {
+		return nil, errors.Wrap(err, "failed to create directory of disk cache")
+	}
+
+	if err := c.load(); err != nil {
+		return nil, errors.Wrap(err, "failed to load disk cache")
+	}
+
+	period := cfg.TTL
+	if cfg.TTLErr < period {
+		period = cfg.TTLErr
+	}
+	c.clearTimer = time.AfterFunc(period, func() {
+		c.ClearCache()
+		c.clearTimer.Reset(period)
+	})
+
+	c.log.Info().Msgf("created disk cache in %s with %d responses", cfg.Path, len(c.items))
+
+	return c, nil
+}
+
+// fileName returns name of files of key, the key may have any symbols
+func fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cache) path(name, ext string) string {
+	return filepath.Join(c.cfg.Path, name+ext)
+}
+
+// load reads meta files, the expired responses and broken files are removed
+func (c *Cache) load() error {
+	files, err := ioutil.ReadDir(c.cfg.Path)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	loaded := make([]*item, 0)
+	modTimes := make(map[string]time.Time)
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		name := f.Name()
+		switch filepath.Ext(name) {
+		case metaExt:
+		case dataExt:
+			// Data without meta is removed with meta below
+			if _, errStat := os.Stat(c.path(strings.TrimSuffix(name, dataExt), metaExt)); errStat == nil {
+				modTimes[strings.TrimSuffix(name, dataExt)] = f.ModTime()
+				continue
+			}
+			c.removeFile(filepath.Join(c.cfg.Path, name))
+			continue
+		case bodyExt:
+			// Body is removed with data and meta
+			if _, errStat := os.Stat(c.path(strings.TrimSuffix(name, bodyExt), metaExt)); errStat == nil {
+				continue
+			}
+			c.removeFile(filepath.Join(c.cfg.Path, name))
+			continue
+		default:
+			c.removeFile(filepath.Join(c.cfg.Path, name))
+			continue
+		}
+
+		it := &item{name: strings.TrimSuffix(name, metaExt)}
+		if errMeta := c.readMeta(it); errMeta != nil || !now.Before(it.ExpiresAt) || !c.hasBody(it) {
+			c.removeFiles(it.name)
+			continue
+		}
+
+		loaded = append(loaded, it)
+	}
+
+	// The least recently written response is evicted first
+	sort.Slice(loaded, func(i, j int) bool {
+		return modTimes[loaded[i].name].Before(modTimes[loaded[j].name])
+	})
+
+	for _, it := range loaded {
+		if _, ok := modTimes[it.name]; !ok {
+			c.removeFiles(it.name)
+			continue
+		}
+
+		it.elem = c.order.PushFront(it.Key)
+		c.items[it.Key] = it
+		c.bytes += it.Size
+	}
+
+	return nil
+}
+
+// hasBody checks that item which body is kept in own file has the file
+func (c *Cache) hasBody(it *item) bool {
+	if !it.Streamed {
+		return true
+	}
+
+	_, err := os.Stat(c.path(it.name, bodyExt))
+
+	return err == nil
+}
+
+func (c *Cache) readMeta(it *item) error {
+	data, err := ioutil.ReadFile(c.path(it.name, metaExt))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &it.Entry)
+}
+
+func (c *Cache) writeMeta(it *item) error {
+	data, err := json.Marshal(&it.Entry)
+	if err != nil {
+		return err
+	}
+
+	return c.writeFile(c.path(it.name, metaExt), data)
+}
+
+// writeFile writes file atomically, so the broken file is not read after crash
+func (c *Cache) writeFile(path string, data []byte) error {
+	tmp := path + tmpExt
+	if err := ioutil.WriteFile(tmp, data, filePerm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (c *Cache) removeFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		c.log.Err(err).Msgf("failed to remove file %s", path)
+	}
+}
+
+func (c *Cache) removeFiles(name string) {
+	c.removeFile(c.path(name, metaExt))
+	c.removeFile(c.path(name, dataExt))
+	c.removeFile(c.path(name, bodyExt))
+}
+
+// ttl returns lifetime of data on disk, it is capped by own lifetime of data
+func (c *Cache) ttl(data cachedata.CacheData, now time.Time) time.Duration {
+	ttl := c.cfg.TTL
+	if data.GetStatusCode() >= http.StatusBadRequest {
+		ttl = c.cfg.TTLErr
+	}
+
+	return cachedata.CapTTL(data, ttl, now)
+}
+
+// Add writes data to disk, the previous data of key is replaced.
+// The body of cachedata.Streamable is written to own file, so it may be streamed by Stream.
+func (c *Cache) Add(key string, data cachedata.CacheData) error {
+	now := time.Now()
+	ttl := c.ttl(data, now)
+	if ttl <= 0 {
+		return nil
+	}
+
+	var (
+		head, body []byte
+		err        error
+	)
+	streamable, streamed := data.(cachedata.Streamable)
+	if streamed {
+		if head, err = streamable.MarshalHead(); err != nil {
+			return err
+		}
+
+		if body, err = streamable.StoredBody(); err != nil {
+			return err
+		}
+	} else if head, err = data.MarshalBinary(); err != nil {
+		return err
+	}
+
+	size := int64(len(head) + len(body))
+	if c.cfg.MaxBytes > 0 && size > c.cfg.MaxBytes {
+		c.log.Debug().Msgf("key %s is not added to disk cache, size %d is greater than maxbytes", key, size)
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	it := &item{
+		Entry: Entry{
+			Key:       key,
+			ExpiresAt: now.Add(ttl),
+			Size:      size,
+			Tags:      cachedata.TagsOf(data),
+			Streamed:  streamed,
+		},
+		name: fileName(key),
+	}
+
+	// The files of previous data are replaced by renaming, so the body which is streamed now
+	// is read to the end and the new readers don't find missing file
+	old, replaced := c.items[key]
+	if replaced {
+		it.URI = old.URI
+		it.Base, it.Vary = old.Base, old.Vary
+		c.order.Remove(old.elem)
+		c.bytes -= old.Size
+		delete(c.items, key)
+	}
+
+	// The room is freed before adding, so the new item is not evicted
+	c.evict(size)
+
+	// The body is written before data, so the data never points to missing body
+	if streamed {
+		if err := c.writeFile(c.path(it.name, bodyExt), body); err != nil {
+			c.removeFiles(it.name)
+			return err
+		}
+	}
+
+	if err := c.writeFile(c.path(it.name, dataExt), head); err != nil {
+		c.removeFiles(it.name)
+		return err
+	}
+
+	if err := c.writeMeta(it); err != nil {
+		c.removeFiles(it.name)
+		return err
+	}
+
+	if replaced && old.Streamed && !streamed {
+		c.removeFile(c.path(it.name, bodyExt))
+	}
+
+	it.elem = c.order.PushFront(key)
+	c.items[key] = it
+	c.bytes += size
+	c.log.Debug().Msgf("add key %s to disk cache", key)
+
+	return nil
+}
+
+// evict removes least recently used items until item with size fits in cache, it must be called under lock
+func (c *Cache) evict(size int64) {
+	for c.cfg.MaxBytes > 0 && c.bytes+size > c.cfg.MaxBytes {
+		e := c.order.Back()
+		if e == nil {
+			return
+		}
+
+		key := e.Value.(string)
+		c.removeLocked(key, true)
+		c.log.Debug().Msgf("evict %s from disk cache", key)
+	}
+}
+
+// Select reads data of key to data, it must be encoding.BinaryUnmarshaler
+func (c *Cache) Select(key string, data interface{}) error {
+	return c.read(key, data, true, false)
+}
+
+// Peek reads data of key to data like Select, but the data doesn't become recently used
+func (c *Cache) Peek(key string, data interface{}) error {
+	return c.read(key, data, false, false)
+}
+
+// Stream reads data of key to data like Select, but the body of cachedata.Streamable is not read,
+// it is streamed from file by data
+func (c *Cache) Stream(key string, data interface{}) error {
+	return c.read(key, data, true, true)
+}
+
+func (c *Cache) read(key string, data interface{}, touch, stream bool) error {
+	u, ok := data.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return errors.New("typecast to BinaryUnmarshaler failed")
+	}
+
+	c.mu.Lock()
+	it, ok := c.items[key]
+	if !ok {
+		c.mu.Unlock()
+		return cacheerrors.ErrNotFound
+	}
+
+	if !time.Now().Before(it.ExpiresAt) {
+		c.removeLocked(key, true)
+		c.mu.Unlock()
+		c.log.Debug().Msgf("remove expired from disk cache: %s", key)
+		return cacheerrors.ErrNotFound
+	}
+
+	if touch {
+		c.order.MoveToFront(it.elem)
+	}
+	c.mu.Unlock()
+
+	if err := c.readData(it, u, stream); err != nil {
+		// The file was removed or replaced, the item is forgotten
+		c.log.Err(err).Msgf("failed to read %s from disk cache", key)
+		_ = c.Delete(key)
+		return cacheerrors.ErrNotFound
+	}
+
+	c.log.Debug().Msgf("select %s from disk cache", key)
+
+	return nil
+}
+
+func (c *Cache) readData(it *item, u encoding.BinaryUnmarshaler, stream bool) error {
+	data, err := ioutil.ReadFile(c.path(it.name, dataExt))
+	if err != nil {
+		return err
+	}
+
+	if !it.Streamed {
+		return u.UnmarshalBinary(data)
+	}
+
+	s, ok := u.(cachedata.Streamable)
+	if !ok {
+		return errors.New("typecast to Streamable failed")
+	}
+
+	if err = s.UnmarshalHead(data, c.path(it.name, bodyExt)); err != nil {
+		return err
+	}
+
+	if stream {
+		return nil
+	}
+
+	return s.LoadBody()
+}
+
+// SizeOf returns size of data of key on disk
+func (c *Cache) SizeOf(key string) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	it, ok := c.items[key]
+	if !ok {
+		return 0, false
+	}
+
+	return it.Size, true
+}
+
+// SetURI saves request URI of response, so the response may be purged by URI after restart
+func (c *Cache) SetURI(key, uri string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	it, ok := c.items[key]
+	if !ok || it.URI == uri {
+		return nil
+	}
+
+	it.URI = uri
+
+	return c.writeMeta(it)
+}
+
+// SetVary sets base key and headers from Vary of response, so the variant of response is found after restart
+func (c *Cache) SetVary(key, base string, headers []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	it, ok := c.items[key]
+	if !ok {
+		return nil
+	}
+
+	it.Base, it.Vary = base, headers
+
+	return c.writeMeta(it)
+}
+
+// Has checks that key is on disk
+func (c *Cache) Has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.items[key]
+
+	return ok
+}
+
+// Entries returns entries of all responses on disk
+func (c *Cache) Entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make([]Entry, 0, len(c.items))
+	for _, it := range c.items {
+		result = append(result, it.Entry)
+	}
+
+	return result
+}
+
+// OnRemove sets func which is called after item is removed from cache by any reason
+func (c *Cache) OnRemove(f func(key string)) {
+	c.onRemove = f
+}
+
+func (c *Cache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeLocked(key, true)
+	c.log.Debug().Msgf("delete %s from disk cache", key)
+
+	return nil
+}
+
+// removeLocked removes item and its files, onRemove is not called for item which is replaced
+func (c *Cache) removeLocked(key string, notify bool) {
+	it, ok := c.items[key]
+	if !ok {
+		return
+	}
+
+	c.removeFiles(it.name)
+	c.order.Remove(it.elem)
+	c.bytes -= it.Size
+	delete(c.items, key)
+
+	if notify && c.onRemove != nil {
+		c.onRemove(key)
+	}
+}
+
+func (c *Cache) Size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.items)
+}
+
+// ClearCache removes expired items
+func (c *Cache) ClearCache() {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, it := range c.items {
+		if !now.Before(it.ExpiresAt) {
+			c.removeLocked(key, true)
+			c.log.Debug().Msgf("remove expired from disk cache: %s", key)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package disk
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soldatov-s/accp/internal/cache/errors"
+	"github.com/soldatov-s/accp/internal/logger"
+	"github.com/soldatov-s/accp/internal/meta"
+	"github.com/stretchr/testify/require"
+)
+
+type testCacheData struct {
+	Name       string
+	StatusCode int
+}
+
+func (d *testCacheData) MarshalBinary() ([]byte, error) {
+	return json.Marshal(d)
+}
+
+func (d *testCacheData) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, d)
+}
+
+func (d *testCacheData) GetStatusCode() int {
+	return d.StatusCode
+}
+
+// testStreamData keeps Body in own file on disk
+type testStreamData struct {
+	testCacheData
+	Body     string
+	bodyFile string
+}
+
+func (d *testStreamData) MarshalBinary() ([]byte, error) {
+	return json.Marshal(d)
+}
+
+func (d *testStreamData) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, d)
+}
+
+func (d *testStreamData) MarshalHead() ([]byte, error) {
+	return json.Marshal(&d.testCacheData)
+}
+
+func (d *testStreamData) StoredBody() ([]byte, error) {
+	return []byte(d.Body), nil
+}
+
+func (d *testStreamData) UnmarshalHead(data []byte, bodyFile string) error {
+	d.Body = ""
+	d.bodyFile = bodyFile
+	return json.Unmarshal(data, &d.testCacheData)
+}
+
+func (d *testStreamData) LoadBody() error {
+	body, err := ioutil.ReadFile(d.bodyFile)
+	if err != nil {
+		return err
+	}
+
+	d.Body = string(body)
+	d.bodyFile = ""
+
+	return nil
+}
+
+func initContext() context.Context {
+	ctx := meta.SetAppInfo(context.Background(), "accp", "", "", "", "test")
+	// Registrate logger
+	logCfg := &logger.Config{
+		Level:           logger.LoggerLevelDebug,
+		NoColoredOutput: true,
+		WithTrace:       false,
+	}
+
+	return logger.RegistrateAndInitilize(ctx, logCfg)
+}
+
+func initCache(t *testing.T, cfg *Config) *Cache {
+	c, err := NewCache(initContext(), cfg)
+	require.Nil(t, err)
+	require.NotNil(t, c)
+
+	return c
+}
+
+func TestAddSelect(t *testing.T) {
+	c := initCache(t, &Config{Path: t.TempDir()})
+
+	err := c.Add("key", &testCacheData{Name: "test", StatusCode: http.StatusOK})
+	require.Nil(t, err)
+	require.True(t, c.Has("key"))
+	require.Equal(t, 1, c.Size())
+
+	var result testCacheData
+	err = c.Select("key", &result)
+	require.Nil(t, err)
+	require.Equal(t, "test", result.Name)
+
+	// The data is replaced
+	err = c.Add("key", &testCacheData{Name: "replaced", StatusCode: http.StatusOK})
+	require.Nil(t, err)
+	err = c.Select("key", &result)
+	require.Nil(t, err)
+	require.Equal(t, "replaced", result.Name)
+	require.Equal(t, 1, c.Size())
+
+	err = c.Select("unknown", &result)
+	require.Equal(t, errors.ErrNotFound, err)
+}
+
+func TestDelete(t *testing.T) {
+	c := initCache(t, &Config{Path: t.TempDir()})
+
+	removed := make([]string, 0)
+	c.OnRemove(func(key string) { removed = append(removed, key) })
+
+	err := c.Add("key", &testCacheData{Name: "test", StatusCode: http.StatusOK})
+	require.Nil(t, err)
+
+	err = c.Delete("key")
+	require.Nil(t, err)
+	require.False(t, c.Has("key"))
+	require.Equal(t, []string{"key"}, removed)
+
+	files, err := ioutil.ReadDir(c.cfg.Path)
+	require.Nil(t, err)
+	require.Empty(t, files)
+}
+
+func TestTTL(t *testing.T) {
+	c := initCache(t, &Config{Path: t.TempDir(), TTL: time.Second, TTLErr: 500 * time.Millisecond})
+
+	err := c.Add("good", &testCacheData{Name: "good", StatusCode: http.StatusOK})
+	require.Nil(t, err)
+	err = c.Add("bad", &testCacheData{Name: "bad", StatusCode: http.StatusInternalServerError})
+	require.Nil(t, err)
+
+	time.Sleep(600 * time.Millisecond)
+
+	var result testCacheData
+	err = c.Select("bad", &result)
+	require.Equal(t, errors.ErrNotFound, err)
+	err = c.Select("good", &result)
+	require.Nil(t, err)
+
+	time.Sleep(500 * time.Millisecond)
+
+	c.ClearCache()
+	require.Equal(t, 0, c.Size())
+}
+
+func TestEviction(t *testing.T) {
+	data := &testCacheData{Name: "test", StatusCode: http.StatusOK}
+	body, err := data.MarshalBinary()
+	require.Nil(t, err)
+
+	c := initCache(t, &Config{Path: t.TempDir(), MaxBytes: int64(2 * len(body))})
+
+	err = c.Add("key1", data)
+	require.Nil(t, err)
+	err = c.Add("key2", data)
+	require.Nil(t, err)
+
+	// key1 is used, so key2 is evicted
+	var result testCacheData
+	err = c.Select("key1", &result)
+	require.Nil(t, err)
+
+	err = c.Add("key3", data)
+	require.Nil(t, err)
+	require.True(t, c.Has("key1"))
+	require.False(t, c.Has("key2"))
+	require.True(t, c.Has("key3"))
+
+	// The data greater than maxbytes is not added
+	err = c.Add("large", &testCacheData{Name: strings.Repeat("x", 2*len(body)), StatusCode: http.StatusOK})
+	require.Nil(t, err)
+	require.False(t, c.Has("large"))
+	require.Equal(t, 2, c.Size())
+}
+
+func TestReload(t *testing.T) {
+	cfg := &Config{Path: t.TempDir()}
+	c := initCache(t, cfg)
+
+	err := c.Add("key", &testCacheData{Name: "test", StatusCode: http.StatusOK})
+	require.Nil(t, err)
+	err = c.SetURI("key", "/api/v1/users/1")
+	require.Nil(t, err)
+	err = c.Add("expired", &testCacheData{Name: "expired", StatusCode: http.StatusOK})
+	require.Nil(t, err)
+	c.items["expired"].ExpiresAt = time.Now()
+	err = c.writeMeta(c.items["expired"])
+	require.Nil(t, err)
+
+	// Broken files are removed on start
+	err = ioutil.WriteFile(filepath.Join(cfg.Path, "broken"+metaExt), []byte("{"), filePerm)
+	require.Nil(t, err)
+
+	c = initCache(t, cfg)
+	require.Equal(t, 1, c.Size())
+
+	var result testCacheData
+	err = c.Select("key", &result)
+	require.Nil(t, err)
+	require.Equal(t, "test", result.Name)
+
+	entries := c.Entries()
+	require.Len(t, entries, 1)
+	require.Equal(t, "key", entries[0].Key)
+	require.Equal(t, "/api/v1/users/1", entries[0].URI)
+
+	files, err := ioutil.ReadDir(cfg.Path)
+	require.Nil(t, err)
+	require.Len(t, files, 2)
+}
+
+func TestStream(t *testing.T) {
+	cfg := &Config{Path: t.TempDir()}
+	c := initCache(t, cfg)
+
+	err := c.Add("key", &testStreamData{testCacheData: testCacheData{Name: "test", StatusCode: http.StatusOK}, Body: "large body"})
+	require.Nil(t, err)
+	size, ok := c.SizeOf("key")
+	require.True(t, ok)
+	require.Equal(t, int64(len(`{"Name":"test","StatusCode":200}`)+len("large body")), size)
+
+	// The body is not read, it is streamed from file
+	var result testStreamData
+	err = c.Stream("key", &result)
+	require.Nil(t, err)
+	require.Equal(t, "test", result.Name)
+	require.Empty(t, result.Body)
+	body, err := ioutil.ReadFile(result.bodyFile)
+	require.Nil(t, err)
+	require.Equal(t, "large body", string(body))
+
+	err = c.Select("key", &result)
+	require.Nil(t, err)
+	require.Equal(t, "large body", result.Body)
+	require.Empty(t, result.bodyFile)
+
+	// The body survives restart
+	c = initCache(t, cfg)
+	err = c.Peek("key", &result)
+	require.Nil(t, err)
+	require.Equal(t, "large body", result.Body)
+
+	// The body which is streamed is read to the end after replacing of data
+	err = c.Stream("key", &result)
+	require.Nil(t, err)
+	f, err := os.Open(result.bodyFile)
+	require.Nil(t, err)
+	defer f.Close()
+
+	err = c.Add("key", &testStreamData{testCacheData: testCacheData{Name: "new", StatusCode: http.StatusOK}, Body: "new body"})
+	require.Nil(t, err)
+	body, err = ioutil.ReadAll(f)
+	require.Nil(t, err)
+	require.Equal(t, "large body", string(body))
+
+	err = c.Select("key", &result)
+	require.Nil(t, err)
+	require.Equal(t, "new", result.Name)
+	require.Equal(t, "new body", result.Body)
+
+	// The body file isn't left if data is replaced by data without own body
+	err = c.Add("key", &testCacheData{Name: "plain", StatusCode: http.StatusOK})
+	require.Nil(t, err)
+	_, err = os.Stat(filepath.Join(cfg.Path, fileName("key")+bodyExt))
+	require.True(t, os.IsNotExist(err))
+
+	err = c.Delete("key")
+	require.Nil(t, err)
+	files, err := ioutil.ReadDir(cfg.Path)
+	require.Nil(t, err)
+	require.Empty(t, files)
+}
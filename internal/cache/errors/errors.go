@@ -3,5 +3,7 @@ package errors
 import "errors"
 
 var (
-	ErrNotFound = errors.New("not found in cache")
+	ErrNotFound        = errors.New("not found in cache")
+	ErrMissingClaim    = errors.New("claim of cache key is missing")
+	ErrUnknownEviction = errors.New("unknown eviction policy")
 )
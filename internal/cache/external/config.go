@@ -12,6 +12,9 @@ type Config struct {
 	KeyPrefix string
 	TTL       time.Duration
 	TTLErr    time.Duration
+	// Recent is a count of latest requests of cached responses which are kept for warm-up,
+	// zero disables keeping of requests
+	Recent int
 }
 
 func (c *Config) SetDefault() {
@@ -28,6 +31,14 @@ func (c *Config) SetDefault() {
 	}
 }
 
+// SetNamespace sets key prefix of namespace if key prefix is not set, so caches of different namespaces
+// don't share keys, indexes and events in the same redis
+func (c *Config) SetNamespace(namespace string) {
+	if c.KeyPrefix == "" {
+		c.KeyPrefix = defaultKeyPrefix + namespace + "_"
+	}
+}
+
 func (c *Config) Merge(target *Config) *Config {
 	if c == nil {
 		return target
@@ -37,6 +48,7 @@ func (c *Config) Merge(target *Config) *Config {
 		KeyPrefix: c.KeyPrefix,
 		TTL:       c.TTL,
 		TTLErr:    c.TTLErr,
+		Recent:    c.Recent,
 	}
 
 	if target == nil {
@@ -55,5 +67,9 @@ func (c *Config) Merge(target *Config) *Config {
 		result.TTLErr = target.TTLErr
 	}
 
+	if target.Recent > 0 {
+		result.Recent = target.Recent
+	}
+
 	return result
 }
@@ -15,6 +15,16 @@ func TestSetDefault(t *testing.T) {
 	require.Equal(t, defaultKeyPrefix, c.KeyPrefix)
 }
 
+func TestSetNamespace(t *testing.T) {
+	c := &Config{}
+	c.SetNamespace("tenant")
+	require.Equal(t, defaultKeyPrefix+"tenant_", c.KeyPrefix)
+
+	c = &Config{KeyPrefix: "own_"}
+	c.SetNamespace("tenant")
+	require.Equal(t, "own_", c.KeyPrefix)
+}
+
 func TestMerge(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -0,0 +1,60 @@
+package external
+
+import (
+	"encoding/json"
+)
+
+// eventsChannel is a channel of events about changes of cached items
+const eventsChannel = "events"
+
+type EventType string
+
+const (
+	// EventInvalidate says that item was deleted or replaced, the inmemory copy must be dropped
+	EventInvalidate EventType = "invalidate"
+	// EventRefresh says that item was refreshed, the inmemory copy must be replaced
+	EventRefresh EventType = "refresh"
+)
+
+// Event is a message about change of cached item for instances which hold it in memory
+type Event struct {
+	// Origin is an ID of cache which changed item, the cache ignores own events
+	Origin string    `json:"origin"`
+	Type   EventType `json:"type"`
+	Key    string    `json:"key"`
+}
+
+// PublishEvent publishes event to other instances
+func (c *Cache) PublishEvent(event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if err = c.ExternalStorage.Publish(c.cfg.KeyPrefix+eventsChannel, string(body)); err != nil {
+		return err
+	}
+
+	c.log.Debug().Msgf("publish %s event of key %s", event.Type, event.Key)
+
+	return nil
+}
+
+// SubscribeEvents registers handler of events published by other instances
+func (c *Cache) SubscribeEvents(handler func(event *Event)) error {
+	return c.ExternalStorage.Subscribe(c.cfg.KeyPrefix+eventsChannel, func(payload string) {
+		event := &Event{}
+		if err := json.Unmarshal([]byte(payload), event); err != nil {
+			c.log.Err(err).Msg("failed to decode event")
+			return
+		}
+
+		handler(event)
+	})
+}
+
+// OnEventsResubscribe registers handler which is called after subscription to events is restored
+// on reconnect, the events published while connection was lost are not received
+func (c *Cache) OnEventsResubscribe(handler func()) error {
+	return c.ExternalStorage.OnResubscribe(c.cfg.KeyPrefix+eventsChannel, handler)
+}
@@ -4,15 +4,32 @@ import (
 	"context"
 	"net/http"
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 	"github.com/soldatov-s/accp/internal/cache/cachedata"
 	"github.com/soldatov-s/accp/internal/cache/errors"
 	"github.com/soldatov-s/accp/internal/logger"
 )
 
+const (
+	// tagKeyPrefix is a prefix of key of set with keys of responses tagged by tag
+	tagKeyPrefix = "tag:"
+	// urlKeyPrefix is a prefix of key of set with keys of responses to request URI
+	urlKeyPrefix = "url:"
+	// urlsKey is a key of set with request URIs of cached responses
+	urlsKey = "urls"
+	// varyKeyPrefix is a prefix of key of set with headers from Vary of responses to request with base key
+	varyKeyPrefix = "vary:"
+	// recentKey is a key of sorted set with recent requests of cached responses, the score is a time of request
+	recentKey = "recent"
+	// lockKeyPrefix is a prefix of key of lock of response which is requested from backend
+	lockKeyPrefix = "lock:"
+)
+
 type empty struct{}
 
 type Storage interface {
@@ -27,6 +44,17 @@ type Storage interface {
 	LimitTTL(key string, ttl time.Duration) error
 	LimitCount(key string, num int) error
 	GetLimit(key string, value interface{}) error
+	SetAdd(key string, ttl time.Duration, members ...string) error
+	SetMembers(key string) ([]string, error)
+	SetRemove(key string, members ...string) error
+	SortedSetAdd(key string, score float64, member string, limit int) error
+	SortedSetMembers(key string, count int) ([]string, error)
+	Lock(key, token string, ttl time.Duration) (bool, error)
+	Unlock(key, token string) error
+	Delete(key string) error
+	Publish(channel, message string) error
+	Subscribe(channel string, handler func(payload string)) error
+	OnResubscribe(channel string, handler func()) error
 }
 
 type Cache struct {
@@ -55,11 +83,23 @@ func NewCache(ctx context.Context, cfg *Config, storage Storage) *Cache {
 	return c
 }
 
-func (c *Cache) Add(key string, data cachedata.CacheData) error {
+// KeyPrefix returns prefix of keys of cache
+func (c *Cache) KeyPrefix() string {
+	return c.cfg.KeyPrefix
+}
+
+// ttl returns TTL from config for data, it is capped by own lifetime of data
+func (c *Cache) ttl(data cachedata.CacheData) time.Duration {
 	ttl := c.cfg.TTL
 	if data.GetStatusCode() >= http.StatusBadRequest {
 		ttl = c.cfg.TTLErr
 	}
+
+	return cachedata.CapTTL(data, ttl, time.Now())
+}
+
+func (c *Cache) Add(key string, data cachedata.CacheData) error {
+	ttl := c.ttl(data)
 	err := c.ExternalStorage.Add(c.cfg.KeyPrefix+key, data, ttl)
 	if err != nil {
 		return err
@@ -93,10 +133,7 @@ func (c *Cache) Expire(key string) error {
 }
 
 func (c *Cache) Update(key string, data cachedata.CacheData) error {
-	ttl := c.cfg.TTL
-	if data.GetStatusCode() >= http.StatusBadRequest {
-		ttl = c.cfg.TTLErr
-	}
+	ttl := c.ttl(data)
 	err := c.ExternalStorage.Update(c.cfg.KeyPrefix+key, data, ttl)
 	if err != nil {
 		return err
@@ -196,3 +233,194 @@ func (c *Cache) GetLimit(key string, value interface{}) error {
 
 	return nil
 }
+
+// tagTTL returns TTL of set with keys of tagged responses, it is prolonged when tagged response
+// is added or updated
+func (c *Cache) tagTTL() time.Duration {
+	if c.cfg.TTLErr > c.cfg.TTL {
+		return c.cfg.TTLErr
+	}
+
+	return c.cfg.TTL
+}
+
+// AddTag adds key of response to set of tag
+func (c *Cache) AddTag(tag, key string) error {
+	err := c.ExternalStorage.SetAdd(c.cfg.KeyPrefix+tagKeyPrefix+tag, c.tagTTL(), key)
+	if err != nil {
+		return err
+	}
+
+	c.log.Debug().Msgf("add key %s to tag %s in external cache", key, tag)
+
+	return nil
+}
+
+// TagKeys returns keys of responses tagged by tag
+func (c *Cache) TagKeys(tag string) ([]string, error) {
+	keys, err := c.ExternalStorage.SetMembers(c.cfg.KeyPrefix + tagKeyPrefix + tag)
+	if err != nil {
+		return nil, err
+	}
+
+	c.log.Debug().Msgf("get keys of tag %s from external cache", tag)
+
+	return keys, nil
+}
+
+// DeleteTag deletes set of tag
+func (c *Cache) DeleteTag(tag string) error {
+	err := c.ExternalStorage.Delete(c.cfg.KeyPrefix + tagKeyPrefix + tag)
+	if err != nil {
+		return err
+	}
+
+	c.log.Debug().Msgf("delete tag %s from external cache", tag)
+
+	return nil
+}
+
+// SetVary replaces headers from Vary of responses to request with base key, the empty headers are deleted
+func (c *Cache) SetVary(baseKey string, headers []string) error {
+	key := c.cfg.KeyPrefix + varyKeyPrefix + baseKey
+	if err := c.ExternalStorage.Delete(key); err != nil {
+		return err
+	}
+
+	if len(headers) == 0 {
+		return nil
+	}
+
+	if err := c.ExternalStorage.SetAdd(key, c.tagTTL(), headers...); err != nil {
+		return err
+	}
+
+	c.log.Debug().Msgf("set vary of %s in external cache", baseKey)
+
+	return nil
+}
+
+// Vary returns sorted headers from Vary of responses to request with base key
+func (c *Cache) Vary(baseKey string) ([]string, error) {
+	headers, err := c.ExternalStorage.SetMembers(c.cfg.KeyPrefix + varyKeyPrefix + baseKey)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(headers)
+
+	return headers, nil
+}
+
+// AddURL adds key of response to set of request URI and adds request URI to set of URIs
+func (c *Cache) AddURL(uri, key string) error {
+	if err := c.ExternalStorage.SetAdd(c.cfg.KeyPrefix+urlKeyPrefix+uri, c.tagTTL(), key); err != nil {
+		return err
+	}
+
+	if err := c.ExternalStorage.SetAdd(c.cfg.KeyPrefix+urlsKey, c.tagTTL(), uri); err != nil {
+		return err
+	}
+
+	c.log.Debug().Msgf("add key %s to url %s in external cache", key, uri)
+
+	return nil
+}
+
+// URLs returns request URIs of cached responses
+func (c *Cache) URLs() ([]string, error) {
+	uris, err := c.ExternalStorage.SetMembers(c.cfg.KeyPrefix + urlsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	c.log.Debug().Msg("get urls from external cache")
+
+	return uris, nil
+}
+
+// URLKeys returns keys of responses to request URI
+func (c *Cache) URLKeys(uri string) ([]string, error) {
+	keys, err := c.ExternalStorage.SetMembers(c.cfg.KeyPrefix + urlKeyPrefix + uri)
+	if err != nil {
+		return nil, err
+	}
+
+	c.log.Debug().Msgf("get keys of url %s from external cache", uri)
+
+	return keys, nil
+}
+
+// DeleteURL deletes set of request URI and removes request URI from set of URIs
+func (c *Cache) DeleteURL(uri string) error {
+	if err := c.ExternalStorage.Delete(c.cfg.KeyPrefix + urlKeyPrefix + uri); err != nil {
+		return err
+	}
+
+	if err := c.ExternalStorage.SetRemove(c.cfg.KeyPrefix+urlsKey, uri); err != nil {
+		return err
+	}
+
+	c.log.Debug().Msgf("delete url %s from external cache", uri)
+
+	return nil
+}
+
+// AddRecent remembers request of cached response, only Recent latest requests from config are kept
+func (c *Cache) AddRecent(request string) error {
+	if c.cfg.Recent <= 0 {
+		return nil
+	}
+
+	score := float64(time.Now().UnixNano())
+	if err := c.ExternalStorage.SortedSetAdd(c.cfg.KeyPrefix+recentKey, score, request, c.cfg.Recent); err != nil {
+		return err
+	}
+
+	c.log.Debug().Msg("add recent request to external cache")
+
+	return nil
+}
+
+// Recent returns latest requests of cached responses, the latest request is first
+func (c *Cache) Recent() ([]string, error) {
+	if c.cfg.Recent <= 0 {
+		return nil, nil
+	}
+
+	requests, err := c.ExternalStorage.SortedSetMembers(c.cfg.KeyPrefix+recentKey, c.cfg.Recent)
+	if err != nil {
+		return nil, err
+	}
+
+	c.log.Debug().Msg("get recent requests from external cache")
+
+	return requests, nil
+}
+
+// Lock takes lock of key for ttl, it returns token of lock or empty token if lock is held by other owner
+func (c *Cache) Lock(key string, ttl time.Duration) (string, error) {
+	token := uuid.New().String()
+	ok, err := c.ExternalStorage.Lock(c.cfg.KeyPrefix+lockKeyPrefix+key, token, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return "", nil
+	}
+
+	c.log.Debug().Msgf("lock key %s in external cache", key)
+
+	return token, nil
+}
+
+// Unlock releases lock of key taken with token
+func (c *Cache) Unlock(key, token string) error {
+	if err := c.ExternalStorage.Unlock(c.cfg.KeyPrefix+lockKeyPrefix+key, token); err != nil {
+		return err
+	}
+
+	c.log.Debug().Msgf("unlock key %s in external cache", key)
+
+	return nil
+}
@@ -607,7 +607,7 @@ func TestGetLimit(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			tt.testFunc()
-			client.Conn.Client.Del(client.Conn.Context(), cfg.KeyPrefix+defaultKey)
+			client.Conn.Del(client.Conn.Context(), cfg.KeyPrefix+defaultKey)
 		})
 	}
 }
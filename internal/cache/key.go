@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	cacheerrors "github.com/soldatov-s/accp/internal/cache/errors"
+	"github.com/soldatov-s/accp/internal/httputils"
+	"github.com/soldatov-s/accp/internal/jsonpath"
+	"github.com/soldatov-s/accp/x/helper"
+)
+
+const (
+	// keyWildcard is a suffix of query param name which matches all params with prefix, e.g. utm_*
+	keyWildcard = "*"
+)
+
+// KeyConfig is a spec of cache key. By default cache key is a hash of request URI, method and body.
+type KeyConfig struct {
+	// QueryInclude are query params which go into the key, empty list means all params
+	QueryInclude helper.Arguments
+	// QueryExclude are query params which are ignored, "utm_*" matches all params with prefix utm_
+	QueryExclude helper.Arguments
+	// QuerySort sorts query params, so their order doesn't change the key
+	QuerySort bool
+	// Headers are request headers which go into the key
+	Headers helper.Arguments
+	// Cookies are request cookies which go into the key
+	Cookies helper.Arguments
+	// Claims are fields of introspection result which go into the key, e.g. sub for per-user caching
+	Claims helper.Arguments
+	// IgnoreBody are JSON paths of body fields which are ignored, e.g. $.meta.timestamp
+	IgnoreBody helper.Arguments
+}
+
+func (c *KeyConfig) Merge(target *KeyConfig) *KeyConfig {
+	if c == nil {
+		return target
+	}
+
+	result := &KeyConfig{
+		QueryInclude: c.QueryInclude,
+		QueryExclude: c.QueryExclude,
+		QuerySort:    c.QuerySort,
+		Headers:      c.Headers,
+		Cookies:      c.Cookies,
+		Claims:       c.Claims,
+		IgnoreBody:   c.IgnoreBody,
+	}
+
+	if target == nil {
+		return result
+	}
+
+	if len(target.QueryInclude) > 0 {
+		result.QueryInclude = target.QueryInclude
+	}
+
+	if len(target.QueryExclude) > 0 {
+		result.QueryExclude = target.QueryExclude
+	}
+
+	if target.QuerySort {
+		result.QuerySort = true
+	}
+
+	if len(target.Headers) > 0 {
+		result.Headers = target.Headers
+	}
+
+	if len(target.Cookies) > 0 {
+		result.Cookies = target.Cookies
+	}
+
+	if len(target.Claims) > 0 {
+		result.Claims = target.Claims
+	}
+
+	if len(target.IgnoreBody) > 0 {
+		result.IgnoreBody = target.IgnoreBody
+	}
+
+	return result
+}
+
+// HashRequest returns cache key of request, request body stays readable.
+// The key of nil spec is calculated by httputils.HashRequest.
+// ErrMissingClaim is returned if request has no introspection result or it has no configured claim,
+// such request must not be cached, otherwise the responses of different users share the key.
+func (c *KeyConfig) HashRequest(r *http.Request) (string, error) {
+	if c == nil {
+		return httputils.HashRequest(r)
+	}
+
+	body, err := c.body(r)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(r.Method + "\n" + r.URL.EscapedPath() + "?" + c.query(r.URL.RawQuery) + "\n")
+
+	for _, name := range c.Headers {
+		b.WriteString("header:" + http.CanonicalHeaderKey(name) + "=" + strings.Join(r.Header.Values(name), ",") + "\n")
+	}
+
+	for _, name := range c.Cookies {
+		value := ""
+		if cookie, errCookie := r.Cookie(name); errCookie == nil {
+			value = cookie.Value
+		}
+		b.WriteString("cookie:" + name + "=" + value + "\n")
+	}
+
+	if len(c.Claims) > 0 {
+		content := httputils.GetIntrospection(r)
+		if len(content) == 0 {
+			return "", cacheerrors.ErrMissingClaim
+		}
+
+		claims, errDecode := jsonpath.Decode(content)
+		if errDecode != nil {
+			return "", errDecode
+		}
+
+		for _, path := range c.Claims {
+			v, errGet := jsonpath.Get(claims, jsonpath.Split(path))
+			if errGet != nil || v == nil {
+				return "", errors.Wrap(cacheerrors.ErrMissingClaim, path)
+			}
+			b.WriteString("claim:" + path + "=" + fmt.Sprint(v) + "\n")
+		}
+	}
+
+	b.Write(body)
+
+	sum := sha256.Sum256([]byte(b.String()))
+
+	return base64.URLEncoding.EncodeToString(sum[:]), nil
+}
+
+func (c *KeyConfig) queryParamMatches(name string) bool {
+	for _, v := range c.QueryExclude {
+		if v == name || (strings.HasSuffix(v, keyWildcard) && strings.HasPrefix(name, strings.TrimSuffix(v, keyWildcard))) {
+			return false
+		}
+	}
+
+	if len(c.QueryInclude) == 0 {
+		return true
+	}
+
+	for _, v := range c.QueryInclude {
+		if v == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// query returns filtered query params in original or sorted order
+func (c *KeyConfig) query(rawQuery string) string {
+	params := make([]string, 0)
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+
+		name := param
+		if i := strings.Index(param, "="); i >= 0 {
+			name = param[:i]
+		}
+
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+
+		if c.queryParamMatches(name) {
+			params = append(params, param)
+		}
+	}
+
+	if c.QuerySort {
+		sort.Strings(params)
+	}
+
+	return strings.Join(params, "&")
+}
+
+// body returns body of request, the ignored fields are removed from JSON body
+func (c *KeyConfig) body(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if len(c.IgnoreBody) == 0 {
+		return body, nil
+	}
+
+	// Not JSON body goes into the key as is
+	data, errJSON := jsonpath.Decode(body)
+	if errJSON != nil {
+		return body, nil
+	}
+
+	for _, path := range c.IgnoreBody {
+		jsonpath.Delete(data, jsonpath.Split(path))
+	}
+
+	// Keys of JSON objects are sorted by marshaling, so their order doesn't change the key
+	return json.Marshal(data)
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cacheerrors "github.com/soldatov-s/accp/internal/cache/errors"
+	"github.com/soldatov-s/accp/internal/httputils"
+	"github.com/stretchr/testify/require"
+)
+
+const testKeyURL = "http://localhost/api/v1/users"
+
+func hashKey(t *testing.T, c *KeyConfig, r *http.Request) string {
+	hk, err := c.HashRequest(r)
+	require.Nil(t, err)
+	return hk
+}
+
+func TestKeyConfigNil(t *testing.T) {
+	var c *KeyConfig
+	r := httptest.NewRequest(http.MethodPost, testKeyURL+"?a=1", bytes.NewBufferString("body"))
+
+	hk, err := httputils.HashRequest(r)
+	require.Nil(t, err)
+	require.Equal(t, hk, hashKey(t, c, r))
+}
+
+func TestKeyConfigQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    *KeyConfig
+		query1 string
+		query2 string
+		equal  bool
+	}{
+		{
+			name:   "order of params matters without sort",
+			cfg:    &KeyConfig{},
+			query1: "a=1&b=2",
+			query2: "b=2&a=1",
+			equal:  false,
+		},
+		{
+			name:   "order of params doesn't matter with sort",
+			cfg:    &KeyConfig{QuerySort: true},
+			query1: "a=1&b=2",
+			query2: "b=2&a=1",
+			equal:  true,
+		},
+		{
+			name:   "excluded params are ignored",
+			cfg:    &KeyConfig{QueryExclude: []string{"utm_*", "ts"}},
+			query1: "a=1&utm_source=x&ts=1",
+			query2: "a=1&utm_medium=y&ts=2",
+			equal:  true,
+		},
+		{
+			name:   "not excluded params are not ignored",
+			cfg:    &KeyConfig{QueryExclude: []string{"utm_*"}},
+			query1: "a=1",
+			query2: "a=2",
+			equal:  false,
+		},
+		{
+			name:   "only included params matter",
+			cfg:    &KeyConfig{QueryInclude: []string{"a"}},
+			query1: "a=1&b=1",
+			query2: "b=2&a=1",
+			equal:  true,
+		},
+		{
+			name:   "included params matter",
+			cfg:    &KeyConfig{QueryInclude: []string{"a"}},
+			query1: "a=1&b=1",
+			query2: "a=2&b=1",
+			equal:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			hk1 := hashKey(t, tt.cfg, httptest.NewRequest(http.MethodGet, testKeyURL+"?"+tt.query1, nil))
+			hk2 := hashKey(t, tt.cfg, httptest.NewRequest(http.MethodGet, testKeyURL+"?"+tt.query2, nil))
+			require.Equal(t, tt.equal, hk1 == hk2)
+		})
+	}
+}
+
+func TestKeyConfigHeadersAndCookies(t *testing.T) {
+	c := &KeyConfig{Headers: []string{"accept-language"}, Cookies: []string{"region"}}
+
+	newRequest := func(lang, region string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, testKeyURL, nil)
+		r.Header.Set("Accept-Language", lang)
+		r.Header.Set("X-Request-ID", lang+region)
+		r.AddCookie(&http.Cookie{Name: "region", Value: region})
+		return r
+	}
+
+	hk := hashKey(t, c, newRequest("en", "eu"))
+	require.Equal(t, hk, hashKey(t, c, newRequest("en", "eu")))
+	require.NotEqual(t, hk, hashKey(t, c, newRequest("ru", "eu")))
+	require.NotEqual(t, hk, hashKey(t, c, newRequest("en", "us")))
+}
+
+func TestKeyConfigClaims(t *testing.T) {
+	c := &KeyConfig{Claims: []string{"sub", "$.ext.tenant"}}
+
+	newRequest := func(introspection string) *http.Request {
+		return httputils.WithIntrospection(httptest.NewRequest(http.MethodGet, testKeyURL, nil), []byte(introspection))
+	}
+
+	hk := hashKey(t, c, newRequest(`{"active":true,"sub":"user1","ext":{"tenant":"t1"}}`))
+	require.Equal(t, hk, hashKey(t, c, newRequest(`{"active":true,"sub":"user1","ext":{"tenant":"t1"},"scope":"read"}`)))
+	require.NotEqual(t, hk, hashKey(t, c, newRequest(`{"active":true,"sub":"user2","ext":{"tenant":"t1"}}`)))
+	require.NotEqual(t, hk, hashKey(t, c, newRequest(`{"active":true,"sub":"user1","ext":{"tenant":"t2"}}`)))
+
+	// The numeric claims are compared exactly
+	require.NotEqual(t,
+		hashKey(t, c, newRequest(`{"sub":9007199254740993,"ext":{"tenant":"t1"}}`)),
+		hashKey(t, c, newRequest(`{"sub":9007199254740992,"ext":{"tenant":"t1"}}`)))
+
+	// The request without introspection or claim isn't hashed to the shared key
+	_, err := c.HashRequest(httptest.NewRequest(http.MethodGet, testKeyURL, nil))
+	require.True(t, errors.Is(err, cacheerrors.ErrMissingClaim))
+
+	_, err = c.HashRequest(newRequest(`{"active":true,"sub":"user1"}`))
+	require.True(t, errors.Is(err, cacheerrors.ErrMissingClaim))
+
+	_, err = c.HashRequest(newRequest("not json"))
+	require.NotNil(t, err)
+}
+
+func TestKeyConfigIgnoreBody(t *testing.T) {
+	c := &KeyConfig{IgnoreBody: []string{"$.meta.timestamp", "nonce"}}
+
+	newRequest := func(body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, testKeyURL, bytes.NewBufferString(body))
+	}
+
+	hk := hashKey(t, c, newRequest(`{"id":1,"nonce":"a","meta":{"timestamp":1,"lang":"en"}}`))
+	require.Equal(t, hk, hashKey(t, c, newRequest(`{"meta":{"lang":"en","timestamp":2},"nonce":"b","id":1}`)))
+	require.NotEqual(t, hk, hashKey(t, c, newRequest(`{"id":2,"nonce":"a","meta":{"timestamp":1,"lang":"en"}}`)))
+
+	// The big integers aren't rounded
+	require.NotEqual(t, hashKey(t, c, newRequest(`{"id":9007199254740993}`)), hashKey(t, c, newRequest(`{"id":9007199254740992}`)))
+
+	// Not JSON body goes into the key as is
+	require.NotEqual(t, hashKey(t, c, newRequest("text1")), hashKey(t, c, newRequest("text2")))
+
+	// The body stays readable
+	body := `{"id":1,"nonce":"a"}`
+	r := newRequest(body)
+	_ = hashKey(t, c, r)
+	data, err := ioutil.ReadAll(r.Body)
+	require.Nil(t, err)
+	require.Equal(t, body, string(data))
+}
@@ -1,15 +1,31 @@
 package memory
 
-import "time"
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	cacheerrors "github.com/soldatov-s/accp/internal/cache/errors"
+)
 
 const (
 	defaultTTL    = 10 * time.Second
 	defaultTTLErr = 5 * time.Second
+
+	// EvictionLRU evicts least recently used response from full cache
+	EvictionLRU = "lru"
+	// EvictionLFU evicts least frequently used response from full cache
+	EvictionLFU = "lfu"
 )
 
 type Config struct {
 	TTL    time.Duration
 	TTLErr time.Duration
+	// MaxEntries is a max count of responses in cache, zero means unlimited
+	MaxEntries int
+	// MaxBytes is a max size of responses in cache, zero means unlimited
+	MaxBytes int64
+	// Eviction is a policy of eviction from full cache: lru or lfu, default lru
+	Eviction string
 }
 
 func (c *Config) SetDefault() {
@@ -20,6 +36,25 @@ func (c *Config) SetDefault() {
 	if c.TTLErr == 0 {
 		c.TTLErr = defaultTTLErr
 	}
+
+	if c.Eviction == "" {
+		c.Eviction = EvictionLRU
+	}
+}
+
+// Validate checks that eviction policy is known
+func (c *Config) Validate() error {
+	switch c.Eviction {
+	case "", EvictionLRU, EvictionLFU:
+		return nil
+	default:
+		return errors.Wrap(cacheerrors.ErrUnknownEviction, c.Eviction)
+	}
+}
+
+// Bounded checks that cache has limits
+func (c *Config) Bounded() bool {
+	return c.MaxEntries > 0 || c.MaxBytes > 0
 }
 
 func (c *Config) Merge(target *Config) *Config {
@@ -28,8 +63,11 @@ func (c *Config) Merge(target *Config) *Config {
 	}
 
 	result := &Config{
-		TTL:    c.TTL,
-		TTLErr: c.TTLErr,
+		TTL:        c.TTL,
+		TTLErr:     c.TTLErr,
+		MaxEntries: c.MaxEntries,
+		MaxBytes:   c.MaxBytes,
+		Eviction:   c.Eviction,
 	}
 
 	if target == nil {
@@ -44,5 +82,17 @@ func (c *Config) Merge(target *Config) *Config {
 		result.TTLErr = target.TTLErr
 	}
 
+	if target.MaxEntries > 0 {
+		result.MaxEntries = target.MaxEntries
+	}
+
+	if target.MaxBytes > 0 {
+		result.MaxBytes = target.MaxBytes
+	}
+
+	if target.Eviction != "" {
+		result.Eviction = target.Eviction
+	}
+
 	return result
 }
@@ -1,9 +1,11 @@
 package memory
 
 import (
+	"errors"
 	"testing"
 	"time"
 
+	cacheerrors "github.com/soldatov-s/accp/internal/cache/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -12,6 +14,16 @@ func TestSetDefault(t *testing.T) {
 	c.SetDefault()
 	require.Equal(t, defaultTTL, c.TTL)
 	require.Equal(t, defaultTTLErr, c.TTLErr)
+	require.Equal(t, EvictionLRU, c.Eviction)
+	require.False(t, c.Bounded())
+}
+
+func TestValidate(t *testing.T) {
+	for _, v := range []string{"", EvictionLRU, EvictionLFU} {
+		require.Nil(t, (&Config{Eviction: v}).Validate())
+	}
+
+	require.True(t, errors.Is((&Config{Eviction: "lfru"}).Validate(), cacheerrors.ErrUnknownEviction))
 }
 
 func TestMerge(t *testing.T) {
@@ -39,6 +51,12 @@ func TestMerge(t *testing.T) {
 			targetConfig:   &Config{TTL: 5 * time.Second, TTLErr: 10 * time.Second},
 			expectedConfig: &Config{TTL: 5 * time.Second, TTLErr: 10 * time.Second},
 		},
+		{
+			name:           "target with limits",
+			srcConfig:      &Config{TTL: 1 * time.Second, MaxEntries: 10, Eviction: EvictionLRU},
+			targetConfig:   &Config{MaxBytes: 1024, Eviction: EvictionLFU},
+			expectedConfig: &Config{TTL: 1 * time.Second, MaxEntries: 10, MaxBytes: 1024, Eviction: EvictionLFU},
+		},
 	}
 
 	for _, tt := range tests {
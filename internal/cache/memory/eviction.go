@@ -0,0 +1,166 @@
+package memory
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// evictionPolicy selects the key which is evicted from full cache
+type evictionPolicy interface {
+	// add adds new key
+	add(key string)
+	// touch marks access to key
+	touch(key string)
+	// remove removes key
+	remove(key string)
+	// victim returns key which must be evicted first
+	victim() (string, bool)
+}
+
+func newEvictionPolicy(name string) evictionPolicy {
+	if name == EvictionLFU {
+		return newLFU()
+	}
+
+	return newLRU()
+}
+
+// lru evicts least recently used key
+type lru struct {
+	// order has most recently used key in front
+	order *list.List
+	items map[string]*list.Element
+}
+
+func newLRU() *lru {
+	return &lru{
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (p *lru) add(key string) {
+	if _, ok := p.items[key]; ok {
+		p.touch(key)
+		return
+	}
+
+	p.items[key] = p.order.PushFront(key)
+}
+
+func (p *lru) touch(key string) {
+	if e, ok := p.items[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *lru) remove(key string) {
+	if e, ok := p.items[key]; ok {
+		p.order.Remove(e)
+		delete(p.items, key)
+	}
+}
+
+func (p *lru) victim() (string, bool) {
+	e := p.order.Back()
+	if e == nil {
+		return "", false
+	}
+
+	return e.Value.(string), true
+}
+
+type lfuItem struct {
+	key   string
+	freq  uint64
+	tick  uint64
+	index int
+}
+
+// lfuHeap has least frequently used item on top, the least recently used item is on top
+// among items with equal frequency
+type lfuHeap []*lfuItem
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq == h[j].freq {
+		return h[i].tick < h[j].tick
+	}
+
+	return h[i].freq < h[j].freq
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	item := x.(*lfuItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+
+	return item
+}
+
+// lfu evicts least frequently used key
+type lfu struct {
+	heap  lfuHeap
+	items map[string]*lfuItem
+	tick  uint64
+}
+
+func newLFU() *lfu {
+	return &lfu{
+		items: make(map[string]*lfuItem),
+	}
+}
+
+func (p *lfu) add(key string) {
+	if _, ok := p.items[key]; ok {
+		p.touch(key)
+		return
+	}
+
+	p.tick++
+	item := &lfuItem{key: key, freq: 1, tick: p.tick}
+	p.items[key] = item
+	heap.Push(&p.heap, item)
+}
+
+func (p *lfu) touch(key string) {
+	item, ok := p.items[key]
+	if !ok {
+		return
+	}
+
+	p.tick++
+	item.freq++
+	item.tick = p.tick
+	heap.Fix(&p.heap, item.index)
+}
+
+func (p *lfu) remove(key string) {
+	if item, ok := p.items[key]; ok {
+		heap.Remove(&p.heap, item.index)
+		delete(p.items, key)
+	}
+}
+
+func (p *lfu) victim() (string, bool) {
+	if len(p.heap) == 0 {
+		return "", false
+	}
+
+	return p.heap[0].key, true
+}
@@ -6,10 +6,29 @@ import (
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
+	"github.com/soldatov-s/accp/internal/admin"
 	"github.com/soldatov-s/accp/internal/cache/cachedata"
 	"github.com/soldatov-s/accp/internal/cache/errors"
 	"github.com/soldatov-s/accp/internal/logger"
+	"github.com/soldatov-s/accp/internal/metrics"
+)
+
+const (
+	evictionsMetricName = "memory_cache_evictions_total"
+
+	evictionReasonMaxEntries = "maxentries"
+	evictionReasonMaxBytes   = "maxbytes"
+)
+
+var (
+	evictionsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: evictionsMetricName,
+			Help: "count of responses evicted from full inmemory cache",
+		}, []string{"reason"})
+	registerMetricOnce sync.Once
 )
 
 type empty struct{}
@@ -21,6 +40,13 @@ type Cache struct {
 	clearTimer    *time.Timer
 	clearErrTimer *time.Timer
 	storage       sync.Map
+	// mu guards eviction, sizes and bytes, they are used only if cache is bounded
+	mu       sync.Mutex
+	eviction evictionPolicy
+	sizes    map[string]int64
+	bytes    int64
+	// onRemove is called after item is removed from cache
+	onRemove func(key string)
 }
 
 func NewCache(ctx context.Context, cfg *Config) *Cache {
@@ -40,40 +66,227 @@ func NewCache(ctx context.Context, cfg *Config) *Cache {
 		c.clearErrTimer = time.AfterFunc(c.cfg.TTLErr, c.ClearErrCache)
 	}
 
+	if c.cfg.Bounded() {
+		c.eviction = newEvictionPolicy(c.cfg.Eviction)
+		c.sizes = make(map[string]int64)
+		if err := registerMetric(ctx); err != nil {
+			c.log.Err(err).Msg("failed to register metric of evictions")
+		}
+	}
+
 	c.log.Info().Msg("created inmemory cache")
 
 	return c
 }
 
+// registerMetric registers metric of evictions in admin, the metric is common for all caches
+func registerMetric(ctx context.Context) error {
+	a := admin.Get(ctx)
+	if a == nil {
+		return nil
+	}
+
+	var err error
+	registerMetricOnce.Do(func() {
+		err = a.RegisterMetric(evictionsMetricName, &metrics.MetricOptions{Metric: evictionsMetric})
+	})
+
+	return err
+}
+
 func (c *Cache) Add(key string, data interface{}) error {
-	if _, ok := c.storage.Load(key); !ok {
-		c.storage.Store(key, &cachedata.CacheItem{
-			Data:      data,
-			TimeStamp: time.Now().UTC(),
-		})
+	item := &cachedata.CacheItem{
+		Data:      data,
+		TimeStamp: time.Now().UTC(),
+	}
+
+	if !c.cfg.Bounded() {
+		if _, loaded := c.storage.LoadOrStore(key, item); !loaded {
+			c.log.Debug().Msgf("add key %s to cache", key)
+		}
+		return nil
+	}
+
+	size := cachedata.SizeOf(data)
+	if c.cfg.MaxBytes > 0 && size > c.cfg.MaxBytes {
+		c.log.Debug().Msgf("key %s is not added to cache, size %d is greater than maxbytes", key, size)
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-		c.log.Debug().Msgf("add key %s to cache", key)
+	if _, ok := c.sizes[key]; ok {
+		return nil
 	}
+
+	// The room is freed before adding, otherwise LFU evicts the new item
+	c.evict(1, size)
+
+	c.storage.Store(key, item)
+	c.eviction.add(key)
+	c.sizes[key] = size
+	c.bytes += size
+	c.log.Debug().Msgf("add key %s to cache", key)
+
 	return nil
 }
 
+// Update replaces data of item which is in cache, the size of item is accounted again and the items
+// are evicted if cache became full. The item which is not in cache is not added.
+func (c *Cache) Update(key string, data interface{}) error {
+	if !c.cfg.Bounded() {
+		if v, ok := c.storage.Load(key); ok {
+			c.storage.Store(key, &cachedata.CacheItem{Data: data, TimeStamp: v.(*cachedata.CacheItem).TimeStamp})
+		}
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.storage.Load(key)
+	if !ok {
+		return nil
+	}
+
+	size := cachedata.SizeOf(data)
+	if c.cfg.MaxBytes > 0 && size > c.cfg.MaxBytes {
+		c.removeLocked(key)
+		c.log.Debug().Msgf("key %s is removed from cache, size %d is greater than maxbytes", key, size)
+		return nil
+	}
+
+	c.storage.Store(key, &cachedata.CacheItem{Data: data, TimeStamp: v.(*cachedata.CacheItem).TimeStamp})
+	c.bytes += size - c.sizes[key]
+	c.sizes[key] = size
+	c.evict(0, 0)
+	c.log.Debug().Msgf("update key %s in cache", key)
+
+	return nil
+}
+
+// evict removes items from cache until count of items with size fit in it, it must be called under lock
+func (c *Cache) evict(count int, size int64) {
+	for {
+		var reason string
+		switch {
+		case c.cfg.MaxEntries > 0 && len(c.sizes)+count > c.cfg.MaxEntries:
+			reason = evictionReasonMaxEntries
+		case c.cfg.MaxBytes > 0 && c.bytes+size > c.cfg.MaxBytes:
+			reason = evictionReasonMaxBytes
+		default:
+			return
+		}
+
+		key, ok := c.eviction.victim()
+		if !ok {
+			return
+		}
+
+		c.removeLocked(key)
+		evictionsMetric.WithLabelValues(reason).Inc()
+		c.log.Debug().Msgf("evict %s from cache by %s", key, reason)
+	}
+}
+
+// OnRemove sets func which is called after item is removed from cache by any reason
+func (c *Cache) OnRemove(f func(key string)) {
+	c.onRemove = f
+}
+
+// remove removes item from storage and from eviction index
+func (c *Cache) remove(key string) {
+	if !c.cfg.Bounded() {
+		c.storage.Delete(key)
+		c.removed(key)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeLocked(key)
+}
+
+func (c *Cache) removeLocked(key string) {
+	c.storage.Delete(key)
+	c.eviction.remove(key)
+	c.bytes -= c.sizes[key]
+	delete(c.sizes, key)
+	c.removed(key)
+}
+
+func (c *Cache) removed(key string) {
+	if c.onRemove != nil {
+		c.onRemove(key)
+	}
+}
+
+// touch marks access to item for eviction policy
+func (c *Cache) touch(key string) {
+	if !c.cfg.Bounded() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.eviction.touch(key)
+}
+
 func (c *Cache) Select(key string) (interface{}, error) {
 	if v, ok := c.storage.Load(key); ok {
 		c.log.Debug().Msgf("select %s from inmemory cache", key)
 		cacheItem := v.(*cachedata.CacheItem)
+		// data with own lifetime is removed after expiration regardless of access to it
+		if cachedata.Expired(cacheItem.Data, time.Now()) {
+			c.remove(key)
+			c.log.Debug().Msgf("remove expired from cache: %s", key)
+			return nil, errors.ErrNotFound
+		}
+
 		cacheData := cacheItem.Data.(cachedata.CacheData)
 		// expire only good status code
 		if cacheData.GetStatusCode() < http.StatusBadRequest {
 			cacheItem.TimeStamp = time.Now()
 		}
+		c.touch(key)
+
 		return cacheItem.Data, nil
 	}
 
 	return nil, errors.ErrNotFound
 }
 
+// Peek returns data by key without prolongation of its lifetime and without marking it as used
+func (c *Cache) Peek(key string) (interface{}, error) {
+	v, ok := c.storage.Load(key)
+	if !ok {
+		return nil, errors.ErrNotFound
+	}
+
+	cacheItem := v.(*cachedata.CacheItem)
+	if cachedata.Expired(cacheItem.Data, time.Now()) {
+		return nil, errors.ErrNotFound
+	}
+
+	return cacheItem.Data, nil
+}
+
+// Has checks that key is in cache
+func (c *Cache) Has(key string) bool {
+	_, ok := c.storage.Load(key)
+	return ok
+}
+
+// Fits checks that data of size is not too large for cache
+func (c *Cache) Fits(size int64) bool {
+	return c.cfg.MaxBytes <= 0 || size <= c.cfg.MaxBytes
+}
+
 func (c *Cache) Delete(key string) error {
-	c.storage.Delete(key)
+	c.remove(key)
 
 	c.log.Debug().Msgf("delete %s from inmemory cache", key)
 	return nil
@@ -97,8 +310,9 @@ func (c *Cache) clear(k, v interface{}, timeNow time.Time) bool {
 	cacheItem := v.(*cachedata.CacheItem)
 	cacheData := cacheItem.Data.(cachedata.CacheData)
 	if (cacheData.GetStatusCode() < http.StatusBadRequest && timeNow.Sub(cacheItem.TimeStamp) > c.cfg.TTL) ||
-		(cacheData.GetStatusCode() >= http.StatusBadRequest && timeNow.Sub(cacheItem.TimeStamp) > c.cfg.TTLErr) {
-		c.storage.Delete(k)
+		(cacheData.GetStatusCode() >= http.StatusBadRequest && timeNow.Sub(cacheItem.TimeStamp) > c.cfg.TTLErr) ||
+		cachedata.Expired(cacheData, timeNow) {
+		c.remove(k.(string))
 		c.log.Debug().Msgf("remove expired from cache: %s", k)
 	}
 
@@ -3,10 +3,13 @@ package memory
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/soldatov-s/accp/internal/cache/cachedata"
+	"github.com/soldatov-s/accp/internal/cache/errors"
 	"github.com/soldatov-s/accp/internal/logger"
 	"github.com/soldatov-s/accp/internal/meta"
 	"github.com/stretchr/testify/require"
@@ -95,6 +98,25 @@ func TestSelect(t *testing.T) {
 	require.Equal(t, tesdData, item)
 }
 
+func TestPeek(t *testing.T) {
+	c := initCache(t)
+
+	tesdData := &testCacheData{Name: "test data", StatusCode: 200}
+
+	_ = c.Add("test", tesdData)
+	v, _ := c.storage.Load("test")
+	timeStamp := v.(*cachedata.CacheItem).TimeStamp
+
+	item, err := c.Peek("test")
+	require.Nil(t, err)
+	require.Equal(t, tesdData, item)
+	// The lifetime is not prolonged
+	require.Equal(t, timeStamp, v.(*cachedata.CacheItem).TimeStamp)
+
+	_, err = c.Peek("unknown")
+	require.Equal(t, errors.ErrNotFound, err)
+}
+
 func TestDelete(t *testing.T) {
 	c := initCache(t)
 
@@ -176,3 +198,168 @@ func TestClearErrCache(t *testing.T) {
 		})
 	}
 }
+
+type testExpirableData struct {
+	testCacheData
+	expiresAt time.Time
+}
+
+func (d *testExpirableData) ExpiresAt() time.Time {
+	return d.expiresAt
+}
+
+func TestSelectExpirable(t *testing.T) {
+	c := initCache(t)
+
+	data := &testExpirableData{
+		testCacheData: testCacheData{Name: "test", StatusCode: 200},
+		expiresAt:     time.Now().Add(100 * time.Millisecond),
+	}
+	require.Nil(t, c.Add("expirable", data))
+
+	_, err := c.Select("expirable")
+	require.Nil(t, err)
+
+	// Access to data doesn't prolong own lifetime of data
+	time.Sleep(150 * time.Millisecond)
+	_, err = c.Select("expirable")
+	require.Equal(t, errors.ErrNotFound, err)
+	require.Equal(t, 0, c.Size())
+}
+
+func initBoundedCache(t *testing.T, cfg *Config) *Cache {
+	ctx := initLogger(initApp(context.Background()))
+	c := NewCache(ctx, cfg)
+	require.NotNil(t, c)
+
+	return c
+}
+
+func TestEvictionMaxEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		eviction string
+		// evicted is a key which is evicted after access to a, a, b
+		evicted string
+	}{
+		{
+			name:     "lru",
+			eviction: EvictionLRU,
+			evicted:  "a",
+		},
+		{
+			name:     "lfu",
+			eviction: EvictionLFU,
+			evicted:  "b",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := initBoundedCache(t, &Config{MaxEntries: 2, Eviction: tt.eviction})
+			before := testutil.ToFloat64(evictionsMetric.WithLabelValues(evictionReasonMaxEntries))
+
+			require.Nil(t, c.Add("a", &testCacheData{Name: "a", StatusCode: 200}))
+			require.Nil(t, c.Add("b", &testCacheData{Name: "b", StatusCode: 200}))
+			for _, key := range []string{"a", "a", "b"} {
+				_, err := c.Select(key)
+				require.Nil(t, err)
+			}
+
+			require.Nil(t, c.Add("c", &testCacheData{Name: "c", StatusCode: 200}))
+			require.Equal(t, 2, c.Size())
+			_, err := c.Select(tt.evicted)
+			require.Equal(t, errors.ErrNotFound, err)
+			_, err = c.Select("c")
+			require.Nil(t, err)
+			require.Equal(t, before+1, testutil.ToFloat64(evictionsMetric.WithLabelValues(evictionReasonMaxEntries)))
+		})
+	}
+}
+
+func TestEvictionMaxBytes(t *testing.T) {
+	data := &testCacheData{Name: "data", StatusCode: 200}
+	size := cachedata.SizeOf(data)
+	c := initBoundedCache(t, &Config{MaxBytes: 2 * size})
+	before := testutil.ToFloat64(evictionsMetric.WithLabelValues(evictionReasonMaxBytes))
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.Nil(t, c.Add(key, &testCacheData{Name: "data", StatusCode: 200}))
+	}
+	require.Equal(t, 2, c.Size())
+	require.Equal(t, 2*size, c.bytes)
+	require.Equal(t, before+1, testutil.ToFloat64(evictionsMetric.WithLabelValues(evictionReasonMaxBytes)))
+
+	// Deleted item frees space
+	require.Nil(t, c.Delete("b"))
+	require.Equal(t, size, c.bytes)
+
+	// Item which is larger than cache is not added
+	require.Nil(t, c.Add("large", &testCacheData{Name: strings.Repeat("x", int(2*size)), StatusCode: 200}))
+	_, err := c.Select("large")
+	require.Equal(t, errors.ErrNotFound, err)
+	require.Equal(t, 1, c.Size())
+}
+
+func TestUpdate(t *testing.T) {
+	data := &testCacheData{Name: "data", StatusCode: 200}
+	size := cachedata.SizeOf(data)
+	c := initBoundedCache(t, &Config{MaxBytes: 3 * size})
+
+	require.Nil(t, c.Add("a", &testCacheData{Name: "data", StatusCode: 200}))
+	require.Nil(t, c.Add("b", &testCacheData{Name: "data", StatusCode: 200}))
+	require.Equal(t, 2*size, c.bytes)
+
+	// The refreshed item became larger, the least recently used item is evicted
+	larger := &testCacheData{Name: strings.Repeat("x", int(2*size)), StatusCode: 200}
+	require.Nil(t, c.Update("b", larger))
+	_, err := c.Select("a")
+	require.Equal(t, errors.ErrNotFound, err)
+	v, err := c.Select("b")
+	require.Nil(t, err)
+	require.Equal(t, larger, v)
+	require.Equal(t, cachedata.SizeOf(larger), c.bytes)
+
+	// The item which became larger than cache is removed
+	require.Nil(t, c.Update("b", &testCacheData{Name: strings.Repeat("x", int(3*size)), StatusCode: 200}))
+	_, err = c.Select("b")
+	require.Equal(t, errors.ErrNotFound, err)
+	require.Zero(t, c.bytes)
+
+	// The item which is not in cache is not added
+	require.Nil(t, c.Update("c", data))
+	_, err = c.Select("c")
+	require.Equal(t, errors.ErrNotFound, err)
+}
+
+func TestOnRemove(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *Config
+	}{
+		{
+			name: "unbounded",
+			cfg:  initConfig(),
+		},
+		{
+			name: "bounded",
+			cfg:  &Config{MaxEntries: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := initBoundedCache(t, tt.cfg)
+			removed := make([]string, 0)
+			c.OnRemove(func(key string) {
+				removed = append(removed, key)
+			})
+
+			require.Nil(t, c.Add("a", &testCacheData{Name: "a", StatusCode: 200}))
+			require.Nil(t, c.Delete("a"))
+			require.Equal(t, []string{"a"}, removed)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package cache
+
+import "sync"
+
+// tagIndex is an inmemory index of tags of cached responses
+type tagIndex struct {
+	mu sync.Mutex
+	// keys are keys of responses by tag
+	keys map[string]map[string]struct{}
+	// tags are tags by key of response
+	tags map[string][]string
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		keys: make(map[string]map[string]struct{}),
+		tags: make(map[string][]string),
+	}
+}
+
+// set replaces tags of key
+func (t *tagIndex) set(key string, tags []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.removeLocked(key)
+
+	if len(tags) == 0 {
+		return
+	}
+
+	t.tags[key] = tags
+	for _, tag := range tags {
+		keys, ok := t.keys[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			t.keys[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+func (t *tagIndex) remove(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.removeLocked(key)
+}
+
+func (t *tagIndex) removeLocked(key string) {
+	for _, tag := range t.tags[key] {
+		delete(t.keys[tag], key)
+		if len(t.keys[tag]) == 0 {
+			delete(t.keys, tag)
+		}
+	}
+
+	delete(t.tags, key)
+}
+
+// keysOf returns keys of responses tagged by tag
+func (t *tagIndex) keysOf(tag string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make([]string, 0, len(t.keys[tag]))
+	for key := range t.keys[tag] {
+		result = append(result, key)
+	}
+
+	return result
+}
+
+// of returns tags of key
+func (t *tagIndex) of(key string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string(nil), t.tags[key]...)
+}
+
+// all returns all known tags
+func (t *tagIndex) all() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make([]string, 0, len(t.keys))
+	for tag := range t.keys {
+		result = append(result, tag)
+	}
+
+	return result
+}
+
+// mergeKeys appends to keys the other keys which are not in keys
+func mergeKeys(keys, other []string) []string {
+	known := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		known[key] = struct{}{}
+	}
+
+	for _, key := range other {
+		if _, ok := known[key]; !ok {
+			known[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// Purged collects responses deleted by purges of several caches, so the caches sharing external cache
+// read and delete its indexes once and every deleted response is counted once
+type Purged struct {
+	// keys are deleted responses by scope of cache
+	keys map[string]struct{}
+	// indexes are purged indexes of external cache by scope of cache
+	indexes map[string]struct{}
+}
+
+func NewPurged() *Purged {
+	return &Purged{
+		keys:    make(map[string]struct{}),
+		indexes: make(map[string]struct{}),
+	}
+}
+
+// addKey marks response as deleted, it returns false if response was deleted already
+func (p *Purged) addKey(scope, key string) bool {
+	return addOnce(p.keys, scope+"\n"+key)
+}
+
+// addIndex marks index as purged, it returns false if index was purged already
+func (p *Purged) addIndex(scope, index string) bool {
+	return addOnce(p.indexes, scope+"\n"+index)
+}
+
+func addOnce(set map[string]struct{}, item string) bool {
+	if _, ok := set[item]; ok {
+		return false
+	}
+	set[item] = struct{}{}
+
+	return true
+}
@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagIndex(t *testing.T) {
+	idx := newTagIndex()
+	idx.set("key1", []string{"users", "user-1"})
+	idx.set("key2", []string{"users", "user-2"})
+
+	keys := idx.keysOf("users")
+	sort.Strings(keys)
+	require.Equal(t, []string{"key1", "key2"}, keys)
+	require.Equal(t, []string{"key1"}, idx.keysOf("user-1"))
+	require.Empty(t, idx.keysOf("unknown"))
+
+	// New tags replace previous tags of key
+	idx.set("key1", []string{"orders"})
+	require.Equal(t, []string{"key2"}, idx.keysOf("users"))
+	require.Empty(t, idx.keysOf("user-1"))
+	require.Equal(t, []string{"key1"}, idx.keysOf("orders"))
+
+	idx.remove("key2")
+	require.Empty(t, idx.keysOf("users"))
+	require.Empty(t, idx.keysOf("user-2"))
+	require.Equal(t, 1, len(idx.tags))
+	require.Equal(t, 1, len(idx.keys))
+}
@@ -0,0 +1,77 @@
+package cache
+
+import "sync"
+
+// varyIndex is an inmemory index of Vary of cached responses. The headers are kept by base key
+// of request while any variant of response to request is in memory or on disk.
+type varyIndex struct {
+	mu sync.Mutex
+	// headers are headers from Vary by base key
+	headers map[string][]string
+	// bases are base keys by keys of variants
+	bases map[string]string
+	// variants are counts of variants by base key
+	variants map[string]int
+}
+
+func newVaryIndex() *varyIndex {
+	return &varyIndex{
+		headers:  make(map[string][]string),
+		bases:    make(map[string]string),
+		variants: make(map[string]int),
+	}
+}
+
+// set replaces headers of base key and links variant key to it, the empty headers are forgotten
+func (v *varyIndex) set(baseKey, key string, headers []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if len(headers) == 0 {
+		delete(v.headers, baseKey)
+		return
+	}
+
+	v.headers[baseKey] = headers
+	if base, ok := v.bases[key]; ok {
+		if base == baseKey {
+			return
+		}
+		v.removeLocked(key)
+	}
+
+	v.bases[key] = baseKey
+	v.variants[baseKey]++
+}
+
+// get returns headers of base key
+func (v *varyIndex) get(baseKey string) ([]string, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	headers, ok := v.headers[baseKey]
+
+	return headers, ok
+}
+
+// remove unlinks variant key, the headers are forgotten with the last variant
+func (v *varyIndex) remove(key string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.removeLocked(key)
+}
+
+func (v *varyIndex) removeLocked(key string) {
+	base, ok := v.bases[key]
+	if !ok {
+		return
+	}
+
+	delete(v.bases, key)
+	v.variants[base]--
+	if v.variants[base] <= 0 {
+		delete(v.variants, base)
+		delete(v.headers, base)
+	}
+}
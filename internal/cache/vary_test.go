@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaryIndex(t *testing.T) {
+	idx := newVaryIndex()
+	headers := []string{"Accept-Language"}
+	idx.set("base", "key-ru", headers)
+	idx.set("base", "key-en", headers)
+	idx.set("base", "key-en", headers)
+
+	v, ok := idx.get("base")
+	require.True(t, ok)
+	require.Equal(t, headers, v)
+	require.Equal(t, 2, idx.variants["base"])
+
+	// The headers are kept while any variant is cached
+	idx.remove("key-ru")
+	_, ok = idx.get("base")
+	require.True(t, ok)
+
+	idx.remove("key-en")
+	_, ok = idx.get("base")
+	require.False(t, ok)
+	require.Empty(t, idx.bases)
+	require.Empty(t, idx.variants)
+
+	// The response without Vary replaces headers
+	idx.set("base", "key-ru", headers)
+	idx.set("base", "base", nil)
+	_, ok = idx.get("base")
+	require.False(t, ok)
+	idx.remove("key-ru")
+	require.Empty(t, idx.variants)
+}
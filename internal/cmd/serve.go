@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/soldatov-s/accp/internal/admin"
 	"github.com/soldatov-s/accp/internal/app"
 	"github.com/soldatov-s/accp/internal/captcha"
 	"github.com/soldatov-s/accp/internal/cfg"
@@ -14,6 +15,7 @@ import (
 	"github.com/soldatov-s/accp/internal/meta"
 	"github.com/soldatov-s/accp/internal/rabbitmq"
 	"github.com/soldatov-s/accp/internal/redis"
+	"github.com/soldatov-s/accp/internal/upstream"
 	"github.com/spf13/cobra"
 )
 
@@ -45,6 +47,11 @@ func serveHandler(command *cobra.Command, _ []string) {
 	log.Info().Msgf("starting %s (%s)...", a.Name, a.GetBuildInfo())
 	log.Info().Msg(a.Description)
 
+	ctx, err = admin.Registrate(ctx, c.Admin)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to registrate admin")
+	}
+
 	ctx, err = introspection.Registrate(ctx, c.Introspector)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to registrate introspection")
@@ -65,6 +72,9 @@ func serveHandler(command *cobra.Command, _ []string) {
 		log.Fatal().Err(err).Msg("failed to registrate rabbitmq")
 	}
 
+	// Health checkers of upstreams are filled by routes of proxy
+	ctx = upstream.Registrate(ctx)
+
 	ctx, err = httpproxy.Registrate(ctx, c.Proxy)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to registrate proxy")
@@ -74,5 +84,7 @@ func serveHandler(command *cobra.Command, _ []string) {
 		log.Fatal().Err(err).Msg("failed to start providers")
 	}
 
-	app.Loop(ctx)
+	if err := app.Loop(ctx); err != nil {
+		log.Fatal().Err(err).Msg("failed to serve")
+	}
 }
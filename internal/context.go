@@ -15,9 +15,18 @@ type Providers struct {
 	sync.Map
 }
 
+type IShutdowner interface {
+	Shutdown() error
+}
+
 type IProvider interface {
 	Start() error
-	Shutdown() error
+	IShutdowner
+}
+
+// IServer is a provider which serves requests in background
+type IServer interface {
+	Errors() <-chan error
 }
 
 func Create(ctx context.Context) (context.Context, *Providers) {
@@ -15,12 +15,23 @@ type Config struct {
 	RequestID bool
 	Routes    routes.MapConfig
 	Excluded  routes.MapConfig
+	// Variants are routes for requests matched by host, headers and method,
+	// they have precedence over Routes
+	Variants []*VariantConfig
+	// PurgeToken is a bearer token of PURGE requests, empty token disables PURGE method
+	PurgeToken string
+	// WarmUp is a config of cache warm-up on start
+	WarmUp *WarmUpConfig
 }
 
 func (c *Config) SetDefault() {
 	if c.Listen == "" {
 		c.Listen = defaultListen
 	}
+
+	if c.WarmUp != nil {
+		c.WarmUp.SetDefault()
+	}
 }
 
 func (c *Config) Validate() error {
@@ -28,9 +39,23 @@ func (c *Config) Validate() error {
 		return errors.EmptyConfig("proxy")
 	}
 
-	if c.Routes == nil || len(c.Routes) == 0 {
+	if (c.Routes == nil || len(c.Routes) == 0) && len(c.Variants) == 0 {
 		return errors.EmptyConfigParameter("routes")
 	}
 
+	if err := c.Routes.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Excluded.Validate(); err != nil {
+		return err
+	}
+
+	for _, v := range c.Variants {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
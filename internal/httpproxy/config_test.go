@@ -1,9 +1,15 @@
 package httpproxy
 
 import (
+	stderrors "errors"
 	"testing"
 
+	"github.com/soldatov-s/accp/internal/cache"
+	cacheerrors "github.com/soldatov-s/accp/internal/cache/errors"
+	"github.com/soldatov-s/accp/internal/cache/memory"
 	"github.com/soldatov-s/accp/internal/errors"
+	"github.com/soldatov-s/accp/internal/routes"
+	"github.com/soldatov-s/accp/internal/upstream"
 	"github.com/stretchr/testify/require"
 )
 
@@ -19,3 +25,34 @@ func TestValidate(t *testing.T) {
 	require.NotNil(t, err)
 	require.Equal(t, errors.EmptyConfigParameter("routes"), err)
 }
+
+func TestValidateBalancing(t *testing.T) {
+	typo := &routes.Parameters{Balancer: &upstream.Config{Balancing: "leastcon"}}
+
+	// The unknown balancing is rejected in subroutes, excluded routes and variants
+	c := Config{Routes: routes.MapConfig{
+		"/api": &routes.Config{Routes: routes.MapConfig{"/v1": &routes.Config{Parameters: typo}}},
+	}}
+	require.True(t, stderrors.Is(c.Validate(), upstream.ErrUnknownBalancing))
+
+	c = Config{
+		Routes:   routes.MapConfig{"/api": &routes.Config{}},
+		Excluded: routes.MapConfig{"/health": &routes.Config{Parameters: typo}},
+	}
+	require.True(t, stderrors.Is(c.Validate(), upstream.ErrUnknownBalancing))
+
+	c = Config{Variants: []*VariantConfig{
+		{Name: "tenant", Host: "tenant.example.com", Parameters: typo, Routes: routes.MapConfig{"/api": &routes.Config{}}},
+	}}
+	require.True(t, stderrors.Is(c.Validate(), upstream.ErrUnknownBalancing))
+
+	typo.Balancer.Balancing = upstream.BalancingLeastConn
+	require.Nil(t, c.Validate())
+}
+
+func TestValidateEviction(t *testing.T) {
+	c := Config{Routes: routes.MapConfig{
+		"/api": &routes.Config{Parameters: &routes.Parameters{Cache: &cache.Config{Memory: &memory.Config{Eviction: "lfru"}}}},
+	}}
+	require.True(t, stderrors.Is(c.Validate(), cacheerrors.ErrUnknownEviction))
+}
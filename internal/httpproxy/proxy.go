@@ -6,7 +6,9 @@ import (
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"github.com/soldatov-s/accp/internal/admin"
 	"github.com/soldatov-s/accp/internal/cache/external"
 	"github.com/soldatov-s/accp/internal/httpsrv"
 	"github.com/soldatov-s/accp/internal/httputils"
@@ -16,6 +18,12 @@ import (
 	"github.com/soldatov-s/accp/internal/rabbitmq"
 	"github.com/soldatov-s/accp/internal/redis"
 	"github.com/soldatov-s/accp/internal/routes"
+	"github.com/soldatov-s/accp/internal/routes/breaker"
+)
+
+const (
+	ExcludedRoutesEndpoint = "/proxy/excluded"
+	BreakersEndpoint       = "/proxy/breakers"
 )
 
 type empty struct{}
@@ -26,9 +34,14 @@ type HTTPProxy struct {
 	log          zerolog.Logger
 	srv          *httpsrv.Server
 	routes       routes.MapRoutes
+	variants     []*variant
 	introspector introspection.Introspector
 	storage      external.Storage
 	pub          publisher.Publisher
+	// id is an ID of instance, it marks broadcasted purge messages
+	id string
+	// warmedUp is set to 1 after warm-up of cache
+	warmedUp int32
 }
 
 func NewHTTPProxy(ctx context.Context, cfg *Config) (*HTTPProxy, error) {
@@ -47,6 +60,7 @@ func NewHTTPProxy(ctx context.Context, cfg *Config) (*HTTPProxy, error) {
 		storage:      redis.Get(ctx),
 		pub:          rabbitmq.Get(ctx),
 		routes:       make(routes.MapRoutes),
+		id:           uuid.New().String(),
 	}
 
 	p.srv = httpsrv.NewHTTPServer(cfg.Listen, p.hydrationID(http.HandlerFunc(p.proxyHandler)))
@@ -55,6 +69,36 @@ func NewHTTPProxy(ctx context.Context, cfg *Config) (*HTTPProxy, error) {
 		return nil, err
 	}
 
+	if err := p.fillExcluded(p.cfg.Excluded, p.routes, nil, ""); err != nil {
+		return nil, err
+	}
+
+	if err := p.fillVariants(p.cfg.Variants); err != nil {
+		return nil, err
+	}
+
+	if a := admin.Get(ctx); a != nil {
+		if err := a.RegisterEndpoint(ExcludedRoutesEndpoint, p.excludedRoutesHandler); err != nil {
+			return nil, err
+		}
+
+		if err := a.RegisterEndpoint(PurgeEndpoint, p.purgeHandler); err != nil {
+			return nil, err
+		}
+
+		if err := a.RegisterEndpoint(BreakersEndpoint, p.breakersHandler); err != nil {
+			return nil, err
+		}
+
+		if cfg.WarmUp.Enabled() {
+			if err := a.RegisterReadyCheck(warmUpReadyCheckName, p.warmUpReady); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	rabbitmq.Get(ctx).ConsumePurge(p.purgeMessageHandler)
+
 	p.log.Info().Msg("proxy created")
 
 	return p, nil
@@ -80,6 +124,12 @@ func (p *HTTPProxy) fillRoutes(rc routes.MapConfig, r routes.MapRoutes, parentPa
 
 		k := strings.Trim(configKey, "/")
 		p.log.Debug().Msgf("parse route \"%s\"", k)
+
+		// Wildcard matches the rest of path, so the route with it can't have subroutes
+		if (k == routes.PathWildcard || strings.HasSuffix(k, "/"+routes.PathWildcard)) && len(rc[configKey].Routes) > 0 {
+			return errors.Wrap(routes.ErrWildcardNotLast, parentRoute+"/"+k)
+		}
+
 		route, err := r.AddRouteByPath(p.ctx, k, parentRoute+"/"+k, params)
 		if err != nil {
 			p.log.Warn().Err(err).Msgf("failed add route to map %s", parentRoute+"/"+k)
@@ -89,13 +139,182 @@ func (p *HTTPProxy) fillRoutes(rc routes.MapConfig, r routes.MapRoutes, parentPa
 		if err := p.fillRoutes(rc[configKey].Routes, route.Routes, params, parentRoute+"/"+k); err != nil {
 			return err
 		}
+
+		for _, e := range rc[configKey].Excluded {
+			e = strings.Trim(e, "/")
+			p.log.Debug().Msgf("parse excluded route \"%s\" of \"%s\"", e, k)
+			_, err := route.Routes.AddExcludedRouteByPath(p.ctx, e, parentRoute+"/"+k+"/"+e, params, "excluded in route "+parentRoute+"/"+k)
+			if err != nil {
+				p.log.Warn().Err(err).Msgf("failed add excluded route to map %s", parentRoute+"/"+k+"/"+e)
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// fillExcluded fill routes map by excluded routes from proxy config
+func (p *HTTPProxy) fillExcluded(rc routes.MapConfig, r routes.MapRoutes, parentParameters *routes.Parameters, parentRoute string) error {
+	keys := rc.SortKeys()
+
+	for _, configKey := range keys {
+		if rc[configKey] == nil {
+			return nil
+		}
+
+		k := strings.Trim(configKey, "/")
+
+		// The excluded route inherits parameters of route which it is nested in
+		params := parentParameters
+		if params == nil {
+			if parent := r.FindRouteByPath(k); parent != nil {
+				params = parent.Parameters()
+			}
+		}
+
+		params = params.Merge(rc[configKey].Parameters)
+		if params == nil {
+			params = &routes.Parameters{}
+		}
+		params.SetDefault()
+
+		p.log.Debug().Msgf("parse excluded route \"%s\"", k)
+		route, err := r.AddExcludedRouteByPath(p.ctx, k, parentRoute+"/"+k, params, "excluded in proxy config")
+		if err != nil {
+			p.log.Warn().Err(err).Msgf("failed add excluded route to map %s", parentRoute+"/"+k)
+			return err
+		}
+
+		if err := p.fillExcluded(rc[configKey].Routes, route.Routes, params, parentRoute+"/"+k); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// fillVariants fill routes maps of variants
+func (p *HTTPProxy) fillVariants(vc []*VariantConfig) error {
+	p.variants = make([]*variant, 0, len(vc))
+	for _, c := range vc {
+		p.log.Debug().Msgf("parse variant \"%s\"", c.Name)
+		v := newVariant(c)
+		c.setNamespace()
+		if c.Parameters != nil {
+			c.Parameters.SetDefault()
+		}
+
+		if err := p.fillRoutes(c.Routes, v.routes, c.Parameters, c.Name); err != nil {
+			return err
+		}
+
+		if err := p.fillExcluded(c.Excluded, v.routes, c.Parameters, c.Name); err != nil {
+			return err
+		}
+
+		p.variants = append(p.variants, v)
+	}
+
+	sortVariants(p.variants)
+
+	return nil
+}
+
+// findRoute finds route in matched variants by precedence, if route not found it
+// finds route in proxy routes. It returns request with matched path parameters.
+func (p *HTTPProxy) findRoute(r *http.Request) (*routes.Route, *http.Request) {
+	for _, v := range p.variants {
+		if !v.matches(r) {
+			continue
+		}
+
+		if route, req := v.routes.FindRouteByHTTPRequestWithParams(r); route != nil {
+			p.log.Debug().Msgf("request %s matched to variant %s", r.URL.String(), v.cfg.Name)
+			return route, req
+		}
+	}
+
+	return p.routes.FindRouteByHTTPRequestWithParams(r)
+}
+
+// ExcludedRoute describes excluded route for admin API
+type ExcludedRoute struct {
+	Variant string `json:"variant,omitempty"`
+	Path    string `json:"path"`
+	Reason  string `json:"reason"`
+}
+
+func excludedRoutes(variantName string, mr routes.MapRoutes) []ExcludedRoute {
+	result := make([]ExcludedRoute, 0)
+	mr.Walk(func(path string, route *routes.Route) {
+		if reason := route.ExcludedReason(); reason != "" {
+			result = append(result, ExcludedRoute{Variant: variantName, Path: path, Reason: reason})
+		}
+	})
+
+	return result
+}
+
+// ExcludedRoutes returns list of excluded routes
+func (p *HTTPProxy) ExcludedRoutes() []ExcludedRoute {
+	result := excludedRoutes("", p.routes)
+	for _, v := range p.variants {
+		result = append(result, excludedRoutes(v.cfg.Name, v.routes)...)
+	}
+
+	return result
+}
+
+func (p *HTTPProxy) excludedRoutesHandler(w http.ResponseWriter, _ *http.Request) {
+	answ := admin.ResultAnswer{Body: p.ExcludedRoutes()}
+	if err := answ.WriteJSON(w); err != nil {
+		p.log.Err(err).Msg("failed to write excluded routes")
+	}
+}
+
+// BreakerRoute describes breaker of route for admin API
+type BreakerRoute struct {
+	Variant string `json:"variant,omitempty"`
+	Path    string `json:"path"`
+	*breaker.Status
+}
+
+func breakerRoutes(variantName string, mr routes.MapRoutes) []BreakerRoute {
+	result := make([]BreakerRoute, 0)
+	mr.Walk(func(path string, route *routes.Route) {
+		if status := route.BreakerStatus(); status != nil {
+			result = append(result, BreakerRoute{Variant: variantName, Path: path, Status: status})
+		}
+	})
+
+	return result
+}
+
+// BreakerRoutes returns list of routes with enabled breaker
+func (p *HTTPProxy) BreakerRoutes() []BreakerRoute {
+	result := breakerRoutes("", p.routes)
+	for _, v := range p.variants {
+		result = append(result, breakerRoutes(v.cfg.Name, v.routes)...)
+	}
+
+	return result
+}
+
+func (p *HTTPProxy) breakersHandler(w http.ResponseWriter, _ *http.Request) {
+	answ := admin.ResultAnswer{Body: p.BreakerRoutes()}
+	if err := answ.WriteJSON(w); err != nil {
+		p.log.Err(err).Msg("failed to write breakers of routes")
+	}
+}
+
 func (p *HTTPProxy) proxyHandler(w http.ResponseWriter, r *http.Request) {
-	route := p.routes.FindRouteByHTTPRequest(r)
+	if r.Method == MethodPurge {
+		p.purgeMethodHandler(w, r)
+		return
+	}
+
+	route, r := p.findRoute(r)
 	if route != nil {
 		route.ProxyHandler(w, r)
 		return
@@ -127,9 +346,23 @@ func (p *HTTPProxy) hydrationID(next http.Handler) http.Handler {
 
 func (p *HTTPProxy) Start() error {
 	p.log.Debug().Msg("start proxy")
-	return p.srv.ListenAndServe()
+	if err := p.srv.Start(); err != nil {
+		return err
+	}
+
+	// The proxy serves requests during warm-up, but it is not ready until warm-up is finished
+	if p.cfg.WarmUp.Enabled() {
+		go p.warmUp()
+	}
+
+	return nil
 }
 
 func (p *HTTPProxy) Shutdown() error {
 	return p.srv.Shutdown()
 }
+
+// Errors returns channel of serving error of proxy server
+func (p *HTTPProxy) Errors() <-chan error {
+	return p.srv.Errors()
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/soldatov-s/accp/internal/rabbitmq"
 	"github.com/soldatov-s/accp/internal/redis"
 	"github.com/soldatov-s/accp/internal/routes"
+	"github.com/soldatov-s/accp/internal/routes/breaker"
 	"github.com/soldatov-s/accp/internal/routes/refresh"
 	"github.com/soldatov-s/accp/x/dockertest"
 	testproxyhelpers "github.com/soldatov-s/accp/x/test_helpers/proxy"
@@ -299,3 +300,247 @@ func TestFillRoutes(t *testing.T) {
 	require.Contains(t, mapRoutes["api"].Routes, "v1")
 	require.Contains(t, mapRoutes["api"].Routes["v1"].Routes, "users")
 }
+
+func TestFillRoutesWithParams(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	p := &HTTPProxy{
+		ctx: ctx,
+		log: logger.GetPackageLogger(ctx, empty{}),
+	}
+
+	routesCfg := make(routes.MapConfig)
+	params := initParameters()
+	routesCfg["/api/v1/users/{id}"] = &routes.Config{
+		Parameters: params,
+		Routes: routes.MapConfig{
+			"orders": &routes.Config{},
+		},
+	}
+	routesCfg["/static/*"] = &routes.Config{
+		Parameters: params,
+	}
+
+	mapRoutes := make(routes.MapRoutes)
+
+	err := p.fillRoutes(routesCfg, mapRoutes, nil, "")
+	require.Nil(t, err)
+	require.Contains(t, mapRoutes["api"].Routes["v1"].Routes["users"].Routes, "{id}")
+	require.Contains(t, mapRoutes["api"].Routes["v1"].Routes["users"].Routes["{id}"].Routes, "orders")
+	require.Contains(t, mapRoutes["static"].Routes, routes.PathWildcard)
+
+	routesCfg["/static/*"].Routes = routes.MapConfig{
+		"css": &routes.Config{},
+	}
+
+	err = p.fillRoutes(routesCfg, make(routes.MapRoutes), nil, "")
+	require.NotNil(t, err)
+}
+
+func TestExcludedRoutes(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	p := &HTTPProxy{
+		ctx:    ctx,
+		log:    logger.GetPackageLogger(ctx, empty{}),
+		routes: make(routes.MapRoutes),
+	}
+
+	routesCfg := make(routes.MapConfig)
+	params := initParameters()
+	routesCfg["/api/v1/users"] = &routes.Config{
+		Parameters: params,
+		Excluded:   []string{"avatar"},
+	}
+
+	excludedCfg := make(routes.MapConfig)
+	excludedCfg["/health"] = &routes.Config{
+		Parameters: &routes.Parameters{
+			DSN: testproxyhelpers.DefaultFakeServiceURL,
+		},
+	}
+	excludedCfg["/api/v1/users/settings/private"] = &routes.Config{}
+
+	err := p.fillRoutes(routesCfg, p.routes, nil, "")
+	require.Nil(t, err)
+
+	err = p.fillExcluded(excludedCfg, p.routes, nil, "")
+	require.Nil(t, err)
+
+	excluded := p.ExcludedRoutes()
+	require.Equal(t, []ExcludedRoute{
+		{Path: "/api/v1/users/avatar", Reason: "excluded in route /api/v1/users"},
+		{Path: "/api/v1/users/settings/private", Reason: "excluded in proxy config"},
+		{Path: "/health", Reason: "excluded in proxy config"},
+	}, excluded)
+
+	// The excluded route inherits parameters of parent route, the intermediate route isn't cached
+	private := p.routes.FindRouteByPath("/api/v1/users/settings/private")
+	require.Equal(t, params.DSN, private.Parameters().DSN)
+	require.Equal(t, params.RouteKey, private.Parameters().RouteKey)
+	settings := p.routes.FindRouteByPath("/api/v1/users/settings")
+	require.True(t, settings.Parameters().Cache.Disabled)
+	require.Empty(t, settings.ExcludedReason())
+
+	w := httptest.NewRecorder()
+	p.excludedRoutesHandler(w, httptest.NewRequest(http.MethodGet, ExcludedRoutesEndpoint, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "/api/v1/users/avatar")
+}
+
+func TestBreakerRoutes(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	p := &HTTPProxy{
+		ctx:    ctx,
+		log:    logger.GetPackageLogger(ctx, empty{}),
+		routes: make(routes.MapRoutes),
+	}
+
+	routesCfg := make(routes.MapConfig)
+	params := initParameters()
+	params.Breaker = &breaker.Config{Failures: 3}
+	routesCfg["/api/v1/users"] = &routes.Config{
+		Parameters: params,
+	}
+	routesCfg["/health"] = &routes.Config{
+		Parameters: initParameters(),
+	}
+
+	err := p.fillRoutes(routesCfg, p.routes, nil, "")
+	require.Nil(t, err)
+
+	breakers := p.BreakerRoutes()
+	require.Contains(t, breakers, BreakerRoute{Path: "/api/v1/users", Status: &breaker.Status{State: "closed"}})
+	for _, v := range breakers {
+		require.NotEqual(t, "/health", v.Path)
+	}
+
+	w := httptest.NewRecorder()
+	p.breakersHandler(w, httptest.NewRequest(http.MethodGet, BreakersEndpoint, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"path":"/api/v1/users","state":"closed"`)
+}
+
+func TestVariantsKeyPrefix(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	p := &HTTPProxy{
+		ctx:    ctx,
+		log:    logger.GetPackageLogger(ctx, empty{}),
+		routes: make(routes.MapRoutes),
+	}
+
+	variantCfg := func(name, host string) *VariantConfig {
+		return &VariantConfig{
+			Name: name,
+			Host: host,
+			Parameters: &routes.Parameters{
+				DSN:   "http://" + name + ":10000",
+				Cache: &cache.Config{External: &external.Config{}},
+			},
+			Routes: routes.MapConfig{
+				"/api/v1/users": &routes.Config{
+					Parameters: &routes.Parameters{Cache: &cache.Config{External: &external.Config{TTL: time.Minute}}},
+				},
+			},
+		}
+	}
+
+	// The variants with the same path must not share external cache
+	tenant1 := variantCfg("tenant1", "tenant1.example.com")
+	tenant2 := variantCfg("tenant2", "tenant2.example.com")
+	err := p.fillVariants([]*VariantConfig{tenant1, tenant2})
+	require.Nil(t, err)
+
+	require.Equal(t, "accp_tenant1_", tenant1.Parameters.Cache.External.KeyPrefix)
+	require.Equal(t, "accp_tenant1_", tenant1.Routes["/api/v1/users"].Parameters.Cache.External.KeyPrefix)
+	require.Equal(t, "accp_tenant2_", tenant2.Parameters.Cache.External.KeyPrefix)
+	require.Equal(t, "accp_tenant2_", tenant2.Routes["/api/v1/users"].Parameters.Cache.External.KeyPrefix)
+
+	// The configured prefix is kept and inherited by routes
+	own := variantCfg("tenant3", "tenant3.example.com")
+	own.Parameters.Cache.External.KeyPrefix = "tenant3_"
+	err = p.fillVariants([]*VariantConfig{own})
+	require.Nil(t, err)
+	require.Equal(t, "tenant3_", own.Parameters.Cache.External.KeyPrefix)
+	require.Empty(t, own.Routes["/api/v1/users"].Parameters.Cache.External.KeyPrefix)
+}
+
+func TestFindRouteWithVariants(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	p := &HTTPProxy{
+		ctx:    ctx,
+		log:    logger.GetPackageLogger(ctx, empty{}),
+		routes: make(routes.MapRoutes),
+	}
+
+	routesCfg := make(routes.MapConfig)
+	routesCfg["/api/v1/users"] = &routes.Config{
+		Parameters: initParameters(),
+	}
+
+	err := p.fillRoutes(routesCfg, p.routes, nil, "")
+	require.Nil(t, err)
+
+	err = p.fillVariants([]*VariantConfig{
+		{
+			Name: "tenant",
+			Host: "tenant.example.com",
+			Routes: routes.MapConfig{
+				"/api/v1/users": &routes.Config{},
+			},
+			Parameters: &routes.Parameters{
+				DSN: "http://tenant:10000",
+			},
+		},
+		{
+			Name:   "v2",
+			Header: map[string]string{"x-api-version": "2"},
+			Routes: routes.MapConfig{
+				"/orders": &routes.Config{},
+			},
+			Parameters: &routes.Parameters{
+				DSN: "http://v2:10000",
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	tenantRoute := p.variants[0].routes.FindRouteByPath("/api/v1/users")
+	v2Route := p.variants[1].routes.FindRouteByPath("/orders")
+	defaultRoute := p.routes.FindRouteByPath("/api/v1/users")
+	require.NotEqual(t, tenantRoute, defaultRoute)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+	req.Host = "tenant.example.com"
+	route, _ := p.findRoute(req)
+	require.Equal(t, tenantRoute, route)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+	req.Host = "other.example.com"
+	route, _ = p.findRoute(req)
+	require.Equal(t, defaultRoute, route)
+
+	// route not found in matched variant, fall back to proxy routes
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+	req.Header.Set("X-Api-Version", "2")
+	route, _ = p.findRoute(req)
+	require.Equal(t, defaultRoute, route)
+
+	req = httptest.NewRequest(http.MethodGet, "/orders/42", nil)
+	req.Header.Set("X-Api-Version", "2")
+	route, _ = p.findRoute(req)
+	require.Equal(t, v2Route, route)
+}
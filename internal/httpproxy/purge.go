@@ -0,0 +1,335 @@
+package httpproxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/soldatov-s/accp/internal/admin"
+	"github.com/soldatov-s/accp/internal/cache"
+	"github.com/soldatov-s/accp/internal/rabbitmq"
+	"github.com/soldatov-s/accp/internal/routes"
+)
+
+const (
+	PurgeEndpoint = "/cache/purge"
+	// MethodPurge is a method of request to proxy listener which purges cached responses to request URI
+	MethodPurge = "PURGE"
+	// purgeTagParam is a query param of purge endpoint with tag, it may be repeated
+	purgeTagParam = "tag"
+	// purgeURLParam is a query param of purge endpoint with exact request URI, it may be repeated
+	purgeURLParam = "url"
+	// purgePrefixParam is a query param of purge endpoint with prefix of request URI, it may be repeated
+	purgePrefixParam = "prefix"
+	// purgeRegexParam is a query param of purge endpoint with regex of request URI, it may be repeated
+	purgeRegexParam = "regex"
+
+	authorizationHeader = "Authorization"
+	bearerPrefix        = "Bearer "
+)
+
+// PurgeMessage is a message from purge exchange of rabbitmq
+type PurgeMessage struct {
+	// Origin is an ID of instance which published message, the instance ignores own messages
+	Origin   string   `json:"origin,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	URLs     []string `json:"urls,omitempty"`
+	Prefixes []string `json:"prefixes,omitempty"`
+	Regexps  []string `json:"regexps,omitempty"`
+}
+
+// Empty checks that message has nothing to purge
+func (m *PurgeMessage) Empty() bool {
+	return len(m.Tags) == 0 && len(m.URLs) == 0 && len(m.Prefixes) == 0 && len(m.Regexps) == 0
+}
+
+// matcher returns func which matches request URI by prefixes and regexps of message,
+// it returns nil if message has no prefixes and regexps
+func (m *PurgeMessage) matcher() (func(uri string) bool, error) {
+	if len(m.Prefixes) == 0 && len(m.Regexps) == 0 {
+		return nil, nil
+	}
+
+	regexps := make([]*regexp.Regexp, 0, len(m.Regexps))
+	for _, v := range m.Regexps {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, err
+		}
+		regexps = append(regexps, re)
+	}
+
+	return func(uri string) bool {
+		for _, prefix := range m.Prefixes {
+			if strings.HasPrefix(uri, prefix) {
+				return true
+			}
+		}
+
+		for _, re := range regexps {
+			if re.MatchString(uri) {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// PurgeResult describes result of purge for admin API
+type PurgeResult struct {
+	Tags     []string `json:"tags,omitempty"`
+	URLs     []string `json:"urls,omitempty"`
+	Prefixes []string `json:"prefixes,omitempty"`
+	Regexps  []string `json:"regexps,omitempty"`
+	Purged   int      `json:"purged"`
+}
+
+func purgeRoutes(mr routes.MapRoutes, purge func(route *routes.Route) (int, error)) (int, error) {
+	var (
+		count int
+		err   error
+	)
+	mr.Walk(func(path string, route *routes.Route) {
+		if err != nil {
+			return
+		}
+
+		var n int
+		if n, err = purge(route); err != nil {
+			err = errors.Wrapf(err, "failed to purge route %s", path)
+			return
+		}
+		count += n
+	})
+
+	return count, err
+}
+
+// purgeAllRoutes calls purge for all routes of proxy and variants
+func (p *HTTPProxy) purgeAllRoutes(purge func(route *routes.Route) (int, error)) (int, error) {
+	count, err := purgeRoutes(p.routes, purge)
+	if err != nil {
+		return count, err
+	}
+
+	for _, v := range p.variants {
+		var n int
+		if n, err = purgeRoutes(v.routes, purge); err != nil {
+			return count, err
+		}
+		count += n
+	}
+
+	return count, nil
+}
+
+// Purge deletes cached responses by tags, exact request URIs, prefixes and regexps of request URIs
+// in all routes, it returns count of deleted responses
+func (p *HTTPProxy) Purge(msg *PurgeMessage) (int, error) {
+	match, err := msg.matcher()
+	if err != nil {
+		return 0, err
+	}
+
+	// The routes share external cache, so its indexes are purged and the responses are counted once
+	purged := cache.NewPurged()
+
+	count := 0
+	for _, tag := range msg.Tags {
+		tag := tag
+		n, errPurge := p.purgeAllRoutes(func(route *routes.Route) (int, error) { return route.PurgeTag(tag, purged) })
+		if errPurge != nil {
+			return count, errors.Wrapf(errPurge, "failed to purge tag %s", tag)
+		}
+		count += n
+	}
+
+	for _, uri := range msg.URLs {
+		uri := uri
+		n, errPurge := p.purgeAllRoutes(func(route *routes.Route) (int, error) { return route.PurgeURL(uri, purged) })
+		if errPurge != nil {
+			return count, errors.Wrapf(errPurge, "failed to purge url %s", uri)
+		}
+		count += n
+	}
+
+	if match != nil {
+		n, errPurge := p.purgeAllRoutes(func(route *routes.Route) (int, error) { return route.Purge(match, purged) })
+		if errPurge != nil {
+			return count, errPurge
+		}
+		count += n
+	}
+
+	p.log.Info().Msgf("purged %d responses by tags %v, urls %v, prefixes %v, regexps %v",
+		count, msg.Tags, msg.URLs, msg.Prefixes, msg.Regexps)
+
+	return count, nil
+}
+
+// PurgeTags deletes cached responses tagged by tags in all routes, it returns count of deleted responses
+func (p *HTTPProxy) PurgeTags(tags []string) (int, error) {
+	return p.Purge(&PurgeMessage{Tags: tags})
+}
+
+// broadcastPurge publishes message to purge exchange of rabbitmq, so other instances purge their caches
+func (p *HTTPProxy) broadcastPurge(msg *PurgeMessage) {
+	broadcast := *msg
+	broadcast.Origin = p.id
+
+	if err := rabbitmq.Get(p.ctx).PublishPurge(&broadcast); err != nil {
+		p.log.Err(err).Msg("failed to broadcast purge")
+	}
+}
+
+// purgeMessageHandler handles message from purge exchange of rabbitmq
+func (p *HTTPProxy) purgeMessageHandler(body []byte) error {
+	var msg PurgeMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return errors.Wrap(err, "failed to decode purge message")
+	}
+
+	// The own message was already applied before broadcasting
+	if msg.Origin != "" && msg.Origin == p.id {
+		return nil
+	}
+
+	_, err := p.Purge(&msg)
+
+	return err
+}
+
+func writePurgeError(w http.ResponseWriter, statusCode int, code, details string) error {
+	answ := admin.ErrorAnswer{
+		Body: admin.ErrorAnswerBody{
+			Code: code,
+			BaseAnswer: admin.BaseAnswer{
+				StatusCode: statusCode,
+				Details:    details,
+			},
+		},
+	}
+
+	return answ.WriteJSON(w)
+}
+
+// queryValues returns values of repeated query param, every value may be a space separated list
+func queryValues(query url.Values, name string) []string {
+	result := make([]string, 0)
+	for _, v := range query[name] {
+		result = append(result, strings.Fields(v)...)
+	}
+
+	return result
+}
+
+// requestURI returns request URI of absolute URL, other values are returned as is
+func requestURI(v string) string {
+	if u, err := url.Parse(v); err == nil && u.IsAbs() {
+		return u.RequestURI()
+	}
+
+	return v
+}
+
+// purgeHandler purges cached responses by tags, exact request URIs, prefixes and regexps from query,
+// e.g. POST /cache/purge?tag=user-42&url=/api/v1/users/42&prefix=/api/v1/orders/&regex=^/api/v1/.*\?page=
+func (p *HTTPProxy) purgeHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+	defer func() {
+		if err != nil {
+			p.log.Err(err).Msg("failed to write purge answer")
+		}
+	}()
+
+	if r.Method != http.MethodPost {
+		err = writePurgeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "only POST is allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	msg := &PurgeMessage{
+		Tags:     queryValues(query, purgeTagParam),
+		URLs:     make([]string, 0),
+		Prefixes: query[purgePrefixParam],
+		Regexps:  query[purgeRegexParam],
+	}
+
+	for _, v := range queryValues(query, purgeURLParam) {
+		msg.URLs = append(msg.URLs, requestURI(v))
+	}
+
+	if msg.Empty() {
+		err = writePurgeError(w, http.StatusBadRequest, "EMPTY_PURGE", "tag, url, prefix or regex is required")
+		return
+	}
+
+	if _, errMatcher := msg.matcher(); errMatcher != nil {
+		err = writePurgeError(w, http.StatusBadRequest, "BAD_REGEX", errMatcher.Error())
+		return
+	}
+
+	count, errPurge := p.Purge(msg)
+	if errPurge != nil {
+		p.log.Err(errPurge).Msg("failed to purge cache")
+		err = writePurgeError(w, http.StatusServiceUnavailable, "PURGE_FAILED", errPurge.Error())
+		return
+	}
+
+	p.broadcastPurge(msg)
+
+	answ := admin.ResultAnswer{Body: PurgeResult{
+		Tags:     msg.Tags,
+		URLs:     msg.URLs,
+		Prefixes: msg.Prefixes,
+		Regexps:  msg.Regexps,
+		Purged:   count,
+	}}
+	err = answ.WriteJSON(w)
+}
+
+// authorizedPurge checks bearer token of PURGE request
+func (p *HTTPProxy) authorizedPurge(r *http.Request) bool {
+	token := r.Header.Get(authorizationHeader)
+	if !strings.HasPrefix(token, bearerPrefix) {
+		return false
+	}
+
+	token = strings.TrimPrefix(token, bearerPrefix)
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(p.cfg.PurgeToken)) == 1
+}
+
+// purgeMethodHandler purges cached responses to request URI of PURGE request, e.g. PURGE /api/v1/users/42
+func (p *HTTPProxy) purgeMethodHandler(w http.ResponseWriter, r *http.Request) {
+	if p.cfg == nil || p.cfg.PurgeToken == "" {
+		http.Error(w, "method "+MethodPurge+" is not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !p.authorizedPurge(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	msg := &PurgeMessage{URLs: []string{r.URL.RequestURI()}}
+	count, err := p.Purge(msg)
+	if err != nil {
+		p.log.Err(err).Msg("failed to purge cache")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	p.broadcastPurge(msg)
+
+	answ := admin.ResultAnswer{Body: PurgeResult{URLs: msg.URLs, Purged: count}}
+	if err = answ.WriteJSON(w); err != nil {
+		p.log.Err(err).Msg("failed to write purge answer")
+	}
+}
@@ -0,0 +1,213 @@
+package httpproxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/soldatov-s/accp/internal/cache"
+	"github.com/soldatov-s/accp/internal/cache/memory"
+	"github.com/soldatov-s/accp/internal/httputils"
+	"github.com/soldatov-s/accp/internal/logger"
+	rrdata "github.com/soldatov-s/accp/internal/request_response_data"
+	"github.com/soldatov-s/accp/internal/routes"
+	"github.com/soldatov-s/accp/internal/routes/refresh"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeTags(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	var counter int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tags := "orders"
+		if strings.HasPrefix(r.URL.Path, "/api/v1/users/") {
+			tags = "users user-" + strings.TrimPrefix(r.URL.Path, "/api/v1/users/")
+		}
+		w.Header().Set(httputils.SurrogateKeyHeader, tags)
+		_, _ = w.Write([]byte(strconv.Itoa(int(atomic.AddInt32(&counter, 1)))))
+	}))
+	defer server.Close()
+
+	p := &HTTPProxy{
+		ctx:    ctx,
+		log:    logger.GetPackageLogger(ctx, empty{}),
+		routes: make(routes.MapRoutes),
+	}
+
+	routesCfg := routes.MapConfig{
+		"/api/v1": &routes.Config{
+			Parameters: &routes.Parameters{
+				DSN:           server.URL,
+				Cache:         &cache.Config{Memory: &memory.Config{TTL: time.Minute, TTLErr: time.Minute}},
+				Refresh:       &refresh.Config{MaxCount: 1000, Time: time.Hour},
+				NotIntrospect: true,
+				NotCaptcha:    true,
+			},
+		},
+	}
+	require.Nil(t, p.fillRoutes(routesCfg, p.routes, nil, ""))
+
+	request := func(path string) (source, body string) {
+		w := httptest.NewRecorder()
+		p.proxyHandler(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Header().Get(rrdata.ResponseSourceHeader), w.Body.String()
+	}
+
+	_, body := request("/api/v1/users/42")
+	require.Equal(t, "1", body)
+	_, body = request("/api/v1/orders/1")
+	require.Equal(t, "2", body)
+	src, body := request("/api/v1/users/42")
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Equal(t, "1", body)
+
+	purge := func(method, query string) (int, []byte) {
+		w := httptest.NewRecorder()
+		p.purgeHandler(w, httptest.NewRequest(method, PurgeEndpoint+query, nil))
+		return w.Code, w.Body.Bytes()
+	}
+
+	code, _ := purge(http.MethodGet, "?tag=user-42")
+	require.Equal(t, http.StatusMethodNotAllowed, code)
+
+	code, _ = purge(http.MethodPost, "")
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, answBody := purge(http.MethodPost, "?tag=user-42")
+	require.Equal(t, http.StatusOK, code)
+	var answ struct {
+		Result PurgeResult `json:"result"`
+	}
+	require.Nil(t, json.Unmarshal(answBody, &answ))
+	require.Equal(t, PurgeResult{Tags: []string{"user-42"}, Purged: 1}, answ.Result)
+
+	src, body = request("/api/v1/users/42")
+	require.Equal(t, rrdata.ResponseBack.String(), src)
+	require.Equal(t, "3", body)
+
+	// The response without purged tag is kept
+	src, body = request("/api/v1/orders/1")
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Equal(t, "2", body)
+
+	// Purge by message from rabbitmq
+	require.Nil(t, p.purgeMessageHandler([]byte(`{"tags":["orders"]}`)))
+	src, body = request("/api/v1/orders/1")
+	require.Equal(t, rrdata.ResponseBack.String(), src)
+	require.Equal(t, "4", body)
+
+	require.NotNil(t, p.purgeMessageHandler([]byte("not json")))
+}
+
+func TestPurgeURLs(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	var counter int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strconv.Itoa(int(atomic.AddInt32(&counter, 1)))))
+	}))
+	defer server.Close()
+
+	p := &HTTPProxy{
+		ctx:    ctx,
+		cfg:    &Config{PurgeToken: "secret"},
+		log:    logger.GetPackageLogger(ctx, empty{}),
+		routes: make(routes.MapRoutes),
+		id:     "instance-1",
+	}
+
+	routesCfg := routes.MapConfig{
+		"/api/v1": &routes.Config{
+			Parameters: &routes.Parameters{
+				DSN:           server.URL,
+				Cache:         &cache.Config{Memory: &memory.Config{TTL: time.Minute, TTLErr: time.Minute}},
+				Refresh:       &refresh.Config{MaxCount: 1000, Time: time.Hour},
+				NotIntrospect: true,
+				NotCaptcha:    true,
+			},
+		},
+	}
+	require.Nil(t, p.fillRoutes(routesCfg, p.routes, nil, ""))
+
+	request := func(path string) string {
+		w := httptest.NewRecorder()
+		p.proxyHandler(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Header().Get(rrdata.ResponseSourceHeader)
+	}
+
+	paths := []string{"/api/v1/users/1", "/api/v1/users/2", "/api/v1/orders/1", "/api/v1/orders/2?page=2", "/api/v1/items/1"}
+	for _, path := range paths {
+		require.Equal(t, rrdata.ResponseBack.String(), request(path))
+		require.Equal(t, rrdata.ResponseCache.String(), request(path))
+	}
+
+	purgeMethod := func(path, token string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(MethodPurge, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		p.proxyHandler(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusUnauthorized, purgeMethod("/api/v1/users/1", ""))
+	require.Equal(t, http.StatusUnauthorized, purgeMethod("/api/v1/users/1", "wrong"))
+	require.Equal(t, rrdata.ResponseCache.String(), request("/api/v1/users/1"))
+
+	require.Equal(t, http.StatusOK, purgeMethod("/api/v1/users/1", "secret"))
+	require.Equal(t, rrdata.ResponseBack.String(), request("/api/v1/users/1"))
+	require.Equal(t, rrdata.ResponseCache.String(), request("/api/v1/users/2"))
+
+	purge := func(query string) (int, PurgeResult) {
+		w := httptest.NewRecorder()
+		p.purgeHandler(w, httptest.NewRequest(http.MethodPost, PurgeEndpoint+query, nil))
+		var answ struct {
+			Result PurgeResult `json:"result"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &answ)
+		return w.Code, answ.Result
+	}
+
+	code, _ := purge("?regex=(")
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, result := purge("?url=" + url.QueryEscape("http://example.com/api/v1/users/2"))
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, PurgeResult{URLs: []string{"/api/v1/users/2"}, Purged: 1}, result)
+	require.Equal(t, rrdata.ResponseBack.String(), request("/api/v1/users/2"))
+
+	code, result = purge("?prefix=/api/v1/orders/")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, 2, result.Purged)
+	require.Equal(t, rrdata.ResponseBack.String(), request("/api/v1/orders/1"))
+	require.Equal(t, rrdata.ResponseBack.String(), request("/api/v1/orders/2?page=2"))
+
+	code, result = purge("?regex=" + url.QueryEscape(`^/api/v1/(items|orders)/\d+$`))
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, 2, result.Purged)
+	require.Equal(t, rrdata.ResponseBack.String(), request("/api/v1/items/1"))
+	require.Equal(t, rrdata.ResponseCache.String(), request("/api/v1/orders/2?page=2"))
+
+	// Own broadcasted message is ignored, message from other instance is applied
+	require.Nil(t, p.purgeMessageHandler([]byte(`{"origin":"instance-1","urls":["/api/v1/users/1"]}`)))
+	require.Equal(t, rrdata.ResponseCache.String(), request("/api/v1/users/1"))
+	require.Nil(t, p.purgeMessageHandler([]byte(`{"origin":"instance-2","urls":["/api/v1/users/1"]}`)))
+	require.Equal(t, rrdata.ResponseBack.String(), request("/api/v1/users/1"))
+
+	// PURGE method is disabled without token
+	p.cfg.PurgeToken = ""
+	require.Equal(t, http.StatusMethodNotAllowed, purgeMethod("/api/v1/users/1", "secret"))
+}
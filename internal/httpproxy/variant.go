@@ -0,0 +1,200 @@
+package httpproxy
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	accperrors "github.com/soldatov-s/accp/internal/errors"
+	"github.com/soldatov-s/accp/internal/routes"
+	"github.com/soldatov-s/accp/x/helper"
+)
+
+const (
+	wildcardHostPrefix = "*."
+)
+
+// VariantConfig declares routes for requests matched by host, headers and method.
+// Precedence of matched variants:
+// - exact host is preferred over wildcard host, wildcard host over any host;
+// - with equal host the variant with more headers is preferred;
+// - with equal host and headers the variant with methods is preferred;
+// - otherwise variants are checked in order of declaration.
+// If request path is not covered by routes of matched variants, the request is routed by proxy routes.
+type VariantConfig struct {
+	// Name is a name of variant, it is used as prefix for names of routes
+	Name string
+	// Host is a host of request, "*.example.com" matches all subdomains of example.com
+	Host string
+	// Header is a map of headers and their values which must be in request
+	Header map[string]string
+	// Methods are methods of request, empty list matches all methods
+	Methods helper.Arguments
+	// Parameters are parameters for all routes of variant
+	Parameters *routes.Parameters
+	// Routes are routes of variant
+	Routes routes.MapConfig
+	// Excluded are excluded routes of variant
+	Excluded routes.MapConfig
+}
+
+func (c *VariantConfig) Validate() error {
+	if c == nil {
+		return accperrors.EmptyConfig("variant")
+	}
+
+	if c.Name == "" {
+		return accperrors.EmptyConfigParameter("variant name")
+	}
+
+	if c.Host == "" && len(c.Header) == 0 && len(c.Methods) == 0 {
+		return accperrors.EmptyConfigParameter("variant " + c.Name + " host, header or methods")
+	}
+
+	if len(c.Routes) == 0 {
+		return accperrors.EmptyConfigParameter("variant " + c.Name + " routes")
+	}
+
+	if err := c.Parameters.Validate(); err != nil {
+		return errors.Wrap(err, "variant "+c.Name)
+	}
+
+	if err := c.Routes.Validate(); err != nil {
+		return errors.Wrap(err, "variant "+c.Name)
+	}
+
+	return c.Excluded.Validate()
+}
+
+// setNamespace sets default key prefix of external caches of variant to its name. The request hash
+// doesn't include host and headers of variant, so the variants with the same paths must not share
+// cached responses. The prefix configured in parent parameters is inherited by routes.
+func (c *VariantConfig) setNamespace() {
+	configured := setParametersNamespace(c.Parameters, c.Name, false)
+	setRoutesNamespace(c.Routes, c.Name, configured)
+	setRoutesNamespace(c.Excluded, c.Name, configured)
+}
+
+func setRoutesNamespace(rc routes.MapConfig, namespace string, configured bool) {
+	for _, v := range rc {
+		if v == nil {
+			continue
+		}
+
+		setRoutesNamespace(v.Routes, namespace, setParametersNamespace(v.Parameters, namespace, configured))
+	}
+}
+
+// setParametersNamespace sets namespace if key prefix is not configured in parameters or in parent
+// parameters, it returns true if key prefix is configured for subroutes
+func setParametersNamespace(params *routes.Parameters, namespace string, configured bool) bool {
+	if params == nil {
+		return configured
+	}
+
+	// The overwriting parameters don't inherit key prefix of parent
+	if params.MergeStrategy == routes.MergeStrategyOverwrite {
+		configured = false
+	}
+
+	if params.Cache == nil || params.Cache.External == nil {
+		return configured
+	}
+
+	if params.Cache.External.KeyPrefix != "" {
+		return true
+	}
+
+	if !configured {
+		params.Cache.External.SetNamespace(namespace)
+	}
+
+	return configured
+}
+
+type variant struct {
+	cfg    *VariantConfig
+	routes routes.MapRoutes
+}
+
+func newVariant(cfg *VariantConfig) *variant {
+	return &variant{
+		cfg:    cfg,
+		routes: make(routes.MapRoutes),
+	}
+}
+
+// hostRank returns 2 for exact host, 1 for wildcard host and 0 for any host
+func (v *variant) hostRank() int {
+	switch {
+	case v.cfg.Host == "":
+		return 0
+	case strings.HasPrefix(v.cfg.Host, wildcardHostPrefix):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// less checks that variant v has precedence over variant o
+func (v *variant) less(o *variant) bool {
+	if v.hostRank() != o.hostRank() {
+		return v.hostRank() > o.hostRank()
+	}
+
+	if len(v.cfg.Header) != len(o.cfg.Header) {
+		return len(v.cfg.Header) > len(o.cfg.Header)
+	}
+
+	return len(v.cfg.Methods) > 0 && len(o.cfg.Methods) == 0
+}
+
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.ToLower(host)
+}
+
+func (v *variant) matchHost(r *http.Request) bool {
+	if v.cfg.Host == "" {
+		return true
+	}
+
+	host := requestHost(r)
+	pattern := strings.ToLower(v.cfg.Host)
+	if strings.HasPrefix(pattern, wildcardHostPrefix) {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+
+	return host == pattern
+}
+
+func (v *variant) matches(r *http.Request) bool {
+	if !v.matchHost(r) {
+		return false
+	}
+
+	for k, value := range v.cfg.Header {
+		if r.Header.Get(k) != value {
+			return false
+		}
+	}
+
+	if len(v.cfg.Methods) > 0 && !v.cfg.Methods.Has(r.Method) {
+		return false
+	}
+
+	return true
+}
+
+// sortVariants sorts variants by precedence
+func sortVariants(variants []*variant) {
+	sort.SliceStable(variants, func(i, j int) bool {
+		return variants[i].less(variants[j])
+	})
+}
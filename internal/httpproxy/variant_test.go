@@ -0,0 +1,128 @@
+package httpproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soldatov-s/accp/internal/routes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVariantConfigValidate(t *testing.T) {
+	var c *VariantConfig
+	require.NotNil(t, c.Validate())
+
+	c = &VariantConfig{}
+	require.NotNil(t, c.Validate())
+
+	c.Name = "tenant"
+	require.NotNil(t, c.Validate())
+
+	c.Host = "tenant.example.com"
+	require.NotNil(t, c.Validate())
+
+	c.Routes = routes.MapConfig{"/api/v1": &routes.Config{}}
+	require.Nil(t, c.Validate())
+}
+
+func TestVariantMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *VariantConfig
+		method   string
+		host     string
+		header   http.Header
+		expected bool
+	}{
+		{
+			name:     "exact host",
+			cfg:      &VariantConfig{Host: "tenant.example.com"},
+			method:   http.MethodGet,
+			host:     "tenant.example.com:9000",
+			expected: true,
+		},
+		{
+			name:     "exact host not matched",
+			cfg:      &VariantConfig{Host: "tenant.example.com"},
+			method:   http.MethodGet,
+			host:     "other.example.com",
+			expected: false,
+		},
+		{
+			name:     "wildcard host",
+			cfg:      &VariantConfig{Host: "*.example.com"},
+			method:   http.MethodGet,
+			host:     "Tenant.Example.com",
+			expected: true,
+		},
+		{
+			name:     "wildcard host not matched",
+			cfg:      &VariantConfig{Host: "*.example.com"},
+			method:   http.MethodGet,
+			host:     "example.org",
+			expected: false,
+		},
+		{
+			name:     "header",
+			cfg:      &VariantConfig{Header: map[string]string{"x-api-version": "2"}},
+			method:   http.MethodGet,
+			host:     "localhost",
+			header:   http.Header{"X-Api-Version": []string{"2"}},
+			expected: true,
+		},
+		{
+			name:     "header not matched",
+			cfg:      &VariantConfig{Header: map[string]string{"x-api-version": "2"}},
+			method:   http.MethodGet,
+			host:     "localhost",
+			header:   http.Header{"X-Api-Version": []string{"1"}},
+			expected: false,
+		},
+		{
+			name:     "method",
+			cfg:      &VariantConfig{Methods: []string{http.MethodPost}},
+			method:   http.MethodPost,
+			host:     "localhost",
+			expected: true,
+		},
+		{
+			name:     "method not matched",
+			cfg:      &VariantConfig{Methods: []string{http.MethodPost}},
+			method:   http.MethodGet,
+			host:     "localhost",
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/users", nil)
+			req.Host = tt.host
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+
+			require.Equal(t, tt.expected, newVariant(tt.cfg).matches(req))
+		})
+	}
+}
+
+func TestSortVariants(t *testing.T) {
+	anyHost := newVariant(&VariantConfig{Name: "any", Header: map[string]string{"x-api-version": "2"}})
+	anyHostMethod := newVariant(&VariantConfig{Name: "anymethod", Header: map[string]string{"x-api-version": "2"}, Methods: []string{http.MethodGet}})
+	wildcard := newVariant(&VariantConfig{Name: "wildcard", Host: "*.example.com"})
+	exact := newVariant(&VariantConfig{Name: "exact", Host: "tenant.example.com"})
+	exactHeader := newVariant(&VariantConfig{Name: "exactheader", Host: "tenant.example.com", Header: map[string]string{"x-api-version": "2"}})
+
+	variants := []*variant{anyHost, anyHostMethod, wildcard, exact, exactHeader}
+	sortVariants(variants)
+
+	names := make([]string, 0, len(variants))
+	for _, v := range variants {
+		names = append(names, v.cfg.Name)
+	}
+
+	require.Equal(t, []string{"exactheader", "exact", "wildcard", "anymethod", "any"}, names)
+}
@@ -0,0 +1,190 @@
+package httpproxy
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/soldatov-s/accp/internal/routes"
+)
+
+const (
+	defaultWarmUpConcurrency = 4
+	defaultWarmUpTimeout     = time.Minute
+	// warmUpReadyCheckName is a name of ready check which fails until warm-up is finished
+	warmUpReadyCheckName = "PROXY_WARMUP"
+)
+
+// WarmUpConfig is a config of cache warm-up on start, the proxy is not ready until warm-up
+// is finished or timed out
+type WarmUpConfig struct {
+	// File is a JSON file with list of requests, every request has method, url, headers and body
+	File string
+	// Recent enables warm-up by latest requests which are remembered in external caches of routes,
+	// the count of requests is set by recent in external cache config
+	Recent bool
+	// Concurrency is a max count of parallel requests to backends
+	Concurrency int
+	// Timeout is a max duration of warm-up, after it the proxy is ready regardless of warm-up
+	Timeout time.Duration
+}
+
+func (c *WarmUpConfig) SetDefault() {
+	if c.Concurrency <= 0 {
+		c.Concurrency = defaultWarmUpConcurrency
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = defaultWarmUpTimeout
+	}
+}
+
+// Enabled checks that warm-up has requests source
+func (c *WarmUpConfig) Enabled() bool {
+	return c != nil && (c.File != "" || c.Recent)
+}
+
+// readWarmUpFile reads list of requests from JSON file
+func readWarmUpFile(path string) ([]*routes.WarmUpRequest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*routes.WarmUpRequest, 0)
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode warm-up file %s", path)
+	}
+
+	return result, nil
+}
+
+// recentRequests returns latest requests remembered by all routes, the routes with the same
+// external cache share requests, so the requests are deduplicated
+func (p *HTTPProxy) recentRequests() []*routes.WarmUpRequest {
+	result := make([]*routes.WarmUpRequest, 0)
+	seen := make(map[string]struct{})
+	walk := func(path string, route *routes.Route) {
+		recent, err := route.RecentRequests()
+		if err != nil {
+			p.log.Err(err).Msgf("failed to get recent requests of route %s", path)
+			return
+		}
+
+		for _, w := range recent {
+			// The keys of headers are sorted by encoding, so the same requests have the same ID
+			id, errID := json.Marshal(w)
+			if errID != nil {
+				continue
+			}
+
+			if _, ok := seen[string(id)]; ok {
+				continue
+			}
+			seen[string(id)] = struct{}{}
+			result = append(result, w)
+		}
+	}
+
+	p.routes.Walk(walk)
+	for _, v := range p.variants {
+		v.routes.Walk(walk)
+	}
+
+	return result
+}
+
+// warmUpRequests returns requests from file and latest requests of routes
+func (p *HTTPProxy) warmUpRequests() []*routes.WarmUpRequest {
+	result := make([]*routes.WarmUpRequest, 0)
+	if p.cfg.WarmUp.File != "" {
+		requests, err := readWarmUpFile(p.cfg.WarmUp.File)
+		if err != nil {
+			p.log.Err(err).Msg("failed to read warm-up file")
+		}
+		result = append(result, requests...)
+	}
+
+	if p.cfg.WarmUp.Recent {
+		result = append(result, p.recentRequests()...)
+	}
+
+	return result
+}
+
+// warmUpRequest replays request through route which caches it
+func (p *HTTPProxy) warmUpRequest(w *routes.WarmUpRequest) error {
+	req, err := w.HTTPRequest()
+	if err != nil {
+		return err
+	}
+
+	route, req := p.findRoute(req)
+	if route == nil {
+		return errors.New("route not found")
+	}
+
+	return route.WarmUp(req)
+}
+
+// warmUp replays warm-up requests with bounded concurrency, the proxy becomes ready after it
+func (p *HTTPProxy) warmUp() {
+	defer atomic.StoreInt32(&p.warmedUp, 1)
+
+	requests := p.warmUpRequests()
+	p.log.Info().Msgf("warm-up by %d requests", len(requests))
+
+	var (
+		wg     sync.WaitGroup
+		failed int32
+	)
+	sem := make(chan struct{}, p.cfg.WarmUp.Concurrency)
+	ctx, cancel := context.WithTimeout(p.ctx, p.cfg.WarmUp.Timeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, w := range requests {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			wg.Add(1)
+			go func(w *routes.WarmUpRequest) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+
+				if err := p.warmUpRequest(w); err != nil {
+					atomic.AddInt32(&failed, 1)
+					p.log.Warn().Err(err).Msgf("failed to warm up by %s %s", w.Method, w.URL)
+				}
+			}(w)
+		}
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+		p.log.Info().Msgf("warm-up finished, %d of %d requests failed", atomic.LoadInt32(&failed), len(requests))
+	case <-ctx.Done():
+		p.log.Warn().Msgf("warm-up timed out after %s", p.cfg.WarmUp.Timeout)
+	}
+}
+
+// warmUpReady is a ready check of warm-up
+func (p *HTTPProxy) warmUpReady() (bool, string) {
+	if atomic.LoadInt32(&p.warmedUp) == 0 {
+		return false, "warm-up is in progress"
+	}
+
+	return true, "warmed up"
+}
@@ -0,0 +1,98 @@
+package httpproxy
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/soldatov-s/accp/internal/cache"
+	"github.com/soldatov-s/accp/internal/cache/memory"
+	"github.com/soldatov-s/accp/internal/logger"
+	rrdata "github.com/soldatov-s/accp/internal/request_response_data"
+	"github.com/soldatov-s/accp/internal/routes"
+	"github.com/soldatov-s/accp/internal/routes/refresh"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmUp(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	var counter int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Accept-Language") + strconv.Itoa(int(atomic.AddInt32(&counter, 1)))))
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "warmup.json")
+	err := ioutil.WriteFile(file, []byte(`[
+		{"url": "/api/v1/users/1"},
+		{"method": "GET", "url": "http://example.com/api/v1/users/2", "headers": {"Accept-Language": "ru"}},
+		{"url": "/unknown"},
+		{"method": "DELETE", "url": "/api/v1/users/3"}
+	]`), 0o600)
+	require.Nil(t, err)
+
+	cfg := &Config{WarmUp: &WarmUpConfig{File: file, Concurrency: 2}}
+	cfg.SetDefault()
+
+	p := &HTTPProxy{
+		ctx:    ctx,
+		cfg:    cfg,
+		log:    logger.GetPackageLogger(ctx, empty{}),
+		routes: make(routes.MapRoutes),
+	}
+
+	routesCfg := routes.MapConfig{
+		"/api/v1": &routes.Config{
+			Parameters: &routes.Parameters{
+				DSN: server.URL,
+				Cache: &cache.Config{
+					Memory: &memory.Config{TTL: time.Minute, TTLErr: time.Minute},
+					Key:    &cache.KeyConfig{Headers: []string{"accept-language"}},
+				},
+				Refresh:       &refresh.Config{MaxCount: 1000, Time: time.Hour},
+				NotIntrospect: true,
+				NotCaptcha:    true,
+			},
+		},
+	}
+	require.Nil(t, p.fillRoutes(routesCfg, p.routes, nil, ""))
+
+	ready, _ := p.warmUpReady()
+	require.False(t, ready)
+
+	p.warmUp()
+
+	ready, _ = p.warmUpReady()
+	require.True(t, ready)
+	require.Equal(t, int32(2), atomic.LoadInt32(&counter))
+
+	request := func(path, language string) (source, body string) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if language != "" {
+			req.Header.Set("Accept-Language", language)
+		}
+		p.proxyHandler(w, req)
+		return w.Header().Get(rrdata.ResponseSourceHeader), w.Body.String()
+	}
+
+	src, _ := request("/api/v1/users/1", "")
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+
+	src, body := request("/api/v1/users/2", "ru")
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Contains(t, body, "ru")
+
+	// The warmed up response is not requested again
+	p.warmUp()
+	require.Equal(t, int32(2), atomic.LoadInt32(&counter))
+}
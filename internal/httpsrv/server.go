@@ -2,12 +2,15 @@ package httpsrv
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
 	"time"
 )
 
 type Server struct {
 	*http.Server
+	errs chan error
 }
 
 func NewHTTPServer(addr string, hndl http.Handler) *Server {
@@ -17,7 +20,9 @@ func NewHTTPServer(addr string, hndl http.Handler) *Server {
 			ReadTimeout:    10 * time.Second,
 			WriteTimeout:   10 * time.Second,
 			MaxHeaderBytes: 1 << 20,
-		}}
+		},
+		errs: make(chan error, 1),
+	}
 
 	srv.Handler = hndl
 
@@ -27,3 +32,25 @@ func NewHTTPServer(addr string, hndl http.Handler) *Server {
 func (srv *Server) Shutdown() error {
 	return srv.Server.Shutdown(context.Background())
 }
+
+// Start listens on the address and serves requests in background, the error of serving
+// is sent to Errors
+func (srv *Server) Start() error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if errServe := srv.Serve(ln); errServe != nil && !errors.Is(errServe, http.ErrServerClosed) {
+			srv.errs <- errServe
+		}
+	}()
+
+	return nil
+}
+
+// Errors returns channel of serving error, the server doesn't serve requests after error
+func (srv *Server) Errors() <-chan error {
+	return srv.errs
+}
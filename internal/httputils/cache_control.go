@@ -0,0 +1,164 @@
+package httputils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	cacheControlHeader = "Cache-Control"
+	expiresHeader      = "Expires"
+	dateHeader         = "Date"
+	varyHeader         = "Vary"
+	// SurrogateKeyHeader is a header of backend response with space separated tags of response
+	SurrogateKeyHeader = "Surrogate-Key"
+
+	cacheControlNoStore = "no-store"
+	cacheControlPrivate = "private"
+	cacheControlMaxAge  = "max-age"
+	cacheControlSMaxAge = "s-maxage"
+	varyAny             = "*"
+)
+
+// CachePolicy describes how response may be cached by shared cache
+type CachePolicy struct {
+	// NoStore is true if response must not be cached
+	NoStore bool
+	// TTL is a lifetime of response, it is nil if backend not defined it
+	TTL *time.Duration
+	// Vary are canonical names of request headers which select the response
+	Vary []string
+}
+
+// ParseCachePolicy parses Cache-Control, Expires and Vary headers of response.
+// The s-maxage has priority over max-age and max-age has priority over Expires.
+func ParseCachePolicy(h http.Header, now time.Time) *CachePolicy {
+	p := &CachePolicy{}
+
+	var maxAge, sMaxAge *time.Duration
+	for _, v := range h.Values(cacheControlHeader) {
+		for _, directive := range strings.Split(v, ",") {
+			name, value := parseDirective(directive)
+			switch name {
+			case cacheControlNoStore, cacheControlPrivate:
+				p.NoStore = true
+			case cacheControlMaxAge:
+				maxAge = parseSeconds(value)
+			case cacheControlSMaxAge:
+				sMaxAge = parseSeconds(value)
+			}
+		}
+	}
+
+	switch {
+	case sMaxAge != nil:
+		p.TTL = sMaxAge
+	case maxAge != nil:
+		p.TTL = maxAge
+	case h.Get(expiresHeader) != "":
+		p.TTL = parseExpires(h, now)
+	}
+
+	for _, v := range h.Values(varyHeader) {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+
+			// Response varies by something except headers, it can't be cached
+			if name == varyAny {
+				p.NoStore = true
+				p.Vary = nil
+				return p
+			}
+
+			p.Vary = append(p.Vary, http.CanonicalHeaderKey(name))
+		}
+	}
+
+	sort.Strings(p.Vary)
+
+	return p
+}
+
+func parseDirective(directive string) (name, value string) {
+	directive = strings.TrimSpace(directive)
+	if i := strings.Index(directive, "="); i >= 0 {
+		return strings.ToLower(strings.TrimSpace(directive[:i])), strings.Trim(strings.TrimSpace(directive[i+1:]), "\"")
+	}
+
+	return strings.ToLower(directive), ""
+}
+
+func parseSeconds(value string) *time.Duration {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		// Invalid value means that response is already expired
+		seconds = 0
+	}
+
+	d := time.Duration(seconds) * time.Second
+
+	return &d
+}
+
+func parseExpires(h http.Header, now time.Time) *time.Duration {
+	var d time.Duration
+
+	expires, err := http.ParseTime(h.Get(expiresHeader))
+	if err != nil {
+		// Invalid Expires means that response is already expired
+		return &d
+	}
+
+	// The lifetime is calculated from Date of backend to avoid clock skew
+	if date, errDate := http.ParseTime(h.Get(dateHeader)); errDate == nil {
+		now = date
+	}
+
+	if expires.After(now) {
+		d = expires.Sub(now)
+	}
+
+	return &d
+}
+
+// HashWithHeaders returns hash of key and values of request headers
+func HashWithHeaders(key string, r *http.Request, headers []string) string {
+	if len(headers) == 0 {
+		return key
+	}
+
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range headers {
+		b.WriteString("\n" + name + ":" + strings.Join(r.Header.Values(name), ","))
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+
+	return base64.URLEncoding.EncodeToString(sum[:])
+}
+
+// ParseSurrogateKeys returns unique tags from Surrogate-Key header
+func ParseSurrogateKeys(h http.Header) []string {
+	var tags []string
+	seen := make(map[string]struct{})
+	for _, v := range h.Values(SurrogateKeyHeader) {
+		for _, tag := range strings.Fields(v) {
+			if _, ok := seen[tag]; ok {
+				continue
+			}
+			seen[tag] = struct{}{}
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
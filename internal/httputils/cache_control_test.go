@@ -0,0 +1,111 @@
+package httputils
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCachePolicy(t *testing.T) {
+	now := time.Date(2021, 1, 20, 12, 0, 0, 0, time.UTC)
+	duration := func(d time.Duration) *time.Duration {
+		return &d
+	}
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected *CachePolicy
+	}{
+		{
+			name:     "without headers",
+			header:   http.Header{},
+			expected: &CachePolicy{},
+		},
+		{
+			name:     "no-store",
+			header:   http.Header{"Cache-Control": {"no-store"}},
+			expected: &CachePolicy{NoStore: true},
+		},
+		{
+			name:     "private with max-age",
+			header:   http.Header{"Cache-Control": {"private, max-age=60"}},
+			expected: &CachePolicy{NoStore: true, TTL: duration(time.Minute)},
+		},
+		{
+			name:     "s-maxage has priority over max-age",
+			header:   http.Header{"Cache-Control": {"max-age=60, s-maxage=\"30\""}},
+			expected: &CachePolicy{TTL: duration(30 * time.Second)},
+		},
+		{
+			name: "max-age has priority over expires",
+			header: http.Header{
+				"Cache-Control": {"public, max-age=60"},
+				"Expires":       {now.Add(time.Hour).Format(http.TimeFormat)},
+			},
+			expected: &CachePolicy{TTL: duration(time.Minute)},
+		},
+		{
+			name: "expires is calculated from date",
+			header: http.Header{
+				"Date":    {now.Add(-time.Hour).Format(http.TimeFormat)},
+				"Expires": {now.Format(http.TimeFormat)},
+			},
+			expected: &CachePolicy{TTL: duration(time.Hour)},
+		},
+		{
+			name:     "invalid expires",
+			header:   http.Header{"Expires": {"0"}},
+			expected: &CachePolicy{TTL: duration(0)},
+		},
+		{
+			name:     "invalid max-age",
+			header:   http.Header{"Cache-Control": {"max-age=abc"}},
+			expected: &CachePolicy{TTL: duration(0)},
+		},
+		{
+			name:     "vary",
+			header:   http.Header{"Vary": {"accept-language, Accept-Encoding", "X-Tenant"}},
+			expected: &CachePolicy{Vary: []string{"Accept-Encoding", "Accept-Language", "X-Tenant"}},
+		},
+		{
+			name:     "vary any",
+			header:   http.Header{"Vary": {"Accept-Encoding, *"}},
+			expected: &CachePolicy{NoStore: true},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, ParseCachePolicy(tt.header, now))
+		})
+	}
+}
+
+func TestHashWithHeaders(t *testing.T) {
+	headers := []string{"Accept-Language"}
+
+	req1, err := http.NewRequest(http.MethodGet, "/test", nil)
+	require.Nil(t, err)
+	req1.Header.Set("Accept-Language", "en")
+
+	req2, err := http.NewRequest(http.MethodGet, "/test", nil)
+	require.Nil(t, err)
+	req2.Header.Set("Accept-Language", "ru")
+
+	require.Equal(t, "key", HashWithHeaders("key", req1, nil))
+	require.Equal(t, HashWithHeaders("key", req1, headers), HashWithHeaders("key", req1, headers))
+	require.NotEqual(t, HashWithHeaders("key", req1, headers), HashWithHeaders("key", req2, headers))
+}
+
+func TestParseSurrogateKeys(t *testing.T) {
+	h := http.Header{}
+	require.Empty(t, ParseSurrogateKeys(h))
+
+	h.Add(SurrogateKeyHeader, " user-42  orders ")
+	h.Add(SurrogateKeyHeader, "orders users")
+	require.Equal(t, []string{"user-42", "orders", "users"}, ParseSurrogateKeys(h))
+}
@@ -0,0 +1,176 @@
+package httputils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+const (
+	ContentEncodingHeader = "Content-Encoding"
+	AcceptEncodingHeader  = "Accept-Encoding"
+	ContentLengthHeader   = "Content-Length"
+
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+
+	anyEncoding = "*"
+)
+
+var ErrUnknownEncoding = errors.New("unknown content encoding")
+
+var (
+	// zstd encoder and decoder are safe for concurrent EncodeAll and DecodeAll, they are created once
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	errZstd     error
+)
+
+func initZstd() error {
+	zstdOnce.Do(func() {
+		if zstdEncoder, errZstd = zstd.NewWriter(nil); errZstd != nil {
+			return
+		}
+		zstdDecoder, errZstd = zstd.NewReader(nil)
+	})
+
+	return errZstd
+}
+
+// ValidEncoding checks that encoding is supported
+func ValidEncoding(encoding string) bool {
+	return encoding == EncodingGzip || encoding == EncodingZstd
+}
+
+// Compress encodes data by content encoding
+func Compress(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case EncodingGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	case EncodingZstd:
+		if err := initZstd(); err != nil {
+			return nil, err
+		}
+
+		return zstdEncoder.EncodeAll(data, make([]byte, 0, len(data)/2)), nil
+	default:
+		return nil, errors.Wrap(ErrUnknownEncoding, encoding)
+	}
+}
+
+// Decompress decodes data by content encoding
+func Decompress(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case EncodingGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		return ioutil.ReadAll(r)
+	case EncodingZstd:
+		if err := initZstd(); err != nil {
+			return nil, err
+		}
+
+		return zstdDecoder.DecodeAll(data, nil)
+	default:
+		return nil, errors.Wrap(ErrUnknownEncoding, encoding)
+	}
+}
+
+// NewDecompressor returns reader which decodes r by content encoding
+func NewDecompressor(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		return gzip.NewReader(r)
+	case EncodingZstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return d.IOReadCloser(), nil
+	default:
+		return nil, errors.Wrap(ErrUnknownEncoding, encoding)
+	}
+}
+
+// AcceptsEncoding checks that Accept-Encoding of request allows encoding, the encoding with q=0 is not allowed
+func AcceptsEncoding(r *http.Request, encoding string) bool {
+	if r == nil {
+		return false
+	}
+
+	accepted := false
+	for _, v := range r.Header.Values(AcceptEncodingHeader) {
+		for _, item := range strings.Split(v, ",") {
+			params := strings.Split(item, ";")
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+			if name != encoding && name != anyEncoding {
+				continue
+			}
+
+			q := 1.0
+			for _, p := range params[1:] {
+				p = strings.TrimSpace(p)
+				if strings.HasPrefix(p, "q=") {
+					if f, err := strconv.ParseFloat(strings.TrimPrefix(p, "q="), 64); err == nil {
+						q = f
+					}
+				}
+			}
+
+			// The exact encoding has priority over wildcard
+			if name == encoding {
+				return q > 0
+			}
+			accepted = q > 0
+		}
+	}
+
+	return accepted
+}
+
+// WeakETag returns weak ETag of etag, the encoded representation can't have the strong ETag of identity representation
+func WeakETag(etag string) string {
+	if etag == "" || strings.HasPrefix(etag, weakETagPrefix) {
+		return etag
+	}
+
+	return weakETagPrefix + etag
+}
+
+// AddVary adds name to Vary header if it is not there
+func AddVary(h http.Header, name string) {
+	for _, v := range h.Values(varyHeader) {
+		for _, item := range strings.Split(v, ",") {
+			item = strings.TrimSpace(item)
+			if item == varyAny || strings.EqualFold(item, name) {
+				return
+			}
+		}
+	}
+
+	h.Add(varyHeader, name)
+}
@@ -0,0 +1,85 @@
+package httputils
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompress(t *testing.T) {
+	data := []byte(strings.Repeat(`{"name":"test"},`, 100))
+	for _, encoding := range []string{EncodingGzip, EncodingZstd} {
+		compressed, err := Compress(encoding, data)
+		require.Nil(t, err)
+		require.Less(t, len(compressed), len(data))
+
+		decompressed, err := Decompress(encoding, compressed)
+		require.Nil(t, err)
+		require.Equal(t, data, decompressed)
+
+		r, err := NewDecompressor(encoding, bytes.NewReader(compressed))
+		require.Nil(t, err)
+		decompressed, err = ioutil.ReadAll(r)
+		require.Nil(t, err)
+		require.Equal(t, data, decompressed)
+		require.Nil(t, r.Close())
+	}
+
+	_, err := Compress("br", data)
+	require.True(t, errors.Is(err, ErrUnknownEncoding))
+	_, err = Decompress(EncodingGzip, data)
+	require.NotNil(t, err)
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		encoding       string
+		expected       bool
+	}{
+		{name: "no header", acceptEncoding: "", encoding: EncodingGzip, expected: false},
+		{name: "exact", acceptEncoding: "gzip, deflate, br", encoding: EncodingGzip, expected: true},
+		{name: "other", acceptEncoding: "gzip, deflate, br", encoding: EncodingZstd, expected: false},
+		{name: "quality", acceptEncoding: "zstd;q=0.5", encoding: EncodingZstd, expected: true},
+		{name: "zero quality", acceptEncoding: "gzip;q=0, *", encoding: EncodingGzip, expected: false},
+		{name: "wildcard", acceptEncoding: "*", encoding: EncodingZstd, expected: true},
+		{name: "zero wildcard", acceptEncoding: "*;q=0", encoding: EncodingZstd, expected: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set(AcceptEncodingHeader, tt.acceptEncoding)
+			}
+			require.Equal(t, tt.expected, AcceptsEncoding(r, tt.encoding))
+		})
+	}
+
+	require.False(t, AcceptsEncoding(nil, EncodingGzip))
+}
+
+func TestAddVary(t *testing.T) {
+	h := make(http.Header)
+	AddVary(h, AcceptEncodingHeader)
+	AddVary(h, "accept-encoding")
+	require.Equal(t, []string{AcceptEncodingHeader}, h.Values(varyHeader))
+
+	h = http.Header{varyHeader: []string{"Accept-Language, Accept-Encoding"}}
+	AddVary(h, AcceptEncodingHeader)
+	require.Equal(t, []string{"Accept-Language, Accept-Encoding"}, h.Values(varyHeader))
+}
+
+func TestWeakETag(t *testing.T) {
+	require.Equal(t, `W/"abc"`, WeakETag(`"abc"`))
+	require.Equal(t, `W/"abc"`, WeakETag(`W/"abc"`))
+	require.Equal(t, "", WeakETag(""))
+}
@@ -0,0 +1,120 @@
+package httputils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+const (
+	ETagHeader            = "ETag"
+	LastModifiedHeader    = "Last-Modified"
+	IfNoneMatchHeader     = "If-None-Match"
+	IfModifiedSinceHeader = "If-Modified-Since"
+
+	weakETagPrefix = "W/"
+	anyETag        = "*"
+)
+
+// notModifiedHeaders are headers which are sent in 304 response and updated by 304 response of backend
+var notModifiedHeaders = []string{
+	cacheControlHeader,
+	"Content-Location",
+	dateHeader,
+	ETagHeader,
+	expiresHeader,
+	LastModifiedHeader,
+	varyHeader,
+}
+
+// GenerateETag returns strong ETag of body
+func GenerateETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "\"" + base64.RawURLEncoding.EncodeToString(sum[:]) + "\""
+}
+
+// NotModified checks that response with header matches If-None-Match or If-Modified-Since of request.
+// The If-Modified-Since is ignored if request has If-None-Match.
+func NotModified(r *http.Request, header http.Header) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get(IfNoneMatchHeader); inm != "" {
+		return etagMatch(inm, header.Get(ETagHeader))
+	}
+
+	ims := r.Header.Get(IfModifiedSinceHeader)
+	lm := header.Get(LastModifiedHeader)
+	if ims == "" || lm == "" {
+		return false
+	}
+
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+
+	modified, err := http.ParseTime(lm)
+	if err != nil {
+		return false
+	}
+
+	return !modified.After(since)
+}
+
+// etagMatch checks that etag is in list of If-None-Match by weak comparison
+func etagMatch(list, etag string) bool {
+	if etag == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, weakETagPrefix)
+	for _, v := range strings.Split(list, ",") {
+		v = strings.TrimSpace(v)
+		if v == anyETag || strings.TrimPrefix(v, weakETagPrefix) == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CopyNotModifiedHeader copies headers which are allowed in 304 response
+func CopyNotModifiedHeader(dst, src http.Header) {
+	for _, name := range notModifiedHeaders {
+		values := src.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+
+		dst.Del(name)
+		for _, v := range values {
+			dst.Add(name, v)
+		}
+	}
+}
+
+// RemoveConditionalHeaders removes If-None-Match and If-Modified-Since, backend answers full response
+// on request without them
+func RemoveConditionalHeaders(h http.Header) {
+	h.Del(IfNoneMatchHeader)
+	h.Del(IfModifiedSinceHeader)
+}
+
+// MakeConditional replaces If-None-Match and If-Modified-Since of request by validators of cached response,
+// it returns false if there are no validators
+func MakeConditional(r *http.Request, etag, lastModified string) bool {
+	RemoveConditionalHeaders(r.Header)
+
+	if etag != "" {
+		r.Header.Set(IfNoneMatchHeader, etag)
+	}
+
+	if lastModified != "" {
+		r.Header.Set(IfModifiedSinceHeader, lastModified)
+	}
+
+	return etag != "" || lastModified != ""
+}
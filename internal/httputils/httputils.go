@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/valyala/bytebufferpool"
 )
@@ -43,8 +44,10 @@ func HashRequest(r *http.Request) (string, error) {
 		if err != nil {
 			return "", err
 		}
-		r.Body = ioutil.NopCloser(bytes.NewReader(buf.Bytes()))
-		hashedString += buf.String()
+		// The buffer is returned to pool, so the body is read again from the string
+		body := buf.String()
+		r.Body = ioutil.NopCloser(strings.NewReader(body))
+		hashedString += body
 	}
 	sum := sha256.New().Sum([]byte(hashedString))
 	return base64.URLEncoding.EncodeToString(sum), nil
@@ -67,26 +70,22 @@ func GetRequestID(r *http.Request) string {
 	return r.Header.Get(RequestIDHeader)
 }
 
+// CopyRequestWithDSN returns copy of request to dsn, the body is moved to the copy without buffering,
+// so it is streamed to backend and it can't be read from req after copying
 func CopyRequestWithDSN(req *http.Request, dsn string) (*http.Request, error) {
-	var (
-		proxyReq *http.Request
-		err      error
-	)
-	if req.Body != nil {
-		var body []byte
-		body, err = ioutil.ReadAll(req.Body)
-		if err != nil {
-			return nil, err
-		}
-		req.Body = ioutil.NopCloser(bytes.NewReader(body))
-		proxyReq, err = http.NewRequest(req.Method, dsn+req.URL.String(), bytes.NewReader(body))
-	} else {
-		proxyReq, err = http.NewRequest(req.Method, dsn+req.URL.String(), nil)
-	}
+	// The request to backend is canceled together with request of client
+	proxyReq, err := http.NewRequestWithContext(req.Context(), req.Method, dsn+req.URL.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 
+	if req.Body != nil && req.Body != http.NoBody {
+		proxyReq.Body = req.Body
+		proxyReq.ContentLength = req.ContentLength
+		proxyReq.GetBody = req.GetBody
+		req.Body = http.NoBody
+	}
+
 	CopyHeader(proxyReq.Header, req.Header)
 
 	return proxyReq, nil
@@ -0,0 +1,26 @@
+package httputils
+
+import (
+	"context"
+	"net/http"
+)
+
+type introspectionKey struct{}
+
+// WithIntrospection returns shallow copy of request with result of introspection in context
+func WithIntrospection(r *http.Request, content []byte) *http.Request {
+	if len(content) == 0 {
+		return r
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), introspectionKey{}, content))
+}
+
+// GetIntrospection returns result of introspection from request context
+func GetIntrospection(r *http.Request) []byte {
+	if v, ok := r.Context().Value(introspectionKey{}).([]byte); ok {
+		return v
+	}
+
+	return nil
+}
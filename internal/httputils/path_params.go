@@ -0,0 +1,38 @@
+package httputils
+
+import (
+	"context"
+	"net/http"
+)
+
+type pathParamsKey struct{}
+
+// PathParams contains values of named parameters and wildcards matched in request path
+type PathParams map[string]string
+
+// WithPathParams returns shallow copy of request with path parameters in context
+func WithPathParams(r *http.Request, params PathParams) *http.Request {
+	if len(params) == 0 {
+		return r
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), pathParamsKey{}, params))
+}
+
+// GetPathParams returns path parameters from request context
+func GetPathParams(r *http.Request) PathParams {
+	if v, ok := r.Context().Value(pathParamsKey{}).(PathParams); ok {
+		return v
+	}
+
+	return nil
+}
+
+// Get returns value of path parameter by name
+func (p PathParams) Get(name string) string {
+	if p == nil {
+		return ""
+	}
+
+	return p[name]
+}
@@ -0,0 +1,98 @@
+// Package jsonpath resolves simple dot separated paths of JSON documents, e.g. $.refresh.counter
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	pathSeparator = "."
+	pathRootAlias = "$"
+)
+
+var (
+	ErrBadPath   = errors.New("path does not exist in document")
+	ErrNotObject = errors.New("parent of path is not an object")
+	ErrTrailing  = errors.New("trailing data after JSON document")
+)
+
+// Decode decodes JSON, the numbers are kept as is, so big integers don't lose precision
+func Decode(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, ErrTrailing
+	}
+
+	return doc, nil
+}
+
+// Split returns names of fields of path, root path has no names
+func Split(path string) []string {
+	path = strings.TrimPrefix(path, pathRootAlias)
+	path = strings.Trim(path, pathSeparator)
+	if path == "" {
+		return nil
+	}
+
+	return strings.Split(path, pathSeparator)
+}
+
+// Get returns value of field by names
+func Get(doc interface{}, names []string) (interface{}, error) {
+	for _, name := range names {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, ErrNotObject
+		}
+
+		if doc, ok = m[name]; !ok {
+			return nil, ErrBadPath
+		}
+	}
+
+	return doc, nil
+}
+
+// Set sets value of field by names, the parent of field must exist
+func Set(doc interface{}, names []string, value interface{}) error {
+	parent, err := Get(doc, names[:len(names)-1])
+	if err != nil {
+		return err
+	}
+
+	m, ok := parent.(map[string]interface{})
+	if !ok {
+		return ErrNotObject
+	}
+
+	m[names[len(names)-1]] = value
+
+	return nil
+}
+
+// Delete deletes field by names, the missing field and root path are ignored
+func Delete(doc interface{}, names []string) {
+	if len(names) == 0 {
+		return
+	}
+
+	parent, err := Get(doc, names[:len(names)-1])
+	if err != nil {
+		return
+	}
+
+	if m, ok := parent.(map[string]interface{}); ok {
+		delete(m, names[len(names)-1])
+	}
+}
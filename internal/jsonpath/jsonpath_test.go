@@ -0,0 +1,58 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{path: "", expected: nil},
+		{path: ".", expected: nil},
+		{path: "$", expected: nil},
+		{path: "uuid", expected: []string{"uuid"}},
+		{path: ".uuid", expected: []string{"uuid"}},
+		{path: "$.refresh.counter", expected: []string{"refresh", "counter"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.path, func(t *testing.T) {
+			require.Equal(t, tt.expected, Split(tt.path))
+		})
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	doc, err := Decode([]byte(`{"uuid":"id","refresh":{"counter":12345678901234567890},"list":[]}`))
+	require.Nil(t, err)
+
+	v, err := Get(doc, Split(".uuid"))
+	require.Nil(t, err)
+	require.Equal(t, "id", v)
+
+	_, err = Get(doc, Split(".unknown"))
+	require.Equal(t, ErrBadPath, err)
+
+	_, err = Get(doc, Split(".uuid.value"))
+	require.Equal(t, ErrNotObject, err)
+
+	err = Set(doc, Split(".refresh.time"), "1s")
+	require.Nil(t, err)
+
+	err = Set(doc, Split(".unknown.time"), "1s")
+	require.Equal(t, ErrBadPath, err)
+
+	Delete(doc, Split(".uuid"))
+	Delete(doc, Split(".unknown.uuid"))
+
+	// The numbers and empty arrays are kept as is
+	data, err := json.Marshal(doc)
+	require.Nil(t, err)
+	require.JSONEq(t, `{"refresh":{"counter":12345678901234567890,"time":"1s"},"list":[]}`, string(data))
+}
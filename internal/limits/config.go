@@ -21,6 +21,8 @@ type Config struct {
 	Header helper.Arguments
 	// Cookie is name of cookie in request for limit
 	Cookie helper.Arguments
+	// PathParam is name of named parameter or wildcard in route path for limit
+	PathParam helper.Arguments
 	// Limit Count per Time period
 	// MaxCounter limits count of request to API
 	MaxCounter int
@@ -46,6 +48,7 @@ func (c *Config) Merge(target *Config) *Config {
 	result := &Config{
 		Header:     c.Header,
 		Cookie:     c.Cookie,
+		PathParam:  c.PathParam,
 		MaxCounter: c.MaxCounter,
 		TTL:        c.TTL,
 	}
@@ -72,6 +75,15 @@ func (c *Config) Merge(target *Config) *Config {
 		}
 	}
 
+	if len(target.PathParam) > 0 {
+		for _, v := range target.PathParam {
+			if result.PathParam.Matches(v) {
+				continue
+			}
+			result.PathParam = append(result.PathParam, v)
+		}
+	}
+
 	if target.MaxCounter > 0 {
 		result.MaxCounter = target.MaxCounter
 	}
@@ -5,6 +5,8 @@ import (
 	"encoding/base64"
 	"net/http"
 	"strings"
+
+	"github.com/soldatov-s/accp/internal/httputils"
 )
 
 // LimitedParamsOfRequest is a map of limited params from http request
@@ -20,6 +22,7 @@ func NewLimitedParamsOfRequest(mc MapConfig, r *http.Request) (LimitedParamsOfRe
 	l := make(LimitedParamsOfRequest)
 
 	var err error
+	pathParams := httputils.GetPathParams(r)
 	for k, v := range mc {
 		for _, vv := range v.Header {
 			if h := r.Header.Get(vv); h != "" {
@@ -49,6 +52,17 @@ func NewLimitedParamsOfRequest(mc MapConfig, r *http.Request) (LimitedParamsOfRe
 				l[strings.ToLower(k)] = h
 			}
 		}
+
+		for _, vv := range v.PathParam {
+			if p := pathParams.Get(vv); p != "" {
+				var h string
+				h, err = limitHash(p)
+				if err != nil {
+					return nil, err
+				}
+				l[strings.ToLower(k)] = h
+			}
+		}
 	}
 
 	return l, nil
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/soldatov-s/accp/internal/httputils"
 	testProxyHelpers "github.com/soldatov-s/accp/x/test_helpers/proxy"
 	"github.com/stretchr/testify/require"
 )
@@ -14,6 +15,9 @@ const (
 	testUserCookieName  = "user-cookie"
 	testUserCookieValue = "test_value"
 	testItemUser        = "useritem"
+	testItemUserID      = "userid"
+	testUserIDParam     = "id"
+	testUserIDValue     = "42"
 )
 
 // nolint : funlen
@@ -183,6 +187,28 @@ func TestNewLimitedParamsOfRequest(t *testing.T) {
 				require.Equal(t, hashedValue, v)
 			},
 		},
+		{
+			name: "get user id from path parameter",
+			testFunc: func() {
+				mc := NewMapConfig()
+				mc[testItemUserID] = &Config{PathParam: []string{testUserIDParam}}
+				req, err := http.NewRequest(http.MethodGet, testProxyHelpers.DefaultFakeServiceURL+"/api/v1/users/"+testUserIDValue, nil)
+				require.Nil(t, err)
+
+				req = httputils.WithPathParams(req, httputils.PathParams{testUserIDParam: testUserIDValue})
+
+				lp, err := NewLimitedParamsOfRequest(mc, req)
+				require.Nil(t, err)
+				require.NotNil(t, lp)
+				require.Equal(t, 1, len(lp))
+
+				v, ok := lp[testItemUserID]
+				require.True(t, ok)
+				hashedValue, err := limitHash(testUserIDValue)
+				require.Nil(t, err)
+				require.Equal(t, hashedValue, v)
+			},
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
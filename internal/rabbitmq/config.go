@@ -14,6 +14,9 @@ type Config struct {
 	DSN           string
 	BackoffPolicy []time.Duration
 	ExchangeName  string
+	// PurgeExchangeName is a fanout exchange with messages for purging cache by tags,
+	// empty name disables consuming of purge messages
+	PurgeExchangeName string
 }
 
 func defaultBackoffPolicy() []time.Duration {
@@ -51,9 +54,10 @@ func (c *Config) Merge(target *Config) *Config {
 	}
 
 	result := &Config{
-		DSN:           c.DSN,
-		BackoffPolicy: c.BackoffPolicy,
-		ExchangeName:  c.ExchangeName,
+		DSN:               c.DSN,
+		BackoffPolicy:     c.BackoffPolicy,
+		ExchangeName:      c.ExchangeName,
+		PurgeExchangeName: c.PurgeExchangeName,
 	}
 
 	if target == nil {
@@ -72,5 +76,9 @@ func (c *Config) Merge(target *Config) *Config {
 		result.ExchangeName = target.ExchangeName
 	}
 
+	if target.PurgeExchangeName != "" {
+		result.PurgeExchangeName = target.PurgeExchangeName
+	}
+
 	return result
 }
@@ -45,10 +45,14 @@ func TestMerge(t *testing.T) {
 			expectedConfig: &Config{DSN: "test", ExchangeName: "test", BackoffPolicy: []time.Duration{2 * time.Second}},
 		},
 		{
-			name:           "target is not nil",
-			srcConfig:      &Config{DSN: "test", ExchangeName: "test", BackoffPolicy: []time.Duration{2 * time.Second}},
-			targetConfig:   &Config{DSN: "test2", ExchangeName: "test2", BackoffPolicy: []time.Duration{5 * time.Second}},
-			expectedConfig: &Config{DSN: "test2", ExchangeName: "test2", BackoffPolicy: []time.Duration{5 * time.Second}},
+			name:      "target is not nil",
+			srcConfig: &Config{DSN: "test", ExchangeName: "test", BackoffPolicy: []time.Duration{2 * time.Second}},
+			targetConfig: &Config{
+				DSN: "test2", ExchangeName: "test2", BackoffPolicy: []time.Duration{5 * time.Second}, PurgeExchangeName: "purge",
+			},
+			expectedConfig: &Config{
+				DSN: "test2", ExchangeName: "test2", BackoffPolicy: []time.Duration{5 * time.Second}, PurgeExchangeName: "purge",
+			},
 		},
 	}
 
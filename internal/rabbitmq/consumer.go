@@ -0,0 +1,161 @@
+package rabbitmq
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/soldatov-s/accp/internal/logger"
+	"github.com/streadway/amqp"
+)
+
+// Handler handles body of consumed message
+type Handler func(body []byte) error
+
+// Consumer consumes messages from fanout exchange, every instance has own exclusive queue,
+// so every instance gets all messages
+type Consumer struct {
+	ctx          context.Context
+	log          zerolog.Logger
+	cfg          *Config
+	exchangeName string
+	handler      Handler
+
+	mu                sync.Mutex
+	conn              *amqp.Connection
+	weAreShuttingDown bool
+}
+
+func NewConsumer(ctx context.Context, cfg *Config, exchangeName string, handler Handler) *Consumer {
+	return &Consumer{
+		ctx:          ctx,
+		log:          logger.GetPackageLogger(ctx, empty{}),
+		cfg:          cfg,
+		exchangeName: exchangeName,
+		handler:      handler,
+	}
+}
+
+func (c *Consumer) Start() error {
+	deliveries, err := c.connect()
+	if err != nil {
+		return err
+	}
+
+	go c.consume(deliveries)
+
+	c.log.Info().Msgf("consumer of exchange %s started", c.exchangeName)
+
+	return nil
+}
+
+func (c *Consumer) connect() (<-chan amqp.Delivery, error) {
+	conn, err := amqp.Dial(c.cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := c.subscribe(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+
+	return deliveries, nil
+}
+
+func (c *Consumer) subscribe(conn *amqp.Connection) (<-chan amqp.Delivery, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = channel.ExchangeDeclare(c.exchangeName, "fanout", true, false, false, false, nil); err != nil {
+		return nil, err
+	}
+
+	// The queue with generated name is deleted when connection is closed
+	queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = channel.QueueBind(queue.Name, "", c.exchangeName, false, nil); err != nil {
+		return nil, err
+	}
+
+	return channel.Consume(queue.Name, "", true, true, false, false, nil)
+}
+
+// consume handles messages and reconnects if connection was lost
+func (c *Consumer) consume(deliveries <-chan amqp.Delivery) {
+	for {
+		for d := range deliveries {
+			if err := c.handler(d.Body); err != nil {
+				c.log.Error().Err(err).Msgf("failed to handle message from exchange %s", c.exchangeName)
+			}
+		}
+
+		if c.shuttingDown() {
+			return
+		}
+
+		c.log.Error().Msgf("rabbitmq consumer of exchange %s unexpected closed", c.exchangeName)
+		deliveries = c.reconnect()
+		if deliveries == nil {
+			return
+		}
+	}
+}
+
+// reconnect tries to connect by backoff policy, the last period of policy is repeated,
+// it returns nil if consumer is shutting down
+func (c *Consumer) reconnect() <-chan amqp.Delivery {
+	for i := 0; ; i++ {
+		if c.shuttingDown() {
+			return nil
+		}
+
+		deliveries, err := c.connect()
+		if err == nil {
+			return deliveries
+		}
+
+		period := c.cfg.BackoffPolicy[len(c.cfg.BackoffPolicy)-1]
+		if i < len(c.cfg.BackoffPolicy) {
+			period = c.cfg.BackoffPolicy[i]
+		}
+
+		c.log.Error().Msgf("can't reconnect consumer to rabbit %s, next try in %s", err, period)
+		time.Sleep(period)
+	}
+}
+
+func (c *Consumer) shuttingDown() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.weAreShuttingDown
+}
+
+func (c *Consumer) Shutdown() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.weAreShuttingDown = true
+	if c.conn == nil {
+		return nil
+	}
+
+	c.log.Info().Msgf("closing consumer of exchange %s...", c.exchangeName)
+
+	err := c.conn.Close()
+	c.conn = nil
+
+	return err
+}
@@ -27,6 +27,7 @@ type Publish struct {
 	Conn              *amqp.Connection
 	Channel           *amqp.Channel
 	weAreShuttingDown bool
+	consumers         []*Consumer
 
 	// Metrics
 	metrics.Service
@@ -63,9 +64,25 @@ func (p *Publish) Start() error {
 
 	p.log.Info().Msg("publisher connection established")
 
+	for _, c := range p.consumers {
+		if err := c.Start(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// ConsumePurge registers handler of messages from purge exchange, it does nothing
+// if purge exchange is not configured. The handler must be registered before start.
+func (p *Publish) ConsumePurge(handler Handler) {
+	if p == nil || p.cfg.PurgeExchangeName == "" {
+		return
+	}
+
+	p.consumers = append(p.consumers, NewConsumer(p.ctx, p.cfg, p.cfg.PurgeExchangeName, handler))
+}
+
 func (p *Publish) connectPublisher() error {
 	var err error
 
@@ -79,7 +96,17 @@ func (p *Publish) connectPublisher() error {
 		return err
 	}
 
-	return p.Channel.ExchangeDeclare(p.cfg.ExchangeName, "direct", true,
+	if err = p.Channel.ExchangeDeclare(p.cfg.ExchangeName, "direct", true,
+		false, false,
+		false, nil); err != nil {
+		return err
+	}
+
+	if p.cfg.PurgeExchangeName == "" {
+		return nil
+	}
+
+	return p.Channel.ExchangeDeclare(p.cfg.PurgeExchangeName, "fanout", true,
 		false, false,
 		false, nil)
 }
@@ -110,6 +137,12 @@ func (p *Publish) Shutdown() error {
 
 	p.weAreShuttingDown = true
 
+	for _, c := range p.consumers {
+		if err := c.Shutdown(); err != nil {
+			p.log.Error().Err(err).Msg("failed to close consumer connection")
+		}
+	}
+
 	p.log.Info().Msg("closing queue publisher connection...")
 
 	err := p.Channel.Close()
@@ -138,9 +171,28 @@ func (p *Publish) SendMessage(message interface{}, routingKey string) error {
 		return err
 	}
 
-	p.log.Debug().Msgf("exchangeName %s, routingKey %s, send message: %s", p.cfg.ExchangeName, routingKey, string(body))
+	return p.publish(p.cfg.ExchangeName, routingKey, body)
+}
+
+// PublishPurge publishes message to purge exchange, so all instances purge their caches.
+// It does nothing if purge exchange is not configured.
+func (p *Publish) PublishPurge(message interface{}) error {
+	if p == nil || p.cfg.PurgeExchangeName == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return p.publish(p.cfg.PurgeExchangeName, "", body)
+}
+
+func (p *Publish) publish(exchangeName, routingKey string, body []byte) error {
+	p.log.Debug().Msgf("exchangeName %s, routingKey %s, send message: %s", exchangeName, routingKey, string(body))
 
-	err = p.Channel.Publish(p.cfg.ExchangeName, routingKey, false,
+	err := p.Channel.Publish(exchangeName, routingKey, false,
 		false, amqp.Publishing{ContentType: "text/plain", Body: body})
 	if err != nil {
 		for _, i := range p.cfg.BackoffPolicy {
@@ -153,7 +205,7 @@ func (p *Publish) SendMessage(message interface{}, routingKey string) error {
 			break
 		}
 
-		pubErr := p.Channel.Publish(p.cfg.ExchangeName, routingKey, false,
+		pubErr := p.Channel.Publish(exchangeName, routingKey, false,
 			false, amqp.Publishing{ContentType: "text/plain", Body: body})
 		if pubErr != nil {
 			p.log.Error().Msgf("failed to publish a message %s", pubErr)
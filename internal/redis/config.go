@@ -4,12 +4,23 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	accperrors "github.com/soldatov-s/accp/internal/errors"
 )
 
 const (
 	defaultMinIdleConnections   = 10
 	defaultMaxOpenedConnections = 30
 	defaultMaxConnLifetime      = time.Second * 10
+
+	// BackendReJSON stores documents by commands of RedisJSON module
+	BackendReJSON = "rejson"
+	// BackendPlain stores documents as strings, it works with Redis without modules
+	BackendPlain = "plain"
+
+	modeSingle   = "single"
+	modeSentinel = "sentinel"
+	modeCluster  = "cluster"
 )
 
 type Config struct {
@@ -17,6 +28,16 @@ type Config struct {
 	MinIdleConnections    int
 	MaxOpenedConnections  int
 	MaxConnectionLifetime time.Duration
+	// Backend is a way to store documents, rejson or plain, default rejson
+	Backend string
+	// SentinelMaster is a name of master monitored by sentinels, it enables sentinel mode
+	SentinelMaster string
+	// SentinelAddrs are host:port addresses of sentinels
+	SentinelAddrs []string
+	// SentinelPassword is a password of sentinels, the password of master is taken from DSN
+	SentinelPassword string
+	// ClusterAddrs are host:port addresses of seed nodes, they enable cluster mode
+	ClusterAddrs []string
 }
 
 func (c *Config) SetDefault() {
@@ -31,6 +52,38 @@ func (c *Config) SetDefault() {
 	if c.MaxOpenedConnections == 0 {
 		c.MaxOpenedConnections = defaultMaxOpenedConnections
 	}
+
+	if c.Backend == "" {
+		c.Backend = BackendReJSON
+	}
+}
+
+func (c *Config) Validate() error {
+	if c.Backend != BackendReJSON && c.Backend != BackendPlain {
+		return errors.Wrap(ErrUnknownBackend, c.Backend)
+	}
+
+	if c.SentinelMaster != "" && len(c.ClusterAddrs) > 0 {
+		return ErrSentinelAndCluster
+	}
+
+	if c.SentinelMaster != "" && len(c.SentinelAddrs) == 0 {
+		return accperrors.EmptyConfigParameter("sentineladdrs")
+	}
+
+	return nil
+}
+
+// mode returns mode of connection, the sentinel and cluster modes are enabled by their addresses
+func (c *Config) mode() string {
+	switch {
+	case c.SentinelMaster != "":
+		return modeSentinel
+	case len(c.ClusterAddrs) > 0:
+		return modeCluster
+	default:
+		return modeSingle
+	}
 }
 
 func (c *Config) Options() (*redis.Options, error) {
@@ -47,3 +100,49 @@ func (c *Config) Options() (*redis.Options, error) {
 
 	return connOptions, nil
 }
+
+// UniversalOptions returns options for single node, sentinel or cluster mode. The DSN is required
+// in single mode, in other modes it is optional and gives credentials, database and TLS.
+func (c *Config) UniversalOptions() (*redis.UniversalOptions, error) {
+	opt := &redis.Options{}
+	if c.DSN != "" || c.mode() == modeSingle {
+		var err error
+		if opt, err = c.Options(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &redis.UniversalOptions{
+		Addrs:        []string{opt.Addr},
+		DB:           opt.DB,
+		Username:     opt.Username,
+		Password:     opt.Password,
+		TLSConfig:    opt.TLSConfig,
+		MaxConnAge:   c.MaxConnectionLifetime,
+		MinIdleConns: c.MinIdleConnections,
+		PoolSize:     c.MaxOpenedConnections,
+	}
+
+	switch c.mode() {
+	case modeSentinel:
+		result.Addrs = c.SentinelAddrs
+		result.MasterName = c.SentinelMaster
+		result.SentinelPassword = c.SentinelPassword
+	case modeCluster:
+		result.Addrs = c.ClusterAddrs
+	}
+
+	return result, nil
+}
+
+// newUniversalClient returns client for mode of config, the cluster with one seed node is still a cluster
+func (c *Config) newUniversalClient(opt *redis.UniversalOptions) redis.UniversalClient {
+	switch c.mode() {
+	case modeSentinel:
+		return redis.NewFailoverClient(opt.Failover())
+	case modeCluster:
+		return redis.NewClusterClient(opt.Cluster())
+	default:
+		return redis.NewClient(opt.Simple())
+	}
+}
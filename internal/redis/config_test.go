@@ -1,8 +1,11 @@
 package redis
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/go-redis/redis/v8"
+	accperrors "github.com/soldatov-s/accp/internal/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -16,6 +19,88 @@ func TestSetDefault(t *testing.T) {
 	require.Equal(t, defaultMaxConnLifetime, c.MaxConnectionLifetime)
 	require.Equal(t, defaultMaxOpenedConnections, c.MaxOpenedConnections)
 	require.Equal(t, defaultMinIdleConnections, c.MinIdleConnections)
+	require.Equal(t, BackendReJSON, c.Backend)
+}
+
+func TestValidate(t *testing.T) {
+	c := &Config{}
+	c.SetDefault()
+	require.Nil(t, c.Validate())
+
+	c.Backend = BackendPlain
+	require.Nil(t, c.Validate())
+
+	c.Backend = "unknown"
+	require.True(t, errors.Is(c.Validate(), ErrUnknownBackend))
+
+	c.Backend = BackendPlain
+	c.SentinelMaster = "mymaster"
+	require.Equal(t, accperrors.EmptyConfigParameter("sentineladdrs"), c.Validate())
+
+	c.SentinelAddrs = []string{"sentinel1:26379", "sentinel2:26379"}
+	require.Nil(t, c.Validate())
+
+	c.ClusterAddrs = []string{"node1:6379"}
+	require.Equal(t, ErrSentinelAndCluster, c.Validate())
+}
+
+func TestUniversalOptions(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          *Config
+		expectedMode string
+		expectedOpt  *redis.UniversalOptions
+	}{
+		{
+			name:         "single node",
+			cfg:          &Config{DSN: "redis://:secret@redis:6379/2"},
+			expectedMode: modeSingle,
+			expectedOpt:  &redis.UniversalOptions{Addrs: []string{"redis:6379"}, DB: 2, Password: "secret"},
+		},
+		{
+			name: "sentinel",
+			cfg: &Config{
+				DSN:              "redis://:secret@/1",
+				SentinelMaster:   "mymaster",
+				SentinelAddrs:    []string{"sentinel1:26379", "sentinel2:26379"},
+				SentinelPassword: "sentinel",
+			},
+			expectedMode: modeSentinel,
+			expectedOpt: &redis.UniversalOptions{
+				Addrs:            []string{"sentinel1:26379", "sentinel2:26379"},
+				DB:               1,
+				Password:         "secret",
+				MasterName:       "mymaster",
+				SentinelPassword: "sentinel",
+			},
+		},
+		{
+			name:         "cluster without dsn",
+			cfg:          &Config{ClusterAddrs: []string{"node1:6379"}},
+			expectedMode: modeCluster,
+			expectedOpt:  &redis.UniversalOptions{Addrs: []string{"node1:6379"}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.SetDefault()
+			tt.expectedOpt.MaxConnAge = defaultMaxConnLifetime
+			tt.expectedOpt.MinIdleConns = defaultMinIdleConnections
+			tt.expectedOpt.PoolSize = defaultMaxOpenedConnections
+
+			opt, err := tt.cfg.UniversalOptions()
+			require.Nil(t, err)
+			require.Equal(t, tt.expectedOpt, opt)
+			require.Equal(t, tt.expectedMode, tt.cfg.mode())
+		})
+	}
+
+	c := &Config{}
+	c.SetDefault()
+	_, err := c.UniversalOptions()
+	require.NotNil(t, err)
 }
 
 func TestOptions(t *testing.T) {
@@ -0,0 +1,9 @@
+package redis
+
+import "errors"
+
+var (
+	ErrUnknownBackend     = errors.New("unknown redis backend")
+	ErrSentinelAndCluster = errors.New("sentinel and cluster modes are enabled together")
+	ErrTxRetries          = errors.New("document is changed concurrently, retries are exhausted")
+)
@@ -0,0 +1,176 @@
+package redis
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/soldatov-s/accp/internal/jsonpath"
+)
+
+// plainStore stores documents as strings by plain commands, so it works without RedisJSON module.
+// The paths are resolved on client side, the document is changed in transaction.
+// maxTxRetries is a number of attempts to change document which is changed concurrently
+const maxTxRetries = 10
+
+type plainStore struct {
+	conn redis.UniversalClient
+}
+
+func (s *plainStore) setWithExpire(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	v, ok := value.(encoding.BinaryMarshaler)
+	if !ok {
+		return errors.New("typecast to BinaryMarshaler failed")
+	}
+
+	data, err := v.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return s.conn.Set(ctx, key, data, ttl).Err()
+}
+
+func (s *plainStore) get(ctx context.Context, key, path string, value interface{}) error {
+	data, err := s.conn.Get(ctx, key).Bytes()
+	if err != nil {
+		return err
+	}
+
+	names := jsonpath.Split(path)
+	if len(names) > 0 {
+		var doc interface{}
+		if doc, err = jsonpath.Decode(data); err != nil {
+			return err
+		}
+
+		if doc, err = jsonpath.Get(doc, names); err != nil {
+			return err
+		}
+
+		if data, err = json.Marshal(doc); err != nil {
+			return err
+		}
+	}
+
+	if u, ok := value.(encoding.BinaryUnmarshaler); ok {
+		return u.UnmarshalBinary(data)
+	}
+
+	return json.Unmarshal(data, value)
+}
+
+func (s *plainStore) set(ctx context.Context, key, path, data string, nx bool) error {
+	names := jsonpath.Split(path)
+	if len(names) == 0 {
+		if !nx {
+			return s.replace(ctx, key, data)
+		}
+
+		ok, err := s.conn.SetNX(ctx, key, data, 0).Result()
+		if err != nil {
+			return err
+		}
+
+		// The same answer as RedisJSON gives on existing document
+		if !ok {
+			return redis.Nil
+		}
+
+		return nil
+	}
+
+	value, err := jsonpath.Decode([]byte(data))
+	if err != nil {
+		return err
+	}
+
+	return s.update(ctx, key, func(doc interface{}) error {
+		if _, errGet := jsonpath.Get(doc, names); nx && errGet == nil {
+			return redis.Nil
+		}
+
+		return jsonpath.Set(doc, names, value)
+	})
+}
+
+func (s *plainStore) del(ctx context.Context, key, path string) error {
+	names := jsonpath.Split(path)
+	if len(names) == 0 {
+		return s.conn.Del(ctx, key).Err()
+	}
+
+	return s.update(ctx, key, func(doc interface{}) error {
+		jsonpath.Delete(doc, names)
+		return nil
+	})
+}
+
+// replace sets document, the TTL of document is kept
+func (s *plainStore) replace(ctx context.Context, key, data string) error {
+	return s.transaction(ctx, key, func(tx *redis.Tx) (interface{}, error) {
+		return data, nil
+	})
+}
+
+// update changes document by f in transaction, the TTL of document is kept
+func (s *plainStore) update(ctx context.Context, key string, f func(doc interface{}) error) error {
+	return s.transaction(ctx, key, func(tx *redis.Tx) (interface{}, error) {
+		data, err := tx.Get(ctx, key).Bytes()
+		if err != nil {
+			return nil, err
+		}
+
+		doc, err := jsonpath.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = f(doc); err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(doc)
+	})
+}
+
+// transaction sets value given by f, the key is watched and the transaction is retried
+// if the key was changed by other client.
+// The TTL is read by PTTL and set again instead of KEEPTTL option, which requires Redis 6.
+func (s *plainStore) transaction(ctx context.Context, key string, f func(tx *redis.Tx) (interface{}, error)) error {
+	txf := func(tx *redis.Tx) error {
+		value, err := f(tx)
+		if err != nil {
+			return err
+		}
+
+		ttl, err := tx.PTTL(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+
+		// The key without expire or missing key is set without expire
+		if ttl < 0 {
+			ttl = 0
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, value, ttl)
+			return nil
+		})
+
+		return err
+	}
+
+	for i := 0; i < maxTxRetries; i++ {
+		err := s.conn.Watch(ctx, txf, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+
+	return ErrTxRetries
+}
@@ -0,0 +1,158 @@
+package redis
+
+import (
+	"github.com/go-redis/redis/v8"
+)
+
+// messagesQueueSize is a size of queue of received messages, it is the same as go-redis uses by default
+const messagesQueueSize = 100
+
+// Publish publishes message to channel
+func (r *Client) Publish(channel, message string) error {
+	if err := r.Conn.Publish(r.ctx, channel, message).Err(); err != nil {
+		return err
+	}
+
+	r.log.Debug().Msgf("publish message to channel %s", channel)
+
+	return nil
+}
+
+// Subscribe registers handler of messages from channel. All channels are subscribed by one connection,
+// the handlers registered before start are subscribed on start.
+func (r *Client) Subscribe(channel string, handler func(payload string)) error {
+	r.subMu.Lock()
+	defer r.subMu.Unlock()
+
+	if r.handlers == nil {
+		r.handlers = make(map[string][]func(payload string))
+	}
+
+	_, subscribed := r.handlers[channel]
+	r.handlers[channel] = append(r.handlers[channel], handler)
+
+	if r.Conn == nil || subscribed {
+		return nil
+	}
+
+	return r.subscribeLocked(channel)
+}
+
+// OnResubscribe registers handler which is called after subscription to channel is restored on reconnect,
+// the messages published while connection was lost are not received
+func (r *Client) OnResubscribe(channel string, handler func()) error {
+	r.subMu.Lock()
+	defer r.subMu.Unlock()
+
+	if r.resubscribeHandlers == nil {
+		r.resubscribeHandlers = make(map[string][]func())
+	}
+
+	r.resubscribeHandlers[channel] = append(r.resubscribeHandlers[channel], handler)
+
+	return nil
+}
+
+// startSubscriptions subscribes channels of handlers registered before start
+func (r *Client) startSubscriptions() error {
+	r.subMu.Lock()
+	defer r.subMu.Unlock()
+
+	if len(r.handlers) == 0 {
+		return nil
+	}
+
+	channels := make([]string, 0, len(r.handlers))
+	for channel := range r.handlers {
+		channels = append(channels, channel)
+	}
+
+	return r.subscribeLocked(channels...)
+}
+
+func (r *Client) subscribeLocked(channels ...string) error {
+	if r.pubsub != nil {
+		return r.pubsub.Subscribe(r.ctx, channels...)
+	}
+
+	r.pubsub = r.Conn.Subscribe(r.ctx, channels...)
+	// Receive waits confirmation of subscription, so messages published after it are not lost
+	msg, err := r.pubsub.Receive(r.ctx)
+	if err != nil {
+		_ = r.pubsub.Close()
+		r.pubsub = nil
+		return err
+	}
+
+	r.subscribed = make(map[string]bool)
+	if sub, ok := msg.(*redis.Subscription); ok {
+		r.subscribed[sub.Channel] = true
+	}
+
+	// The confirmations of subscriptions are received with messages, so the reconnect is found
+	go r.listen(r.pubsub.ChannelWithSubscriptions(r.ctx, messagesQueueSize))
+
+	r.log.Info().Msgf("subscribed to channels %v", channels)
+
+	return nil
+}
+
+// listen passes messages to handlers until subscription is closed
+func (r *Client) listen(messages <-chan interface{}) {
+	for m := range messages {
+		switch msg := m.(type) {
+		case *redis.Subscription:
+			r.confirm(msg)
+		case *redis.Message:
+			r.subMu.Lock()
+			handlers := r.handlers[msg.Channel]
+			r.subMu.Unlock()
+
+			for _, handler := range handlers {
+				handler(msg.Payload)
+			}
+		}
+	}
+}
+
+// confirm remembers confirmed subscription, the repeated confirmation means that subscription
+// was restored after reconnect, so the resubscribe handlers of channel are called
+func (r *Client) confirm(sub *redis.Subscription) {
+	if sub.Kind != "subscribe" {
+		return
+	}
+
+	r.subMu.Lock()
+	if r.subscribed == nil {
+		r.subMu.Unlock()
+		return
+	}
+	resubscribed := r.subscribed[sub.Channel]
+	r.subscribed[sub.Channel] = true
+	handlers := r.resubscribeHandlers[sub.Channel]
+	r.subMu.Unlock()
+
+	if !resubscribed {
+		return
+	}
+
+	r.log.Info().Msgf("resubscribed to channel %s", sub.Channel)
+	for _, handler := range handlers {
+		handler()
+	}
+}
+
+func (r *Client) closeSubscriptions() error {
+	r.subMu.Lock()
+	defer r.subMu.Unlock()
+
+	if r.pubsub == nil {
+		return nil
+	}
+
+	err := r.pubsub.Close()
+	r.pubsub = nil
+	r.subscribed = nil
+
+	return err
+}
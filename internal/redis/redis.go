@@ -3,6 +3,7 @@ package redis
 import (
 	"context"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -18,10 +19,19 @@ type empty struct{}
 
 type Client struct {
 	Conn *rejson.Client
-	opt  *redis.Options
+	opt  *redis.UniversalOptions
 	ctx  context.Context
 	log  zerolog.Logger
 	cfg  *Config
+	docs documentStore
+
+	subMu    sync.Mutex
+	pubsub   *redis.PubSub
+	handlers map[string][]func(payload string)
+	// resubscribeHandlers are called after subscription to channel is restored on reconnect
+	resubscribeHandlers map[string][]func()
+	// subscribed are channels which subscription is confirmed
+	subscribed map[string]bool
 
 	// Metrics
 	metrics.Service
@@ -34,8 +44,12 @@ func NewClient(ctx context.Context, cfg *Config) (*Client, error) {
 
 	cfg.SetDefault()
 
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	// Connect to database.
-	connOptions, err := cfg.Options()
+	connOptions, err := cfg.UniversalOptions()
 	if err != nil {
 		return nil, err
 	}
@@ -53,20 +67,25 @@ func NewClient(ctx context.Context, cfg *Config) (*Client, error) {
 }
 
 func (r *Client) Start() error {
-	client := redis.NewClient(r.opt)
+	client := r.cfg.newUniversalClient(r.opt)
 	if err := client.Ping(r.ctx).Err(); err != nil {
 		return err
 	}
 
 	r.Conn = rejson.ExtendClient(client)
 
+	r.docs = &rejsonStore{conn: r.Conn}
+	if r.cfg.Backend == BackendPlain {
+		r.docs = &plainStore{conn: client}
+	}
+
 	r.log.Info().Msg("redis connection established")
 
-	return nil
+	return r.startSubscriptions()
 }
 
 func (r *Client) Add(key string, value interface{}, ttl time.Duration) error {
-	err := r.Conn.JSONSetWithExpire(r.ctx, key, ".", value, ttl)
+	err := r.docs.setWithExpire(r.ctx, key, value, ttl)
 	if err != nil {
 		return err
 	}
@@ -77,15 +96,7 @@ func (r *Client) Add(key string, value interface{}, ttl time.Duration) error {
 }
 
 func (r *Client) Select(key string, value interface{}) error {
-	cmdString := r.Conn.JSONGet(r.ctx, key)
-	_, err := cmdString.Result()
-
-	if err != nil {
-		return err
-	}
-
-	err = cmdString.Scan(value)
-	if err != nil {
+	if err := r.docs.get(r.ctx, key, "", value); err != nil {
 		return err
 	}
 
@@ -107,7 +118,7 @@ func (r *Client) Expire(key string, ttl time.Duration) error {
 }
 
 func (r *Client) Update(key string, value interface{}, ttl time.Duration) error {
-	err := r.Conn.JSONSetWithExpire(r.ctx, key, ".", value, ttl)
+	err := r.docs.setWithExpire(r.ctx, key, value, ttl)
 	if err != nil {
 		return err
 	}
@@ -119,15 +130,7 @@ func (r *Client) Update(key string, value interface{}, ttl time.Duration) error
 
 // JSONGet item from cache by key.
 func (r *Client) JSONGet(key, path string, value interface{}) error {
-	cmdString := r.Conn.JSONGet(r.ctx, key, path)
-	_, err := cmdString.Result()
-
-	if err != nil {
-		return err
-	}
-
-	err = cmdString.Scan(value)
-	if err != nil {
+	if err := r.docs.get(r.ctx, key, path, value); err != nil {
 		return err
 	}
 
@@ -138,8 +141,7 @@ func (r *Client) JSONGet(key, path string, value interface{}) error {
 
 // JSONSet item in cache by key.
 func (r *Client) JSONSet(key, path, json string) error {
-	_, err := r.Conn.JSONSet(r.ctx, key, path, json).Result()
-	if err != nil {
+	if err := r.docs.set(r.ctx, key, path, json, false); err != nil {
 		return err
 	}
 
@@ -150,8 +152,7 @@ func (r *Client) JSONSet(key, path, json string) error {
 
 // JSONSetNX item in cache by key.
 func (r *Client) JSONSetNX(key, path, json string) error {
-	_, err := r.Conn.JSONSet(r.ctx, key, path, json, "NX").Result()
-	if err != nil {
+	if err := r.docs.set(r.ctx, key, path, json, true); err != nil {
 		return err
 	}
 
@@ -161,8 +162,7 @@ func (r *Client) JSONSetNX(key, path, json string) error {
 }
 
 func (r *Client) JSONDelete(key, path string) error {
-	_, err := r.Conn.JSONDel(r.ctx, key, path).Result()
-	if err != nil {
+	if err := r.docs.del(r.ctx, key, path); err != nil {
 		return err
 	}
 
@@ -171,6 +171,116 @@ func (r *Client) JSONDelete(key, path string) error {
 	return nil
 }
 
+// SetAdd adds members to set and sets TTL of set
+func (r *Client) SetAdd(key string, ttl time.Duration, members ...string) error {
+	values := make([]interface{}, 0, len(members))
+	for _, m := range members {
+		values = append(values, m)
+	}
+
+	pipe := r.Conn.TxPipeline()
+	pipe.SAdd(r.ctx, key, values...)
+	pipe.Expire(r.ctx, key, ttl)
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return err
+	}
+
+	r.log.Debug().Msgf("add members to set %s in cache", key)
+
+	return nil
+}
+
+// SetMembers returns members of set
+func (r *Client) SetMembers(key string) ([]string, error) {
+	members, err := r.Conn.SMembers(r.ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	r.log.Debug().Msgf("get members of set %s from cache", key)
+
+	return members, nil
+}
+
+// SetRemove removes members from set
+func (r *Client) SetRemove(key string, members ...string) error {
+	values := make([]interface{}, 0, len(members))
+	for _, m := range members {
+		values = append(values, m)
+	}
+
+	if _, err := r.Conn.SRem(r.ctx, key, values...).Result(); err != nil {
+		return err
+	}
+
+	r.log.Debug().Msgf("remove members from set %s in cache", key)
+
+	return nil
+}
+
+// SortedSetAdd adds member with score to sorted set, only limit members with greatest scores are kept
+func (r *Client) SortedSetAdd(key string, score float64, member string, limit int) error {
+	pipe := r.Conn.TxPipeline()
+	pipe.ZAdd(r.ctx, key, &redis.Z{Score: score, Member: member})
+	pipe.ZRemRangeByRank(r.ctx, key, 0, int64(-limit-1))
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return err
+	}
+
+	r.log.Debug().Msgf("add member to sorted set %s in cache", key)
+
+	return nil
+}
+
+// SortedSetMembers returns count members of sorted set with greatest scores, the greatest score is first
+func (r *Client) SortedSetMembers(key string, count int) ([]string, error) {
+	members, err := r.Conn.ZRevRange(r.ctx, key, 0, int64(count-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	r.log.Debug().Msgf("get members of sorted set %s from cache", key)
+
+	return members, nil
+}
+
+// unlockScript deletes lock only if it is held by token
+var unlockScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) end return 0`)
+
+// Lock sets key to token if key doesn't exist, the key expires after ttl. It returns false if lock is held by other owner.
+func (r *Client) Lock(key, token string, ttl time.Duration) (bool, error) {
+	ok, err := r.Conn.SetNX(r.ctx, key, token, ttl).Result()
+	if err != nil {
+		return false, err
+	}
+
+	r.log.Debug().Msgf("lock %s in cache: %t", key, ok)
+
+	return ok, nil
+}
+
+// Unlock deletes key if it is set to token, the expired lock which was taken by other owner is kept
+func (r *Client) Unlock(key, token string) error {
+	if err := unlockScript.Run(r.ctx, r.Conn, []string{key}, token).Err(); err != nil {
+		return err
+	}
+
+	r.log.Debug().Msgf("unlock %s in cache", key)
+
+	return nil
+}
+
+// Delete deletes key
+func (r *Client) Delete(key string) error {
+	if _, err := r.Conn.Del(r.ctx, key).Result(); err != nil {
+		return err
+	}
+
+	r.log.Debug().Msgf("delete key %s from cache", key)
+
+	return nil
+}
+
 func formatSec(dur time.Duration) int64 {
 	if dur > 0 && dur < time.Second {
 		return 1
@@ -262,5 +372,9 @@ func (r *Client) GetReadyHandlers() metrics.MapCheckFunc {
 }
 
 func (r *Client) Shutdown() error {
+	if err := r.closeSubscriptions(); err != nil {
+		r.log.Error().Err(err).Msg("failed to close subscriptions")
+	}
+
 	return r.Conn.Close()
 }
@@ -3,7 +3,10 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -56,14 +59,18 @@ func initConfig() *Config {
 }
 
 func initClient(t *testing.T, dsn string) *Client {
+	cfg := initConfig()
+	cfg.DSN = dsn
+
+	return initClientWithConfig(t, cfg)
+}
+
+func initClientWithConfig(t *testing.T, cfg *Config) *Client {
 	ctx := context.Background()
 	ctx = initApp(ctx)
 	ctx = initLogger(ctx)
-	cfg := initConfig()
-
-	cfg.DSN = dsn
 
-	t.Logf("connecting to redis: %s", dsn)
+	t.Logf("connecting to redis: %s", cfg.DSN)
 
 	client, err := NewClient(ctx, cfg)
 	require.Nil(t, err)
@@ -79,7 +86,7 @@ func initClient(t *testing.T, dsn string) *Client {
 	require.Nil(t, err)
 	require.NotNil(t, client)
 
-	t.Logf("connected to redis: %s", dsn)
+	t.Logf("connected to redis: %s", cfg.DSN)
 
 	return client
 }
@@ -268,6 +275,94 @@ func TestJSONDelete(t *testing.T) {
 	require.Equal(t, 0, result.StatusCode)
 }
 
+func TestSetAdd(t *testing.T) {
+	dsn, err := dockertest.RunRedis()
+	require.Nil(t, err)
+	defer dockertest.KillAllDockers()
+
+	c := initClient(t, dsn)
+	err = c.SetAdd(defaultKey, 5*time.Second, "key1", "key2")
+	require.Nil(t, err)
+	err = c.SetAdd(defaultKey, 5*time.Second, "key2", "key3")
+	require.Nil(t, err)
+
+	members, err := c.SetMembers(defaultKey)
+	require.Nil(t, err)
+	require.ElementsMatch(t, []string{"key1", "key2", "key3"}, members)
+
+	err = c.SetRemove(defaultKey, "key1")
+	require.Nil(t, err)
+
+	members, err = c.SetMembers(defaultKey)
+	require.Nil(t, err)
+	require.ElementsMatch(t, []string{"key2", "key3"}, members)
+
+	ttl, err := c.Conn.TTL(c.ctx, defaultKey).Result()
+	require.Nil(t, err)
+	require.True(t, ttl > 0)
+
+	err = c.Delete(defaultKey)
+	require.Nil(t, err)
+
+	members, err = c.SetMembers(defaultKey)
+	require.Nil(t, err)
+	require.Empty(t, members)
+}
+
+func TestSortedSetAdd(t *testing.T) {
+	dsn, err := dockertest.RunRedis()
+	require.Nil(t, err)
+	defer dockertest.KillAllDockers()
+
+	c := initClient(t, dsn)
+	for i, member := range []string{"key1", "key2", "key3", "key2"} {
+		err = c.SortedSetAdd(defaultKey, float64(i), member, 2)
+		require.Nil(t, err)
+	}
+
+	members, err := c.SortedSetMembers(defaultKey, 10)
+	require.Nil(t, err)
+	require.Equal(t, []string{"key2", "key3"}, members)
+
+	members, err = c.SortedSetMembers(defaultKey, 1)
+	require.Nil(t, err)
+	require.Equal(t, []string{"key2"}, members)
+
+	err = c.Delete(defaultKey)
+	require.Nil(t, err)
+}
+
+func TestLock(t *testing.T) {
+	dsn, err := dockertest.RunRedis()
+	require.Nil(t, err)
+	defer dockertest.KillAllDockers()
+
+	c := initClient(t, dsn)
+	ok, err := c.Lock(defaultKey, "owner1", time.Minute)
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	ok, err = c.Lock(defaultKey, "owner2", time.Minute)
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	// The lock of other owner is kept
+	err = c.Unlock(defaultKey, "owner2")
+	require.Nil(t, err)
+	ok, err = c.Lock(defaultKey, "owner2", time.Minute)
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	err = c.Unlock(defaultKey, "owner1")
+	require.Nil(t, err)
+	ok, err = c.Lock(defaultKey, "owner2", time.Minute)
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	err = c.Delete(defaultKey)
+	require.Nil(t, err)
+}
+
 func TestFormatSec(t *testing.T) {
 	res := formatSec(time.Millisecond)
 	require.Equal(t, int64(1), res)
@@ -487,7 +582,7 @@ func TestGetLimit(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			tt.testFunc()
-			c.Conn.Client.Del(c.Conn.Context(), defaultKey)
+			c.Conn.Del(c.Conn.Context(), defaultKey)
 		})
 	}
 }
@@ -530,3 +625,130 @@ func TestShutdown(t *testing.T) {
 	err = c.Shutdown()
 	require.Nil(t, err)
 }
+
+func TestPublishSubscribe(t *testing.T) {
+	dsn, err := dockertest.RunRedis()
+	require.Nil(t, err)
+	defer dockertest.KillAllDockers()
+
+	c := initClient(t, dsn)
+
+	received := make(chan string, 2)
+	err = c.Subscribe(defaultKey, func(payload string) { received <- "first:" + payload })
+	require.Nil(t, err)
+	err = c.Subscribe(defaultKey, func(payload string) { received <- "second:" + payload })
+	require.Nil(t, err)
+
+	err = c.Publish(defaultKey, "message")
+	require.Nil(t, err)
+
+	result := []string{<-received, <-received}
+	require.ElementsMatch(t, []string{"first:message", "second:message"}, result)
+}
+
+func TestResubscribe(t *testing.T) {
+	dsn, err := dockertest.RunRedis()
+	require.Nil(t, err)
+	defer dockertest.KillAllDockers()
+
+	c := initClient(t, dsn)
+
+	resubscribed := make(chan struct{}, 1)
+	err = c.OnResubscribe(defaultKey, func() { resubscribed <- struct{}{} })
+	require.Nil(t, err)
+	err = c.Subscribe(defaultKey, func(payload string) {})
+	require.Nil(t, err)
+
+	// The handler is called after subscription is restored on reconnect
+	err = c.Conn.ClientKillByFilter(c.Conn.Context(), "TYPE", "pubsub").Err()
+	require.Nil(t, err)
+
+	select {
+	case <-resubscribed:
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "subscription isn't restored")
+	}
+}
+
+func TestPlainBackend(t *testing.T) {
+	dsn, err := dockertest.RunRedis()
+	require.Nil(t, err)
+	defer dockertest.KillAllDockers()
+
+	cfg := initConfig()
+	cfg.DSN = dsn
+	cfg.Backend = BackendPlain
+	c := initClientWithConfig(t, cfg)
+
+	testData := &testCacheData{Name: "test data", StatusCode: 200}
+	testTTL := 5 * time.Second
+	err = c.Add(defaultKey, testData, testTTL)
+	require.Nil(t, err)
+
+	var result testCacheData
+	err = c.Select(defaultKey, &result)
+	require.Nil(t, err)
+	require.Equal(t, testData, &result)
+
+	var name string
+	err = c.JSONGet(defaultKey, "Name", &name)
+	require.Nil(t, err)
+	require.Equal(t, testData.Name, name)
+
+	err = c.JSONSet(defaultKey, "StatusCode", "300")
+	require.Nil(t, err)
+
+	var statusCode int
+	err = c.JSONGet(defaultKey, ".StatusCode", &statusCode)
+	require.Nil(t, err)
+	require.Equal(t, 300, statusCode)
+
+	// The TTL is kept on changing of document
+	d, err := c.Conn.TTL(c.Conn.Context(), defaultKey).Result()
+	require.Nil(t, err)
+	require.True(t, d > 0 && d <= testTTL)
+
+	// The concurrent changes of document are retried and not lost
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			require.Nil(t, c.JSONSet(defaultKey, fmt.Sprintf("Field%d", i), strconv.Itoa(i)))
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 5; i++ {
+		var field int
+		err = c.JSONGet(defaultKey, fmt.Sprintf("Field%d", i), &field)
+		require.Nil(t, err)
+		require.Equal(t, i, field)
+	}
+
+	err = c.JSONSetNX(defaultKey, ".", `{"Name":"other"}`)
+	require.NotNil(t, err)
+
+	err = c.JSONDelete(defaultKey, ".StatusCode")
+	require.Nil(t, err)
+
+	result = testCacheData{}
+	err = c.Select(defaultKey, &result)
+	require.Nil(t, err)
+	require.Equal(t, 0, result.StatusCode)
+
+	err = c.JSONDelete(defaultKey, ".")
+	require.Nil(t, err)
+
+	err = c.Select(defaultKey, &result)
+	require.NotNil(t, err)
+
+	// The limit counters don't need RedisJSON
+	err = c.LimitCount(defaultKey, 2)
+	require.Nil(t, err)
+
+	var counter int
+	err = c.GetLimit(defaultKey, &counter)
+	require.Nil(t, err)
+	require.Equal(t, 1, counter)
+}
@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/soldatov-s/accp/x/rejson"
+)
+
+// documentStore stores JSON documents, path "." is a root of document, ".a.b" is a field b of object a
+type documentStore interface {
+	setWithExpire(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	get(ctx context.Context, key, path string, value interface{}) error
+	set(ctx context.Context, key, path, json string, nx bool) error
+	del(ctx context.Context, key, path string) error
+}
+
+// rejsonStore stores documents by commands of RedisJSON module
+type rejsonStore struct {
+	conn *rejson.Client
+}
+
+func (s *rejsonStore) setWithExpire(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return s.conn.JSONSetWithExpire(ctx, key, ".", value, ttl)
+}
+
+func (s *rejsonStore) get(ctx context.Context, key, path string, value interface{}) error {
+	args := make([]interface{}, 0, 1)
+	if path != "" {
+		args = append(args, path)
+	}
+
+	cmdString := s.conn.JSONGet(ctx, key, args...)
+	if _, err := cmdString.Result(); err != nil {
+		return err
+	}
+
+	return cmdString.Scan(value)
+}
+
+func (s *rejsonStore) set(ctx context.Context, key, path, json string, nx bool) error {
+	args := make([]interface{}, 0, 1)
+	if nx {
+		args = append(args, "NX")
+	}
+
+	_, err := s.conn.JSONSet(ctx, key, path, json, args...).Result()
+
+	return err
+}
+
+func (s *rejsonStore) del(ctx context.Context, key, path string) error {
+	_, err := s.conn.JSONDel(ctx, key, path).Result()
+	return err
+}
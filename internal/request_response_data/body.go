@@ -0,0 +1,22 @@
+package rrdata
+
+import "unicode/utf8"
+
+// encodeBody splits body for JSON. JSON string keeps only valid UTF-8, so the other body is returned
+// as binary, which is encoded to base64 by JSON.
+func encodeBody(body string) (text string, binary []byte) {
+	if utf8.ValidString(body) {
+		return body, nil
+	}
+
+	return "", []byte(body)
+}
+
+// decodeBody joins body split by encodeBody
+func decodeBody(text string, binary []byte) string {
+	if binary != nil {
+		return string(binary)
+	}
+
+	return text
+}
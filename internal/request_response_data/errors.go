@@ -4,4 +4,8 @@ import "errors"
 
 var (
 	ErrEmptyRequest = errors.New("empty request")
+	ErrServerError  = errors.New("backend answered with server error")
+	ErrBodyTooLarge = errors.New("body is larger than limit")
+	// ErrBodyUnavailable is returned if stored body can't be read, nothing is written to client
+	ErrBodyUnavailable = errors.New("stored body is unavailable")
 )
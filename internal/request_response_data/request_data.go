@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"sync"
 
 	"github.com/soldatov-s/accp/internal/httputils"
@@ -21,6 +22,15 @@ type RequestData struct {
 	mu     sync.RWMutex
 }
 
+// requestDataJSON is a JSON form of RequestData, the body which is not valid UTF-8 is kept in BodyBase64
+type requestDataJSON struct {
+	URL        string
+	Method     string
+	Body       string
+	BodyBase64 []byte `json:",omitempty"`
+	Header     http.Header
+}
+
 func NewRequestData(req *http.Request) (*RequestData, error) {
 	r := &RequestData{}
 	if err := r.Read(req); err != nil {
@@ -38,6 +48,27 @@ func (r *RequestData) UnmarshalBinary(data []byte) error {
 	return json.Unmarshal(data, r)
 }
 
+func (r *RequestData) MarshalJSON() ([]byte, error) {
+	v := requestDataJSON{URL: r.URL, Method: r.Method, Header: r.Header}
+	v.Body, v.BodyBase64 = encodeBody(r.Body)
+
+	return json.Marshal(&v)
+}
+
+func (r *RequestData) UnmarshalJSON(data []byte) error {
+	var v requestDataJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	r.URL = v.URL
+	r.Method = v.Method
+	r.Body = decodeBody(v.Body, v.BodyBase64)
+	r.Header = v.Header
+
+	return nil
+}
+
 func (r *RequestData) Read(req *http.Request) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -50,8 +81,14 @@ func (r *RequestData) Read(req *http.Request) error {
 		if err != nil {
 			return err
 		}
-		req.Body = ioutil.NopCloser(bytes.NewReader(buf.Bytes()))
+		// The buffer is returned to pool, so the body is read again from the string. The GetBody
+		// allows client to resend request on broken keep-alive connection.
 		r.Body = buf.String()
+		body := r.Body
+		req.Body = ioutil.NopCloser(strings.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(body)), nil
+		}
 	}
 
 	r.Header = make(http.Header)
@@ -78,3 +115,22 @@ func (r *RequestData) BuildRequest() (*http.Request, error) {
 	httputils.CopyHeader(req.Header, r.Header)
 	return req, nil
 }
+
+// Size returns approximate size of request in bytes
+func (r *RequestData) Size() int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return int64(len(r.URL)+len(r.Method)+len(r.Body)) + headerSize(r.Header)
+}
+
+func headerSize(h http.Header) int64 {
+	var size int64
+	for k, values := range h {
+		for _, v := range values {
+			size += int64(len(k) + len(v))
+		}
+	}
+
+	return size
+}
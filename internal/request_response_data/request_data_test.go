@@ -52,6 +52,26 @@ func TestRequestData_MarshalBinary(t *testing.T) {
 	require.Equal(t, testRequestJSONData, string(data))
 }
 
+func TestRequestData_BinaryBody(t *testing.T) {
+	body := "\x08\x96\x01\xff\xfe"
+	req, err := http.NewRequest(http.MethodPost, testRequestURL, bytes.NewBufferString(body))
+	require.Nil(t, err)
+
+	reqData, err := NewRequestData(req)
+	require.Nil(t, err)
+
+	data, err := reqData.MarshalBinary()
+	require.Nil(t, err)
+	require.Contains(t, string(data), `"BodyBase64":`)
+
+	var result RequestData
+	err = result.UnmarshalBinary(data)
+	require.Nil(t, err)
+	require.Equal(t, body, result.Body)
+	require.Equal(t, http.MethodPost, result.Method)
+	require.Equal(t, testRequestURL, result.URL)
+}
+
 func TestRequestData_UnmarshalBinary(t *testing.T) {
 	var reqData RequestData
 	err := reqData.UnmarshalBinary([]byte(testRequestJSONData))
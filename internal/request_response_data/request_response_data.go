@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/soldatov-s/accp/internal/cache/external"
@@ -32,20 +33,74 @@ func (r *RequestResponseData) UnmarshalBinary(data []byte) error {
 	return json.Unmarshal(data, &r.Response)
 }
 
+// MarshalHead returns binary form of response without body
+func (r *RequestResponseData) MarshalHead() ([]byte, error) {
+	return r.Response.MarshalHead()
+}
+
+// StoredBody returns body of response as it is kept in cache
+func (r *RequestResponseData) StoredBody() ([]byte, error) {
+	return r.Response.StoredBody()
+}
+
+// UnmarshalHead reads response without body, the body is streamed from bodyFile
+func (r *RequestResponseData) UnmarshalHead(data []byte, bodyFile string) error {
+	if r.Response == nil {
+		r.Response = &ResponseData{}
+	}
+
+	return r.Response.UnmarshalHead(data, bodyFile)
+}
+
+// LoadBody reads body of response from file
+func (r *RequestResponseData) LoadBody() error {
+	return r.Response.LoadBody()
+}
+
 func (r *RequestResponseData) GetStatusCode() int {
 	return r.Response.StatusCode
 }
 
+// ExpiresAt returns time after which response must not be used
+func (r *RequestResponseData) ExpiresAt() time.Time {
+	return r.Response.ExpiresAt()
+}
+
+// Tags returns tags of response from Surrogate-Key header
+func (r *RequestResponseData) Tags() []string {
+	return r.Response.Tags()
+}
+
+// Size returns approximate size of request and response in bytes
+func (r *RequestResponseData) Size() int64 {
+	size := r.Response.Size()
+	if r.Request != nil {
+		size += r.Request.Size()
+	}
+
+	return size
+}
+
 func (r *RequestResponseData) Update(client *http.Client) error {
 	req, err := r.Request.BuildRequest()
 	if err != nil {
 		return err
 	}
 
-	return r.UpdateByRequest(client, req)
+	return r.UpdateByRequest(client, req, 0)
+}
+
+// conditional makes request conditional by validators of response, it returns false if there are no validators
+func (r *RequestResponseData) conditional(req *http.Request) bool {
+	etag, lastModified := r.Response.Validators()
+	return httputils.MakeConditional(req, etag, lastModified)
 }
 
-func (r *RequestResponseData) UpdateByRequest(client *http.Client, req *http.Request) error {
+// UpdateByRequest updates response, the request is conditional if response has validators
+// and the response is kept if backend answered 304. The body larger than maxSize is not read,
+// zero maxSize means no limit.
+func (r *RequestResponseData) UpdateByRequest(client *http.Client, req *http.Request, maxSize int64) error {
+	conditional := r.conditional(req)
 	// nolint
 	resp, err := client.Do(req)
 	if err != nil {
@@ -53,7 +108,12 @@ func (r *RequestResponseData) UpdateByRequest(client *http.Client, req *http.Req
 	}
 	defer resp.Body.Close()
 
-	err = r.Response.Read(resp)
+	if conditional && resp.StatusCode == http.StatusNotModified {
+		r.Response.Revalidate(resp)
+		return nil
+	}
+
+	err = r.Response.ReadLimited(resp, maxSize)
 	if err != nil {
 		return err
 	}
@@ -61,6 +121,29 @@ func (r *RequestResponseData) UpdateByRequest(client *http.Client, req *http.Req
 	return nil
 }
 
+// TryUpdateByRequest updates response only if request succeeded, the previous response
+// is kept if request failed or backend answered with server error. The body larger than maxSize
+// is not read, zero maxSize means no limit.
+func (r *RequestResponseData) TryUpdateByRequest(client *http.Client, req *http.Request, maxSize int64) error {
+	conditional := r.conditional(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request to backend failed")
+	}
+	defer resp.Body.Close()
+
+	if conditional && resp.StatusCode == http.StatusNotModified {
+		r.Response.Revalidate(resp)
+		return nil
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return errors.Wrapf(ErrServerError, "status code %d", resp.StatusCode)
+	}
+
+	return r.Response.ReadLimited(resp, maxSize)
+}
+
 func (r *RequestResponseData) ReadAll(req *http.Request, resp *http.Response) error {
 	if err := r.Request.Read(req); err != nil {
 		return errors.Wrap(err, "failed to read data from request")
@@ -2,9 +2,12 @@ package rrdata
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -265,7 +268,7 @@ func TestUpdateByRequest(t *testing.T) {
 				rrData := NewRequestResponseData(testRequestResponseHK, testRequestResponseMax, nil)
 				require.NotNil(t, rrData)
 
-				err := rrData.UpdateByRequest(client, req)
+				err := rrData.UpdateByRequest(client, req, 0)
 				require.Nil(t, err)
 
 				errResp := httputils.ErrResponse(
@@ -296,7 +299,7 @@ func TestUpdateByRequest(t *testing.T) {
 				server.Start()
 				defer server.Close()
 
-				err := rrData.UpdateByRequest(client, req)
+				err := rrData.UpdateByRequest(client, req, 0)
 				require.Nil(t, err)
 
 				var respData testProxyHelpers.HTTPBody
@@ -319,7 +322,7 @@ func TestUpdateByRequest(t *testing.T) {
 				defer server.Close()
 
 				// first request
-				err := rrData.UpdateByRequest(client, req)
+				err := rrData.UpdateByRequest(client, req, 0)
 				require.Nil(t, err)
 
 				var respData testProxyHelpers.HTTPBody
@@ -330,7 +333,7 @@ func TestUpdateByRequest(t *testing.T) {
 				firstRequestTimeStamp := respData.Result.TimeStamp
 
 				// second request
-				err = rrData.UpdateByRequest(client, req)
+				err = rrData.UpdateByRequest(client, req, 0)
 				require.Nil(t, err)
 
 				err = json.Unmarshal([]byte(rrData.Response.Body), &respData)
@@ -358,7 +361,7 @@ func TestUpdateByRequest(t *testing.T) {
 				server.Start()
 				defer server.Close()
 
-				err = rrData.UpdateByRequest(client, req)
+				err = rrData.UpdateByRequest(client, req, 0)
 				require.Nil(t, err)
 				require.Equal(t, http.StatusNotFound, rrData.Response.StatusCode)
 
@@ -377,7 +380,7 @@ func TestUpdateByRequest(t *testing.T) {
 				server.Start()
 				defer server.Close()
 
-				err := rrData.UpdateByRequest(client, req)
+				err := rrData.UpdateByRequest(client, req, 0)
 				require.Nil(t, err)
 
 				var respData testProxyHelpers.HTTPBody
@@ -392,7 +395,7 @@ func TestUpdateByRequest(t *testing.T) {
 				req.URL, err = url.Parse(req.URL.String() + "/" + uuid.New().String())
 				require.Nil(t, err)
 
-				err = rrData.UpdateByRequest(client, req)
+				err = rrData.UpdateByRequest(client, req, 0)
 				require.Nil(t, err)
 				require.Equal(t, http.StatusNotFound, rrData.Response.StatusCode)
 
@@ -407,6 +410,110 @@ func TestUpdateByRequest(t *testing.T) {
 		})
 	}
 }
+func TestTryUpdateByRequest(t *testing.T) {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+	}
+
+	statusCode := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+		_, _ = w.Write([]byte(testRequestResponseBody))
+	}))
+	defer server.Close()
+
+	rrData := NewRequestResponseData(testRequestResponseHK, testRequestResponseMax, nil)
+	require.NotNil(t, rrData)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.Nil(t, err)
+	require.Nil(t, rrData.TryUpdateByRequest(client, req, 0))
+	require.Equal(t, http.StatusOK, rrData.GetStatusCode())
+	respUUID := rrData.Response.UUID
+
+	// Server error doesn't change response
+	statusCode = http.StatusInternalServerError
+	req, err = http.NewRequest(http.MethodGet, server.URL, nil)
+	require.Nil(t, err)
+	require.True(t, errors.Is(rrData.TryUpdateByRequest(client, req, 0), ErrServerError))
+	require.Equal(t, http.StatusOK, rrData.GetStatusCode())
+	require.Equal(t, respUUID, rrData.Response.UUID)
+
+	// Connection error doesn't change response
+	server.Close()
+	req, err = http.NewRequest(http.MethodGet, server.URL, nil)
+	require.Nil(t, err)
+	require.NotNil(t, rrData.TryUpdateByRequest(client, req, 0))
+	require.Equal(t, respUUID, rrData.Response.UUID)
+}
+
+func TestUpdateByRequestConditional(t *testing.T) {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+	}
+
+	const etag = `"v1"`
+	var requests, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set(httputils.ETagHeader, etag)
+		if r.Header.Get(httputils.IfNoneMatchHeader) == etag {
+			atomic.AddInt32(&notModified, 1)
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte(testRequestResponseBody))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		update func(rrData *RequestResponseData, req *http.Request) error
+	}{
+		{
+			name: "UpdateByRequest",
+			update: func(rrData *RequestResponseData, req *http.Request) error {
+				return rrData.UpdateByRequest(client, req, 0)
+			},
+		},
+		{
+			name: "TryUpdateByRequest",
+			update: func(rrData *RequestResponseData, req *http.Request) error {
+				return rrData.TryUpdateByRequest(client, req, 0)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&notModified, 0)
+			rrData := NewRequestResponseData(testRequestResponseHK, testRequestResponseMax, nil)
+
+			// The validator of client must not be sent on first request
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			require.Nil(t, err)
+			req.Header.Set(httputils.IfNoneMatchHeader, etag)
+			require.Nil(t, tt.update(rrData, req))
+			require.Equal(t, int32(0), atomic.LoadInt32(&notModified))
+			require.Equal(t, testRequestResponseBody, rrData.Response.Body)
+			respUUID := rrData.Response.UUID
+
+			rrData.Response.MarkStale()
+			req, err = http.NewRequest(http.MethodGet, server.URL, nil)
+			require.Nil(t, err)
+			require.Nil(t, tt.update(rrData, req))
+			require.Equal(t, int32(1), atomic.LoadInt32(&notModified))
+			require.Equal(t, http.StatusOK, rrData.GetStatusCode())
+			require.Equal(t, testRequestResponseBody, rrData.Response.Body)
+			require.Equal(t, "max-age=60", rrData.Response.Header.Get("Cache-Control"))
+			require.NotEqual(t, respUUID, rrData.Response.UUID)
+			require.False(t, rrData.Response.Stale())
+		})
+	}
+}
+
 func TestReadAll(t *testing.T) {
 	rrData := NewRequestResponseData(testRequestResponseHK, testRequestResponseMax, nil)
 	require.NotNil(t, rrData)
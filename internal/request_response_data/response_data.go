@@ -1,15 +1,21 @@
 package rrdata
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	"github.com/soldatov-s/accp/internal/cache/external"
 	"github.com/soldatov-s/accp/internal/httputils"
 	"github.com/valyala/bytebufferpool"
@@ -26,20 +32,34 @@ const (
 	ResponseBack ResponseSource = iota
 	ResponseCache
 	ResponseBypass
+	ResponseStale
 )
 
 func (r ResponseSource) String() string {
-	return []string{"MISS", "HIT", "BYPASS"}[r]
+	return []string{"MISS", "HIT", "BYPASS", "STALE"}[r]
 }
 
 type ResponseData struct {
 	readMu     sync.RWMutex
-	Body       string       `json:"body"`
-	Header     http.Header  `json:"header"`
-	StatusCode int          `json:"status_code"`
-	TimeStamp  int64        `json:"time_stamp"`
-	UUID       uuid.UUID    `json:"uuid"`
-	Refresh    *RefreshData `json:"-"`
+	Body       string      `json:"body"`
+	Header     http.Header `json:"header"`
+	StatusCode int         `json:"status_code"`
+	TimeStamp  int64       `json:"time_stamp"`
+	UUID       uuid.UUID   `json:"uuid"`
+	// Expires is unix time in nanoseconds after which response must not be used,
+	// zero means that response has not own lifetime
+	Expires int64 `json:"expires,omitempty"`
+	// Encoding is a content encoding of CompressedBody, the Body is empty if response is compressed
+	Encoding       string       `json:"encoding,omitempty"`
+	CompressedBody []byte       `json:"compressed_body,omitempty"`
+	Refresh        *RefreshData `json:"-"`
+	// GeneratedETag is true if ETag is generated by cache from body, backend doesn't know it
+	GeneratedETag bool `json:"generated_etag,omitempty"`
+	// stale is true if the last refresh failed and previous response is kept
+	stale bool
+	// bodyFile is a file of disk cache with stored body, the body is streamed from it,
+	// the Body and CompressedBody are empty while it is set
+	bodyFile string
 }
 
 func NewResponseData(hk string, maxCount int, cache *external.Cache) *ResponseData {
@@ -56,36 +76,418 @@ func (r *ResponseData) UnmarshalBinary(data []byte) error {
 	return json.Unmarshal(data, r)
 }
 
+// plainResponseData has fields of ResponseData without JSON methods
+type plainResponseData ResponseData
+
+// responseDataJSON is a JSON form of ResponseData, the body which is not valid UTF-8 is kept in body_base64
+type responseDataJSON struct {
+	Body string `json:"body"`
+	*plainResponseData
+	BodyBase64 []byte `json:"body_base64,omitempty"`
+}
+
+func (r *ResponseData) MarshalJSON() ([]byte, error) {
+	v := responseDataJSON{plainResponseData: (*plainResponseData)(r)}
+	v.Body, v.BodyBase64 = encodeBody(r.Body)
+
+	return json.Marshal(&v)
+}
+
+func (r *ResponseData) UnmarshalJSON(data []byte) error {
+	v := responseDataJSON{plainResponseData: (*plainResponseData)(r)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	r.Body = decodeBody(v.Body, v.BodyBase64)
+
+	return nil
+}
+
+// responseHeadJSON is a JSON form of ResponseData without body
+type responseHeadJSON struct {
+	Header        http.Header `json:"header"`
+	StatusCode    int         `json:"status_code"`
+	TimeStamp     int64       `json:"time_stamp"`
+	UUID          uuid.UUID   `json:"uuid"`
+	Expires       int64       `json:"expires,omitempty"`
+	Encoding      string      `json:"encoding,omitempty"`
+	GeneratedETag bool        `json:"generated_etag,omitempty"`
+}
+
+// MarshalHead returns JSON form of response without body
+func (r *ResponseData) MarshalHead() ([]byte, error) {
+	r.readMu.RLock()
+	defer r.readMu.RUnlock()
+
+	return json.Marshal(&responseHeadJSON{
+		Header:        r.Header,
+		StatusCode:    r.StatusCode,
+		TimeStamp:     r.TimeStamp,
+		UUID:          r.UUID,
+		Expires:       r.Expires,
+		Encoding:      r.Encoding,
+		GeneratedETag: r.GeneratedETag,
+	})
+}
+
+// StoredBody returns compressed body if response is compressed, otherwise it returns body
+func (r *ResponseData) StoredBody() ([]byte, error) {
+	r.readMu.RLock()
+	defer r.readMu.RUnlock()
+
+	return r.storedBody()
+}
+
+func (r *ResponseData) storedBody() ([]byte, error) {
+	switch {
+	case r.bodyFile != "":
+		return ioutil.ReadFile(r.bodyFile)
+	case r.Encoding != "":
+		return r.CompressedBody, nil
+	default:
+		return []byte(r.Body), nil
+	}
+}
+
+// UnmarshalHead reads response without body, the body is streamed from bodyFile
+func (r *ResponseData) UnmarshalHead(data []byte, bodyFile string) error {
+	var v responseHeadJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	r.readMu.Lock()
+	defer r.readMu.Unlock()
+
+	r.Header = v.Header
+	r.StatusCode = v.StatusCode
+	r.TimeStamp = v.TimeStamp
+	r.UUID = v.UUID
+	r.Expires = v.Expires
+	r.Encoding = v.Encoding
+	r.GeneratedETag = v.GeneratedETag
+	r.Body = ""
+	r.CompressedBody = nil
+	r.bodyFile = bodyFile
+
+	return nil
+}
+
+// LoadBody reads body from file, so the response doesn't depend on file of disk cache
+func (r *ResponseData) LoadBody() error {
+	r.readMu.Lock()
+	defer r.readMu.Unlock()
+
+	if r.bodyFile == "" {
+		return nil
+	}
+
+	body, err := ioutil.ReadFile(r.bodyFile)
+	if err != nil {
+		return err
+	}
+
+	if r.Encoding != "" {
+		r.CompressedBody = body
+	} else {
+		r.Body = string(body)
+	}
+	r.bodyFile = ""
+
+	return nil
+}
+
 func (r *ResponseData) Write(w http.ResponseWriter, src fmt.Stringer) error {
 	r.readMu.RLock()
 	defer r.readMu.RUnlock()
 
+	return r.write(w, nil, src)
+}
+
+// WriteConditional writes 304 without body if response matches If-None-Match or If-Modified-Since
+// of request, otherwise it writes full response
+func (r *ResponseData) WriteConditional(w http.ResponseWriter, req *http.Request, src fmt.Stringer) error {
+	r.readMu.RLock()
+	defer r.readMu.RUnlock()
+
+	if r.StatusCode != http.StatusOK || !httputils.NotModified(req, r.Header) {
+		return r.write(w, req, src)
+	}
+
+	httputils.CopyNotModifiedHeader(w.Header(), r.Header)
+	w.Header().Add(ResponseSourceHeader, src.String())
+	w.WriteHeader(http.StatusNotModified)
+
+	return nil
+}
+
+// write writes response, the compressed body is written as is if Accept-Encoding of request allows it,
+// otherwise it is decompressed
+func (r *ResponseData) write(w http.ResponseWriter, req *http.Request, src fmt.Stringer) error {
+	body, err := r.bodyReader()
+	if err != nil {
+		return errors.Wrap(ErrBodyUnavailable, err.Error())
+	}
+	defer body.Close()
+
+	if r.Encoding == "" {
+		httputils.CopyHeader(w.Header(), r.Header)
+		w.Header().Add(ResponseSourceHeader, src.String())
+		w.WriteHeader(r.StatusCode)
+		_, err = io.Copy(w, body)
+		return err
+	}
+
+	encoded := httputils.AcceptsEncoding(req, r.Encoding)
+	if !encoded {
+		var decompressor io.ReadCloser
+		if decompressor, err = httputils.NewDecompressor(r.Encoding, body); err != nil {
+			return errors.Wrap(ErrBodyUnavailable, err.Error())
+		}
+		defer decompressor.Close()
+		body = decompressor
+	}
+
 	httputils.CopyHeader(w.Header(), r.Header)
 	w.Header().Add(ResponseSourceHeader, src.String())
+	// The length of backend response doesn't match the length of written body
+	w.Header().Del(httputils.ContentLengthHeader)
+	httputils.AddVary(w.Header(), httputils.AcceptEncodingHeader)
+	if encoded {
+		w.Header().Set(httputils.ContentEncodingHeader, r.Encoding)
+		if etag := w.Header().Get(httputils.ETagHeader); etag != "" {
+			w.Header().Set(httputils.ETagHeader, httputils.WeakETag(etag))
+		}
+	}
+
 	w.WriteHeader(r.StatusCode)
-	_, err := w.Write([]byte(r.Body))
+	_, err = io.Copy(w, body)
+
 	return err
 }
 
+// bodyReader returns reader of stored body, the body on disk is streamed from file
+func (r *ResponseData) bodyReader() (io.ReadCloser, error) {
+	switch {
+	case r.bodyFile != "":
+		return openBodyFile(r.bodyFile)
+	case r.Encoding != "":
+		return ioutil.NopCloser(bytes.NewReader(r.CompressedBody)), nil
+	default:
+		return ioutil.NopCloser(strings.NewReader(r.Body)), nil
+	}
+}
+
+// openBodyFile opens body file and reads its beginning, so the failure is found before anything
+// is written to client
+func openBodyFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(f)
+	if _, err = reader.Peek(1); err != nil && err != io.EOF {
+		f.Close()
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, f}, nil
+}
+
+// body returns decompressed body
+func (r *ResponseData) body() ([]byte, error) {
+	body, err := r.storedBody()
+	if err != nil || r.Encoding == "" {
+		return body, err
+	}
+
+	return httputils.Decompress(r.Encoding, body)
+}
+
+// Compress compresses body by encoding if body is not smaller than minSize, the body encoded by backend
+// and the body which doesn't become smaller are kept as is
+func (r *ResponseData) Compress(encoding string, minSize int) error {
+	r.readMu.Lock()
+	defer r.readMu.Unlock()
+
+	if r.Encoding != "" || r.bodyFile != "" || len(r.Body) == 0 || len(r.Body) < minSize || r.Header.Get(httputils.ContentEncodingHeader) != "" {
+		return nil
+	}
+
+	compressed, err := httputils.Compress(encoding, []byte(r.Body))
+	if err != nil {
+		return err
+	}
+
+	if len(compressed) >= len(r.Body) {
+		return nil
+	}
+
+	r.Encoding = encoding
+	r.CompressedBody = compressed
+	r.Body = ""
+
+	return nil
+}
+
 func (r *ResponseData) Read(resp *http.Response) error {
+	return r.ReadLimited(resp, 0)
+}
+
+// ReadLimited reads response, the response is kept and ErrBodyTooLarge is returned if body is larger
+// than maxSize, zero maxSize means no limit
+func (r *ResponseData) ReadLimited(resp *http.Response, maxSize int64) error {
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return ErrBodyTooLarge
+	}
+
 	r.readMu.Lock()
 	defer r.readMu.Unlock()
 
 	buf := bytebufferpool.Get()
 	defer bytebufferpool.Put(buf)
 
-	_, err := io.Copy(buf, resp.Body)
+	var body io.Reader = resp.Body
+	if maxSize > 0 {
+		body = io.LimitReader(resp.Body, maxSize+1)
+	}
+
+	_, err := io.Copy(buf, body)
 	if err != nil {
 		return err
 	}
 
+	if maxSize > 0 && int64(buf.Len()) > maxSize {
+		return ErrBodyTooLarge
+	}
+
 	r.Body = buf.String()
+	r.reset(resp)
+	r.generateETag(buf.Bytes())
+
+	return nil
+}
+
+// generateETag sets strong ETag generated from body, the ETag of backend is kept
+func (r *ResponseData) generateETag(body []byte) {
+	if r.StatusCode == http.StatusOK && r.Header.Get(httputils.ETagHeader) == "" {
+		r.Header.Set(httputils.ETagHeader, httputils.GenerateETag(body))
+		r.GeneratedETag = true
+	}
+}
+
+// reset sets headers and status of response and resets state of previous response, the body is not set
+func (r *ResponseData) reset(resp *http.Response) {
 	r.Header = make(http.Header)
 	httputils.CopyHeader(r.Header, resp.Header)
 	r.StatusCode = resp.StatusCode
 	r.TimeStamp = time.Now().UTC().Unix()
 	r.UUID = uuid.New()
 	r.Header.Add(ResponseCachedHeader, strconv.Itoa(int(r.TimeStamp)))
+	r.Expires = 0
+	r.stale = false
+	r.Encoding = ""
+	r.CompressedBody = nil
+	r.GeneratedETag = false
+	r.bodyFile = ""
+}
 
-	return nil
+// Revalidate updates response by 304 response of backend, the body is kept
+func (r *ResponseData) Revalidate(resp *http.Response) {
+	r.readMu.Lock()
+	defer r.readMu.Unlock()
+
+	httputils.CopyNotModifiedHeader(r.Header, resp.Header)
+	if resp.Header.Get(httputils.ETagHeader) != "" {
+		r.GeneratedETag = false
+	}
+	r.TimeStamp = time.Now().UTC().Unix()
+	// New UUID makes other instances to reload response with new lifetime from external cache
+	r.UUID = uuid.New()
+	r.Header.Set(ResponseCachedHeader, strconv.Itoa(int(r.TimeStamp)))
+	r.Expires = 0
+	r.stale = false
+}
+
+// Validators returns ETag and Last-Modified of backend for conditional request,
+// the ETag generated by cache is not returned because backend doesn't know it
+func (r *ResponseData) Validators() (etag, lastModified string) {
+	r.readMu.RLock()
+	defer r.readMu.RUnlock()
+
+	if r.StatusCode != http.StatusOK {
+		return "", ""
+	}
+
+	if !r.GeneratedETag {
+		etag = r.Header.Get(httputils.ETagHeader)
+	}
+
+	return etag, r.Header.Get(httputils.LastModifiedHeader)
+}
+
+// SetTTL sets lifetime of response from now
+func (r *ResponseData) SetTTL(ttl time.Duration) {
+	r.readMu.Lock()
+	defer r.readMu.Unlock()
+
+	r.Expires = time.Now().Add(ttl).UnixNano()
+}
+
+// ExpiresAt returns time after which response must not be used,
+// zero time means that response has not own lifetime
+func (r *ResponseData) ExpiresAt() time.Time {
+	r.readMu.RLock()
+	defer r.readMu.RUnlock()
+
+	if r.Expires == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, r.Expires)
+}
+
+// Tags returns tags of response from Surrogate-Key header
+func (r *ResponseData) Tags() []string {
+	r.readMu.RLock()
+	defer r.readMu.RUnlock()
+
+	return httputils.ParseSurrogateKeys(r.Header)
+}
+
+// Size returns approximate size of response in bytes
+func (r *ResponseData) Size() int64 {
+	r.readMu.RLock()
+	defer r.readMu.RUnlock()
+
+	return int64(len(r.Body)+len(r.CompressedBody)) + headerSize(r.Header)
+}
+
+// MarkStale marks that the refresh of response failed and response is stale
+func (r *ResponseData) MarkStale() {
+	r.readMu.Lock()
+	defer r.readMu.Unlock()
+
+	r.stale = true
+}
+
+// Stale checks that the last refresh of response failed
+func (r *ResponseData) Stale() bool {
+	r.readMu.RLock()
+	defer r.readMu.RUnlock()
+
+	return r.stale
+}
+
+// Age returns time since response was received from backend
+func (r *ResponseData) Age() time.Duration {
+	r.readMu.RLock()
+	defer r.readMu.RUnlock()
+
+	return time.Since(time.Unix(r.TimeStamp, 0))
 }
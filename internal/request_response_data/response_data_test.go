@@ -2,12 +2,18 @@ package rrdata
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/soldatov-s/accp/internal/httputils"
 	"github.com/stretchr/testify/require"
 )
 
@@ -19,6 +25,7 @@ const (
 	testResponseMax         = 5
 	testResponseTimeStamp   = int64(1611145887)
 	testResponseUUID        = "4498280e-91ba-46d8-9030-6720d3ca6a9b"
+	testLastModified        = "Wed, 20 Jan 2021 12:00:00 GMT"
 	// nolint : lll
 	testResponseJSONData = `{"body":"test body","header":{"Test-Header":["test value"]},"status_code":200,"time_stamp":1611145887,"uuid":"4498280e-91ba-46d8-9030-6720d3ca6a9b"}`
 )
@@ -32,6 +39,9 @@ func TestResponseSource_String(t *testing.T) {
 
 	r = ResponseBypass
 	require.Equal(t, "BYPASS", r.String())
+
+	r = ResponseStale
+	require.Equal(t, "STALE", r.String())
 }
 
 func initHTTPResponse() *http.Response {
@@ -63,6 +73,8 @@ func TestResponseData_MarshalBinary(t *testing.T) {
 	respData.UUID = u
 	respData.Header.Del(ResponseCachedHeader)
 	respData.Header.Del(ResponseSourceHeader)
+	respData.Header.Del(httputils.ETagHeader)
+	respData.GeneratedETag = false
 	respData.TimeStamp = testResponseTimeStamp
 
 	data, err := respData.MarshalBinary()
@@ -88,6 +100,32 @@ func TestResponseData_UnmarshalBinary(t *testing.T) {
 	require.Equal(t, u, respData.UUID)
 }
 
+func TestResponseData_BinaryBody(t *testing.T) {
+	// PNG signature and bytes which are not valid UTF-8
+	body := "\x89PNG\r\n\x1a\n\xff\xfe\x00\x80"
+
+	respData := NewResponseData(testResponseHK, testResponseMax, nil)
+	respData.Body = body
+	respData.StatusCode = http.StatusOK
+
+	data, err := respData.MarshalBinary()
+	require.Nil(t, err)
+	require.Contains(t, string(data), `"body":""`)
+	require.Contains(t, string(data), `"body_base64":`)
+
+	result := NewResponseData(testResponseHK, testResponseMax, nil)
+	err = result.UnmarshalBinary(data)
+	require.Nil(t, err)
+	require.Equal(t, body, result.Body)
+	require.Equal(t, http.StatusOK, result.StatusCode)
+
+	// The text body is kept as a string
+	respData.Body = testResponseBody
+	data, err = respData.MarshalBinary()
+	require.Nil(t, err)
+	require.NotContains(t, string(data), "body_base64")
+}
+
 func TestResponseData_Write(t *testing.T) {
 	resp := initHTTPResponse()
 	defer resp.Body.Close()
@@ -108,6 +146,8 @@ func TestResponseData_Write(t *testing.T) {
 	require.Equal(t, resp.StatusCode, result.StatusCode)
 	result.Header.Del(ResponseCachedHeader)
 	result.Header.Del(ResponseSourceHeader)
+	require.Equal(t, httputils.GenerateETag([]byte(testResponseBody)), result.Header.Get(httputils.ETagHeader))
+	result.Header.Del(httputils.ETagHeader)
 	require.Equal(t, resp.Header, result.Header)
 	bodyBytes, err := ioutil.ReadAll(result.Body)
 	require.Nil(t, err)
@@ -129,7 +169,281 @@ func TestResponseData_Read(t *testing.T) {
 	h := make(http.Header)
 	h.Add(testResponseHeaderName, testResponseHeaderValue)
 	respData.Header.Del(ResponseCachedHeader)
+	require.Equal(t, httputils.GenerateETag([]byte(testResponseBody)), respData.Header.Get(httputils.ETagHeader))
+	respData.Header.Del(httputils.ETagHeader)
 	require.Equal(t, h, respData.Header)
 	require.NotEmpty(t, respData.TimeStamp)
 	require.NotEmpty(t, respData.UUID)
 }
+
+func TestResponseData_Stale(t *testing.T) {
+	respData := NewResponseData(testResponseHK, testResponseMax, nil)
+	require.NotNil(t, respData)
+	require.False(t, respData.Stale())
+
+	respData.MarkStale()
+	require.True(t, respData.Stale())
+
+	// Successful read resets stale flag
+	resp := initHTTPResponse()
+	defer resp.Body.Close()
+	require.Nil(t, respData.Read(resp))
+	require.False(t, respData.Stale())
+	require.True(t, respData.Age() < time.Minute)
+}
+
+func TestResponseData_ReadKeepsETag(t *testing.T) {
+	resp := initHTTPResponse()
+	defer resp.Body.Close()
+	resp.Header.Set(httputils.ETagHeader, `"v1"`)
+
+	respData := NewResponseData(testResponseHK, testResponseMax, nil)
+	require.Nil(t, respData.Read(resp))
+	require.Equal(t, `"v1"`, respData.Header.Get(httputils.ETagHeader))
+
+	etag, lastModified := respData.Validators()
+	require.Equal(t, `"v1"`, etag)
+	require.Empty(t, lastModified)
+
+	// The generated ETag is not a validator for backend
+	resp = initHTTPResponse()
+	defer resp.Body.Close()
+	resp.Header.Set(httputils.LastModifiedHeader, testLastModified)
+	require.Nil(t, respData.Read(resp))
+	require.True(t, respData.GeneratedETag)
+	etag, lastModified = respData.Validators()
+	require.Empty(t, etag)
+	require.Equal(t, testLastModified, lastModified)
+
+	// The ETag given by backend on revalidation is a validator
+	notModified := &http.Response{StatusCode: http.StatusNotModified, Header: make(http.Header)}
+	notModified.Header.Set(httputils.ETagHeader, `"v2"`)
+	respData.Revalidate(notModified)
+	etag, _ = respData.Validators()
+	require.Equal(t, `"v2"`, etag)
+}
+
+func TestResponseData_WriteConditional(t *testing.T) {
+	resp := initHTTPResponse()
+	defer resp.Body.Close()
+	resp.Header.Set(httputils.LastModifiedHeader, testLastModified)
+	resp.Header.Set("Cache-Control", "max-age=60")
+
+	respData := NewResponseData(testResponseHK, testResponseMax, nil)
+	require.Nil(t, respData.Read(resp))
+	etag := httputils.GenerateETag([]byte(testResponseBody))
+
+	tests := []struct {
+		name         string
+		method       string
+		header       map[string]string
+		expectedCode int
+	}{
+		{
+			name:         "without conditions",
+			method:       http.MethodGet,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "matched If-None-Match",
+			method:       http.MethodGet,
+			header:       map[string]string{httputils.IfNoneMatchHeader: `"other", W/` + etag},
+			expectedCode: http.StatusNotModified,
+		},
+		{
+			name:         "not matched If-None-Match",
+			method:       http.MethodGet,
+			header:       map[string]string{httputils.IfNoneMatchHeader: `"other"`},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "If-None-Match has priority over If-Modified-Since",
+			method: http.MethodGet,
+			header: map[string]string{
+				httputils.IfNoneMatchHeader:     `"other"`,
+				httputils.IfModifiedSinceHeader: testLastModified,
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "not modified since",
+			method:       http.MethodGet,
+			header:       map[string]string{httputils.IfModifiedSinceHeader: testLastModified},
+			expectedCode: http.StatusNotModified,
+		},
+		{
+			name:         "modified since",
+			method:       http.MethodGet,
+			header:       map[string]string{httputils.IfModifiedSinceHeader: "Mon, 18 Jan 2021 10:00:00 GMT"},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "conditions are ignored for POST",
+			method:       http.MethodPost,
+			header:       map[string]string{httputils.IfNoneMatchHeader: etag},
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://localhost/test", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+			require.Nil(t, respData.WriteConditional(w, req, ResponseCache))
+
+			result := w.Result()
+			defer result.Body.Close()
+			require.Equal(t, tt.expectedCode, result.StatusCode)
+			require.Equal(t, etag, result.Header.Get(httputils.ETagHeader))
+			require.Equal(t, "max-age=60", result.Header.Get("Cache-Control"))
+			require.Equal(t, ResponseCache.String(), result.Header.Get(ResponseSourceHeader))
+
+			bodyBytes, err := ioutil.ReadAll(result.Body)
+			require.Nil(t, err)
+			if tt.expectedCode == http.StatusNotModified {
+				require.Empty(t, bodyBytes)
+				require.Empty(t, result.Header.Get(testResponseHeaderName))
+			} else {
+				require.Equal(t, testResponseBody, string(bodyBytes))
+			}
+		})
+	}
+}
+
+func TestResponseData_Compress(t *testing.T) {
+	body := strings.Repeat(testResponseBody, 100)
+	resp := initHTTPResponse()
+	resp.Body = ioutil.NopCloser(bytes.NewBufferString(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	defer resp.Body.Close()
+
+	respData := NewResponseData(testResponseHK, testResponseMax, nil)
+	err := respData.Read(resp)
+	require.Nil(t, err)
+	etag := respData.Header.Get(httputils.ETagHeader)
+
+	// The small body is not compressed
+	err = respData.Compress(httputils.EncodingGzip, len(body)+1)
+	require.Nil(t, err)
+	require.Equal(t, "", respData.Encoding)
+
+	err = respData.Compress(httputils.EncodingGzip, 0)
+	require.Nil(t, err)
+	require.Equal(t, httputils.EncodingGzip, respData.Encoding)
+	require.Empty(t, respData.Body)
+	require.Less(t, len(respData.CompressedBody), len(body))
+
+	// The compressed body is kept by external cache
+	data, err := respData.MarshalBinary()
+	require.Nil(t, err)
+	restored := &ResponseData{}
+	err = restored.UnmarshalBinary(data)
+	require.Nil(t, err)
+	require.Equal(t, respData.CompressedBody, restored.CompressedBody)
+
+	etagBackend, _ := restored.Validators()
+	require.Empty(t, etagBackend)
+
+	// The client which accepts encoding gets compressed body
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(httputils.AcceptEncodingHeader, "gzip, br")
+	w := httptest.NewRecorder()
+	err = restored.WriteConditional(w, req, ResponseCache)
+	require.Nil(t, err)
+	require.Equal(t, httputils.EncodingGzip, w.Header().Get(httputils.ContentEncodingHeader))
+	require.Equal(t, httputils.AcceptEncodingHeader, w.Header().Get("Vary"))
+	require.Equal(t, httputils.WeakETag(etag), w.Header().Get(httputils.ETagHeader))
+	require.Empty(t, w.Header().Get("Content-Length"))
+	require.Equal(t, respData.CompressedBody, w.Body.Bytes())
+
+	// Other client gets decompressed body
+	w = httptest.NewRecorder()
+	err = restored.WriteConditional(w, httptest.NewRequest(http.MethodGet, "/", nil), ResponseCache)
+	require.Nil(t, err)
+	require.Empty(t, w.Header().Get(httputils.ContentEncodingHeader))
+	require.Equal(t, etag, w.Header().Get(httputils.ETagHeader))
+	require.Equal(t, body, w.Body.String())
+
+	// The body encoded by backend is not compressed again
+	resp = initHTTPResponse()
+	resp.Header.Set(httputils.ContentEncodingHeader, "br")
+	err = respData.Read(resp)
+	require.Nil(t, err)
+	require.Empty(t, respData.Encoding)
+	err = respData.Compress(httputils.EncodingGzip, 0)
+	require.Nil(t, err)
+	require.Empty(t, respData.Encoding)
+}
+
+func TestResponseData_StreamBody(t *testing.T) {
+	body := strings.Repeat(testResponseBody, 100)
+	resp := initHTTPResponse()
+	resp.Body = ioutil.NopCloser(bytes.NewBufferString(body))
+	defer resp.Body.Close()
+
+	respData := NewResponseData(testResponseHK, testResponseMax, nil)
+	err := respData.Read(resp)
+	require.Nil(t, err)
+	err = respData.Compress(httputils.EncodingGzip, 0)
+	require.Nil(t, err)
+
+	// The body is kept in own file by disk cache
+	head, err := respData.MarshalHead()
+	require.Nil(t, err)
+	stored, err := respData.StoredBody()
+	require.Nil(t, err)
+	require.Equal(t, respData.CompressedBody, stored)
+
+	bodyFile := filepath.Join(t.TempDir(), "body")
+	err = ioutil.WriteFile(bodyFile, stored, 0o600)
+	require.Nil(t, err)
+
+	restored := &ResponseData{}
+	err = restored.UnmarshalHead(head, bodyFile)
+	require.Nil(t, err)
+	require.Equal(t, httputils.EncodingGzip, restored.Encoding)
+	require.Empty(t, restored.CompressedBody)
+	etag, _ := restored.Validators()
+	require.Empty(t, etag)
+
+	// The body is streamed from file as is or decompressed
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(httputils.AcceptEncodingHeader, "gzip")
+	w := httptest.NewRecorder()
+	err = restored.WriteConditional(w, req, ResponseCache)
+	require.Nil(t, err)
+	require.Equal(t, stored, w.Body.Bytes())
+
+	w = httptest.NewRecorder()
+	err = restored.WriteConditional(w, httptest.NewRequest(http.MethodGet, "/", nil), ResponseCache)
+	require.Nil(t, err)
+	require.Equal(t, body, w.Body.String())
+
+	err = restored.LoadBody()
+	require.Nil(t, err)
+	require.Equal(t, respData.CompressedBody, restored.CompressedBody)
+}
+
+func TestResponseData_StreamMissingBody(t *testing.T) {
+	respData := NewResponseData(testResponseHK, testResponseMax, nil)
+	respData.StatusCode = http.StatusOK
+	head, err := respData.MarshalHead()
+	require.Nil(t, err)
+
+	restored := &ResponseData{}
+	err = restored.UnmarshalHead(head, filepath.Join(t.TempDir(), "body"))
+	require.Nil(t, err)
+
+	// The missing body is found before anything is written to client
+	w := httptest.NewRecorder()
+	err = restored.WriteConditional(w, httptest.NewRequest(http.MethodGet, "/", nil), ResponseCache)
+	require.True(t, errors.Is(err, ErrBodyUnavailable))
+	require.Empty(t, w.Header())
+	require.False(t, w.Flushed)
+	require.Zero(t, w.Body.Len())
+}
@@ -0,0 +1,86 @@
+package rrdata
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/soldatov-s/accp/internal/httputils"
+	"github.com/valyala/bytebufferpool"
+)
+
+// captureWriter keeps written bytes until they exceed limit, zero limit means no limit.
+// The writes never fail, so the capture doesn't break the stream to client.
+type captureWriter struct {
+	buf      *bytebufferpool.ByteBuffer
+	limit    int64
+	overflow bool
+}
+
+func (c *captureWriter) Write(p []byte) (int, error) {
+	if c.overflow {
+		return len(p), nil
+	}
+
+	if c.limit > 0 && int64(c.buf.Len()+len(p)) > c.limit {
+		c.overflow = true
+		c.buf.Reset()
+		return len(p), nil
+	}
+
+	return c.buf.Write(p)
+}
+
+// Stream writes response of backend to client while it is read and captures body for cache,
+// the capture is dropped and ErrBodyTooLarge is returned if body is larger than maxSize.
+// The 304 is written if response matches validators of request. The headers are written
+// before body, so the ETag generated from body is set only in captured response.
+func (r *ResponseData) Stream(w http.ResponseWriter, req *http.Request, resp *http.Response, src fmt.Stringer, maxSize int64) error {
+	r.readMu.Lock()
+	defer r.readMu.Unlock()
+
+	r.reset(resp)
+	r.Body = ""
+
+	capture := &captureWriter{
+		buf:      bytebufferpool.Get(),
+		limit:    maxSize,
+		overflow: maxSize > 0 && resp.ContentLength > maxSize,
+	}
+	defer bytebufferpool.Put(capture.buf)
+
+	var err error
+	if r.StatusCode == http.StatusOK && req != nil && httputils.NotModified(req, r.Header) {
+		httputils.CopyNotModifiedHeader(w.Header(), r.Header)
+		w.Header().Add(ResponseSourceHeader, src.String())
+		w.WriteHeader(http.StatusNotModified)
+
+		// Client has the body, it is read only for cache
+		if !capture.overflow {
+			var body io.Reader = resp.Body
+			if maxSize > 0 {
+				body = io.LimitReader(resp.Body, maxSize+1)
+			}
+			_, err = io.Copy(capture, body)
+		}
+	} else {
+		httputils.CopyHeader(w.Header(), r.Header)
+		w.Header().Add(ResponseSourceHeader, src.String())
+		w.WriteHeader(r.StatusCode)
+		_, err = io.Copy(w, io.TeeReader(resp.Body, capture))
+	}
+
+	// The partial body is not cached
+	if err != nil {
+		return err
+	}
+
+	if capture.overflow {
+		return ErrBodyTooLarge
+	}
+
+	r.Body = capture.buf.String()
+	r.generateETag(capture.buf.Bytes())
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package rrdata
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/soldatov-s/accp/internal/httputils"
+	"github.com/stretchr/testify/require"
+)
+
+func streamResponse(body string, contentLength int64) *http.Response {
+	return &http.Response{
+		Header:        make(http.Header),
+		StatusCode:    http.StatusOK,
+		ContentLength: contentLength,
+		Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+	}
+}
+
+func TestResponseData_Stream(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		maxSize       int64
+		captured      bool
+	}{
+		{
+			name:          "small body is captured",
+			body:          "small",
+			contentLength: -1,
+			maxSize:       10,
+			captured:      true,
+		},
+		{
+			name:          "large body is streamed only",
+			body:          strings.Repeat("x", 11),
+			contentLength: -1,
+			maxSize:       10,
+		},
+		{
+			name:          "large content length is streamed only",
+			body:          strings.Repeat("x", 11),
+			contentLength: 11,
+			maxSize:       10,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			respData := NewResponseData(testResponseHK, testResponseMax, nil)
+			w := httptest.NewRecorder()
+
+			err := respData.Stream(w, nil, streamResponse(tt.body, tt.contentLength), ResponseBack, tt.maxSize)
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, tt.body, w.Body.String())
+			require.Equal(t, ResponseBack.String(), w.Header().Get(ResponseSourceHeader))
+
+			if !tt.captured {
+				require.True(t, errors.Is(err, ErrBodyTooLarge))
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, tt.body, respData.Body)
+			require.Equal(t, httputils.GenerateETag([]byte(tt.body)), respData.Header.Get(httputils.ETagHeader))
+		})
+	}
+}
+
+func TestResponseData_StreamNotModified(t *testing.T) {
+	resp := streamResponse(testResponseBody, -1)
+	resp.Header.Set(httputils.ETagHeader, `"v1"`)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(httputils.IfNoneMatchHeader, `"v1"`)
+
+	respData := NewResponseData(testResponseHK, testResponseMax, nil)
+	w := httptest.NewRecorder()
+
+	// The client gets 304, but the body is captured for cache
+	err := respData.Stream(w, req, resp, ResponseBack, 0)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusNotModified, w.Code)
+	require.Empty(t, w.Body.String())
+	require.Equal(t, testResponseBody, respData.Body)
+}
+
+func TestResponseData_ReadLimited(t *testing.T) {
+	respData := NewResponseData(testResponseHK, testResponseMax, nil)
+
+	err := respData.ReadLimited(streamResponse(testResponseBody, -1), int64(len(testResponseBody)))
+	require.Nil(t, err)
+	require.Equal(t, testResponseBody, respData.Body)
+
+	// The previous response is kept
+	err = respData.ReadLimited(streamResponse(testResponseBody+"!", -1), int64(len(testResponseBody)))
+	require.True(t, errors.Is(err, ErrBodyTooLarge))
+	require.Equal(t, testResponseBody, respData.Body)
+}
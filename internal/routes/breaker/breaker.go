@@ -0,0 +1,188 @@
+package breaker
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const retryAfterHeader = "Retry-After"
+
+// State is a state of breaker
+type State int
+
+const (
+	// StateClosed passes requests to backend
+	StateClosed State = iota
+	// StateHalfOpen passes one request which checks backend after cooldown
+	StateHalfOpen
+	// StateOpen rejects requests to backend until cooldown is over
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// Status describes breaker for admin API
+type Status struct {
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+	// OpenUntil is an end of cooldown of open breaker
+	OpenUntil *time.Time `json:"open_until,omitempty"`
+}
+
+// Breaker stops requests to failing backend for cooldown after count of consecutive failures.
+// The nil breaker passes all requests.
+type Breaker struct {
+	cfg      *Config
+	onChange func(State)
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	// probing is true while the request of half-open breaker is running
+	probing bool
+}
+
+// NewBreaker creates breaker, onChange is called on every change of state
+func NewBreaker(cfg *Config, onChange func(State)) *Breaker {
+	cfg.SetDefault()
+
+	return &Breaker{cfg: cfg, onChange: onChange}
+}
+
+// setState changes state, mu must be locked
+func (b *Breaker) setState(state State) {
+	if b.state == state {
+		return
+	}
+
+	b.state = state
+	if b.onChange != nil {
+		b.onChange(state)
+	}
+}
+
+// Allow checks that request may be sent to backend, the allowed request must be finished by Done or Cancel
+func (b *Breaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.cfg.Cooldown {
+			return false
+		}
+		b.setState(StateHalfOpen)
+	case StateHalfOpen:
+		if b.probing {
+			return false
+		}
+	default:
+		return true
+	}
+
+	b.probing = true
+
+	return true
+}
+
+// Done finishes request to backend, the failed request of half-open breaker opens it again
+func (b *Breaker) Done(failed bool) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		b.setState(StateClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.cfg.Failures {
+		b.openedAt = time.Now()
+		b.setState(StateOpen)
+	}
+}
+
+// Cancel finishes request which was not sent to backend, the state is not changed
+func (b *Breaker) Cancel() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// State returns current state of breaker
+func (b *Breaker) State() State {
+	if b == nil {
+		return StateClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Status returns status of breaker
+func (b *Breaker) Status() *Status {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &Status{State: b.state.String(), Failures: b.failures}
+	if b.state == StateOpen {
+		until := b.openedAt.Add(b.cfg.Cooldown)
+		s.OpenUntil = &until
+	}
+
+	return s
+}
+
+// WriteResponse answers client instead of backend while breaker is open, msg is a body by default.
+// The Retry-After is set to end of cooldown.
+func (b *Breaker) WriteResponse(w http.ResponseWriter, msg string) {
+	for k, v := range b.cfg.Headers {
+		w.Header().Set(k, v)
+	}
+
+	if s := b.Status(); s.OpenUntil != nil {
+		seconds := math.Ceil(time.Until(*s.OpenUntil).Seconds())
+		w.Header().Set(retryAfterHeader, strconv.Itoa(int(math.Max(seconds, 1))))
+	}
+
+	if b.cfg.Body == "" {
+		http.Error(w, msg, b.cfg.Status)
+		return
+	}
+
+	w.WriteHeader(b.cfg.Status)
+	_, _ = w.Write([]byte(b.cfg.Body))
+}
@@ -0,0 +1,85 @@
+package breaker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNilBreaker(t *testing.T) {
+	var b *Breaker
+	require.True(t, b.Allow())
+	b.Done(true)
+	b.Cancel()
+	require.Equal(t, StateClosed, b.State())
+	require.Nil(t, b.Status())
+}
+
+func TestBreaker(t *testing.T) {
+	states := make([]State, 0)
+	b := NewBreaker(&Config{Failures: 2, Cooldown: 100 * time.Millisecond}, func(s State) {
+		states = append(states, s)
+	})
+
+	// The success resets count of failures
+	require.True(t, b.Allow())
+	b.Done(true)
+	require.True(t, b.Allow())
+	b.Done(false)
+	require.Equal(t, 0, b.Status().Failures)
+
+	for i := 0; i < 2; i++ {
+		require.True(t, b.Allow())
+		b.Done(true)
+	}
+	require.Equal(t, StateOpen, b.State())
+	require.NotNil(t, b.Status().OpenUntil)
+	require.False(t, b.Allow())
+
+	// After cooldown only one request checks backend, the failed check opens breaker again
+	time.Sleep(150 * time.Millisecond)
+	require.True(t, b.Allow())
+	require.Equal(t, StateHalfOpen, b.State())
+	require.False(t, b.Allow())
+	b.Done(true)
+	require.Equal(t, StateOpen, b.State())
+	require.False(t, b.Allow())
+
+	// The canceled check doesn't change state
+	time.Sleep(150 * time.Millisecond)
+	require.True(t, b.Allow())
+	b.Cancel()
+	require.Equal(t, StateHalfOpen, b.State())
+
+	require.True(t, b.Allow())
+	b.Done(false)
+	require.Equal(t, StateClosed, b.State())
+	require.Nil(t, b.Status().OpenUntil)
+
+	require.Equal(t, []State{StateOpen, StateHalfOpen, StateOpen, StateHalfOpen, StateClosed}, states)
+}
+
+func TestWriteResponse(t *testing.T) {
+	b := NewBreaker(&Config{Failures: 1, Cooldown: time.Minute}, nil)
+	require.True(t, b.Allow())
+	b.Done(true)
+
+	w := httptest.NewRecorder()
+	b.WriteResponse(w, "backend is unavailable")
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "60", w.Header().Get(retryAfterHeader))
+	require.Equal(t, "backend is unavailable\n", w.Body.String())
+
+	b.cfg.Status = http.StatusOK
+	b.cfg.Body = "<html>maintenance</html>"
+	b.cfg.Headers = map[string]string{"Content-Type": "text/html"}
+
+	w = httptest.NewRecorder()
+	b.WriteResponse(w, "backend is unavailable")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/html", w.Header().Get("Content-Type"))
+	require.Equal(t, "<html>maintenance</html>", w.Body.String())
+}
@@ -0,0 +1,80 @@
+package breaker
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	defaultCooldown = 30 * time.Second
+	defaultStatus   = http.StatusServiceUnavailable
+)
+
+type Config struct {
+	// Failures is a count of consecutive failures of backend after which breaker opens, zero disables breaker
+	Failures int
+	// Cooldown is a duration during which open breaker rejects requests to backend, after it one request
+	// checks backend
+	Cooldown time.Duration
+	// Status is a status code of response of open breaker, by default 503
+	Status int
+	// Body is a body of response of open breaker, by default it is a text of error
+	Body string
+	// Headers are headers of response of open breaker
+	Headers map[string]string
+}
+
+func (c *Config) SetDefault() {
+	if c.Cooldown == 0 {
+		c.Cooldown = defaultCooldown
+	}
+
+	if c.Status == 0 {
+		c.Status = defaultStatus
+	}
+}
+
+// Enabled checks that breaker is configured
+func (c *Config) Enabled() bool {
+	return c != nil && c.Failures > 0
+}
+
+func (c *Config) Merge(target *Config) *Config {
+	if c == nil {
+		return target
+	}
+
+	result := &Config{
+		Failures: c.Failures,
+		Cooldown: c.Cooldown,
+		Status:   c.Status,
+		Body:     c.Body,
+		Headers:  c.Headers,
+	}
+
+	if target == nil {
+		return result
+	}
+
+	if target.Failures > 0 {
+		result.Failures = target.Failures
+	}
+
+	if target.Cooldown > 0 {
+		result.Cooldown = target.Cooldown
+	}
+
+	if target.Status > 0 {
+		result.Status = target.Status
+	}
+
+	if target.Body != "" {
+		result.Body = target.Body
+	}
+
+	if target.Headers != nil {
+		result.Headers = target.Headers
+	}
+
+	return result
+}
@@ -0,0 +1,53 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDefault(t *testing.T) {
+	c := &Config{}
+	c.SetDefault()
+	require.Equal(t, defaultCooldown, c.Cooldown)
+	require.Equal(t, defaultStatus, c.Status)
+	require.False(t, c.Enabled())
+	require.True(t, (&Config{Failures: 1}).Enabled())
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name           string
+		srcConfig      *Config
+		targetConfig   *Config
+		expectedConfig *Config
+	}{
+		{
+			name:           "src is nil",
+			srcConfig:      nil,
+			targetConfig:   &Config{Failures: 1, Cooldown: time.Second},
+			expectedConfig: &Config{Failures: 1, Cooldown: time.Second},
+		},
+		{
+			name:           "target is nil",
+			srcConfig:      &Config{Failures: 1, Cooldown: time.Second},
+			targetConfig:   nil,
+			expectedConfig: &Config{Failures: 1, Cooldown: time.Second},
+		},
+		{
+			name:           "target is not nil",
+			srcConfig:      &Config{Failures: 1, Cooldown: time.Second, Status: 503},
+			targetConfig:   &Config{Failures: 5, Status: 502, Body: "down", Headers: map[string]string{"Content-Type": "text/html"}},
+			expectedConfig: &Config{Failures: 5, Cooldown: time.Second, Status: 502, Body: "down", Headers: map[string]string{"Content-Type": "text/html"}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cc := tt.srcConfig.Merge(tt.targetConfig)
+			require.Equal(t, tt.expectedConfig, cc)
+		})
+	}
+}
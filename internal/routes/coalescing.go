@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	cacheerrors "github.com/soldatov-s/accp/internal/cache/errors"
+	"github.com/soldatov-s/accp/internal/httputils"
+)
+
+// distributedCoalescing checks that identical requests are coalesced across instances by lock in external cache
+func (r *Route) distributedCoalescing() bool {
+	c := r.parameters.Cache.Coalescing
+	return c != nil && c.Distributed && r.cache.External != nil
+}
+
+// requestAndStore requests response from backend and saves it to cache
+func (r *Route) requestAndStore(baseHK, hk string, w http.ResponseWriter, req *http.Request) {
+	if rrData := r.requestToBack(hk, w, req); rrData != nil {
+		r.store(baseHK, req, rrData)
+	}
+}
+
+// selectCached writes response from cache, it returns false if response is not cached
+func (r *Route) selectCached(hk string, w http.ResponseWriter, req *http.Request) bool {
+	data, err := r.cache.Select(hk)
+	if err != nil {
+		if !errors.Is(err, cacheerrors.ErrNotFound) {
+			r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to get data from cache")
+		}
+		return false
+	}
+
+	r.responseHandle(data, w, req, hk)
+
+	return true
+}
+
+// fetchLocked requests response from backend while lock of key is held, the lock is released after
+// response is saved, so waiting instances find it in external cache
+func (r *Route) fetchLocked(baseHK, hk, token string, w http.ResponseWriter, req *http.Request) {
+	defer func() {
+		if err := r.cache.External.Unlock(hk, token); err != nil {
+			r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to unlock request in external cache")
+		}
+	}()
+
+	// The response may be saved by other instance which released lock just now
+	if r.selectCached(hk, w, req) {
+		return
+	}
+
+	r.requestAndStore(baseHK, hk, w, req)
+}
+
+// fetch requests response from backend and saves it to cache. With distributed coalescing only
+// the instance which holds lock of key requests backend, other instances wait for its response
+// in external cache and request backend themselves after timeout.
+func (r *Route) fetch(baseHK, hk string, w http.ResponseWriter, req *http.Request) {
+	if !r.distributedCoalescing() {
+		r.requestAndStore(baseHK, hk, w, req)
+		return
+	}
+
+	cfg := r.parameters.Cache.Coalescing
+	deadline := time.Now().Add(cfg.Wait)
+	for {
+		token, err := r.cache.External.Lock(hk, cfg.LockTTL)
+		if err != nil {
+			r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to lock request in external cache")
+			break
+		}
+
+		// The lock is taken again on every check, so the lock of failed instance or the lock released
+		// without saving of response doesn't make to wait until timeout
+		if token != "" {
+			r.fetchLocked(baseHK, hk, token, w, req)
+			return
+		}
+
+		if time.Now().After(deadline) {
+			r.log.Debug().Str("requestID", httputils.GetRequestID(req)).Msgf("%s: timeout of waiting response of other instance", hk)
+			break
+		}
+
+		select {
+		case <-time.After(cfg.PollInterval):
+		case <-req.Context().Done():
+			return
+		}
+
+		if r.selectCached(hk, w, req) {
+			return
+		}
+	}
+
+	r.requestAndStore(baseHK, hk, w, req)
+}
@@ -1,6 +1,10 @@
 package routes
 
-import "sort"
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
 
 // Config declares a route configuration
 type Config struct {
@@ -27,3 +31,22 @@ func (m MapConfig) SortKeys() []string {
 
 	return keys
 }
+
+// Validate checks parameters of routes and their subroutes
+func (m MapConfig) Validate() error {
+	for k, v := range m {
+		if v == nil {
+			continue
+		}
+
+		if err := v.Parameters.Validate(); err != nil {
+			return errors.Wrapf(err, "route %s", k)
+		}
+
+		if err := v.Routes.Validate(); err != nil {
+			return errors.Wrapf(err, "route %s", k)
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,18 @@
 package routes
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrEmptyRoute         = errors.New("empty route")
+	ErrWildcardNotLast    = errors.New("wildcard must be the last segment of route")
+	ErrPathParamConflict  = errors.New("conflicting path parameters on the same level")
+	ErrNotCachedRequest   = errors.New("route doesn't cache responses to request")
+	ErrBackendUnavailable = errors.New("backend is unavailable, breaker is open")
+	ErrRefreshSuspended   = errors.New("refresh is suspended after failures")
+)
 
 type ErrDuplicatedRoute struct {
 	route string
@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/soldatov-s/accp/internal/admin"
+	"github.com/soldatov-s/accp/internal/metrics"
+)
+
+const (
+	oversizedMetricName       = "proxy_oversized_responses_total"
+	breakerStateMetricName    = "proxy_breaker_state"
+	breakerRejectedMetricName = "proxy_breaker_rejected_total"
+)
+
+var (
+	oversizedMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: oversizedMetricName,
+			Help: "count of backend responses which are larger than max body size and are passed through uncached",
+		}, []string{"route"})
+	breakerStateMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: breakerStateMetricName,
+			Help: "state of route breaker: 0 - closed, 1 - half-open, 2 - open",
+		}, []string{"route"})
+	breakerRejectedMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: breakerRejectedMetricName,
+			Help: "count of requests and refreshes which are not sent to backend by open breaker",
+		}, []string{"route"})
+	registerMetricsOnce sync.Once
+)
+
+// registerMetrics registers metrics of routes in admin, the metrics are common for all routes
+func registerMetrics(ctx context.Context) error {
+	a := admin.Get(ctx)
+	if a == nil {
+		return nil
+	}
+
+	var err error
+	registerMetricsOnce.Do(func() {
+		if err = a.RegisterMetric(oversizedMetricName, &metrics.MetricOptions{Metric: oversizedMetric}); err != nil {
+			return
+		}
+
+		if err = a.RegisterMetric(breakerStateMetricName, &metrics.MetricOptions{Metric: breakerStateMetric}); err != nil {
+			return
+		}
+
+		err = a.RegisterMetric(breakerRejectedMetricName, &metrics.MetricOptions{Metric: breakerRejectedMetric})
+	})
+
+	return err
+}
@@ -7,7 +7,10 @@ import (
 	"github.com/soldatov-s/accp/internal/cache"
 	"github.com/soldatov-s/accp/internal/httpclient"
 	"github.com/soldatov-s/accp/internal/limits"
+	"github.com/soldatov-s/accp/internal/routes/breaker"
 	"github.com/soldatov-s/accp/internal/routes/refresh"
+	"github.com/soldatov-s/accp/internal/routes/retry"
+	"github.com/soldatov-s/accp/internal/upstream"
 	"github.com/soldatov-s/accp/x/helper"
 )
 
@@ -22,7 +25,11 @@ func defaultMethods() helper.Arguments {
 }
 
 type Parameters struct {
-	DSN        string
+	DSN string
+	// Upstreams are additional DSNs of backends, requests are balanced between DSN and Upstreams
+	Upstreams []string
+	// Balancer is a configuration of balancing between upstreams
+	Balancer   *upstream.Config
 	TTL        time.Duration
 	Limits     limits.MapConfig
 	Refresh    *refresh.Config
@@ -40,6 +47,16 @@ type Parameters struct {
 	// - union src and target, default
 	// - overwrite src by target
 	MergeStrategy string
+	// MaxRequestBody is a max size of request body in bytes, the larger requests are answered 413
+	// before introspection, zero means no limit
+	MaxRequestBody int64
+	// MaxResponseBody is a max size of cached response body in bytes, the larger responses of backend
+	// are passed through uncached, zero means no limit
+	MaxResponseBody int64
+	// Breaker stops requests and refreshes to failing backend for cooldown, it is disabled by default
+	Breaker *breaker.Config
+	// Retry is a policy of retries of requests to backend, it is disabled by default
+	Retry *retry.Config
 }
 
 func (p *Parameters) SetDefault() {
@@ -69,6 +86,20 @@ func (p *Parameters) SetDefault() {
 
 	p.Pool.SetDefault()
 
+	if p.Balancer == nil {
+		p.Balancer = &upstream.Config{}
+	}
+
+	p.Balancer.SetDefault()
+
+	if p.Breaker != nil {
+		p.Breaker.SetDefault()
+	}
+
+	if p.Retry != nil {
+		p.Retry.SetDefault()
+	}
+
 	if p.Limits == nil {
 		p.Limits = limits.NewMapConfig()
 	}
@@ -82,6 +113,56 @@ func (p *Parameters) SetDefault() {
 	}
 }
 
+// Validate checks parameters which can't be fixed by defaults
+func (p *Parameters) Validate() error {
+	if p == nil {
+		return nil
+	}
+
+	if err := p.Cache.Validate(); err != nil {
+		return err
+	}
+
+	if p.Balancer == nil {
+		return nil
+	}
+
+	return p.Balancer.Validate()
+}
+
+// Exclude returns copy of parameters for excluded route, requests to excluded route
+// bypass introspection, captcha, limits and cache
+func (p *Parameters) Exclude() *Parameters {
+	result := p.Merge(nil)
+	if result == nil {
+		result = &Parameters{}
+	}
+
+	result.NotIntrospect = true
+	result.NotCaptcha = true
+	result.Cache = &cache.Config{Disabled: true}
+	result.Refresh = nil
+	result.Limits = limits.NewMapConfig()
+	result.SetDefault()
+
+	return result
+}
+
+// PassThrough returns copy of parameters for route which proxies requests without cache,
+// introspection, captcha and limits are kept
+func (p *Parameters) PassThrough() *Parameters {
+	result := p.Merge(nil)
+	if result == nil {
+		result = &Parameters{}
+	}
+
+	result.Cache = &cache.Config{Disabled: true}
+	result.Refresh = nil
+	result.SetDefault()
+
+	return result
+}
+
 // nolint : gocyclo
 func (p *Parameters) Merge(target *Parameters) *Parameters {
 	if p == nil {
@@ -90,6 +171,8 @@ func (p *Parameters) Merge(target *Parameters) *Parameters {
 
 	result := &Parameters{
 		DSN:                 p.DSN,
+		Upstreams:           p.Upstreams,
+		Balancer:            p.Balancer,
 		TTL:                 p.TTL,
 		Cache:               p.Cache,
 		Refresh:             p.Refresh,
@@ -101,6 +184,10 @@ func (p *Parameters) Merge(target *Parameters) *Parameters {
 		IgnoreCapchaKey:     p.IgnoreCapchaKey,
 		IntrospectHydration: p.IntrospectHydration,
 		Methods:             p.Methods,
+		MaxRequestBody:      p.MaxRequestBody,
+		MaxResponseBody:     p.MaxResponseBody,
+		Breaker:             p.Breaker,
+		Retry:               p.Retry,
 	}
 
 	if target == nil {
@@ -127,8 +214,15 @@ func (p *Parameters) Merge(target *Parameters) *Parameters {
 		result.IntrospectHydration = target.IntrospectHydration
 	}
 
-	if target.DSN != "" {
+	// DSN and Upstreams are overwritten together, the route with own backends
+	// must not be balanced to backends of parent
+	if target.DSN != "" || len(target.Upstreams) > 0 {
 		result.DSN = target.DSN
+		result.Upstreams = target.Upstreams
+	}
+
+	if target.Balancer != nil {
+		result.Balancer = p.Balancer.Merge(target.Balancer)
 	}
 
 	if target.TTL > 0 {
@@ -159,5 +253,38 @@ func (p *Parameters) Merge(target *Parameters) *Parameters {
 		result.IgnoreCapchaKey = target.IgnoreCapchaKey
 	}
 
+	if target.MaxRequestBody > 0 {
+		result.MaxRequestBody = target.MaxRequestBody
+	}
+
+	if target.MaxResponseBody > 0 {
+		result.MaxResponseBody = target.MaxResponseBody
+	}
+
+	if target.Breaker != nil {
+		result.Breaker = p.Breaker.Merge(target.Breaker)
+	}
+
+	if target.Retry != nil {
+		result.Retry = p.Retry.Merge(target.Retry)
+	}
+
+	return result
+}
+
+// DSNList returns DSN and Upstreams without duplicates
+func (p *Parameters) DSNList() []string {
+	result := make([]string, 0, len(p.Upstreams)+1)
+	if p.DSN != "" {
+		result = append(result, p.DSN)
+	}
+
+	for _, v := range p.Upstreams {
+		if v == "" || helper.StringInSlice(v, result) {
+			continue
+		}
+		result = append(result, v)
+	}
+
 	return result
 }
@@ -8,7 +8,10 @@ import (
 	"github.com/soldatov-s/accp/internal/cache"
 	"github.com/soldatov-s/accp/internal/httpclient"
 	"github.com/soldatov-s/accp/internal/limits"
+	"github.com/soldatov-s/accp/internal/routes/breaker"
 	"github.com/soldatov-s/accp/internal/routes/refresh"
+	"github.com/soldatov-s/accp/internal/routes/retry"
+	"github.com/soldatov-s/accp/internal/upstream"
 	"github.com/soldatov-s/accp/x/helper"
 	"github.com/stretchr/testify/require"
 )
@@ -30,6 +33,8 @@ func TestSetDefault(t *testing.T) {
 				require.NotNil(t, p.Pool)
 				require.NotEmpty(t, p.Pool.Size)
 				require.NotEmpty(t, p.Pool.Timeout)
+				require.NotNil(t, p.Balancer)
+				require.Equal(t, upstream.BalancingRoundRobin, p.Balancer.Balancing)
 				require.NotNil(t, p.Limits)
 				require.Equal(t, 0, len(p.Limits))
 			},
@@ -213,3 +218,129 @@ func TestMerge(t *testing.T) {
 		})
 	}
 }
+
+func TestExclude(t *testing.T) {
+	p := &Parameters{
+		DSN: "http://localhost:10000",
+		Cache: &cache.Config{
+			Disabled: false,
+		},
+	}
+	p.SetDefault()
+	p.Limits.SetDefault()
+
+	e := p.Exclude()
+	require.Equal(t, p.DSN, e.DSN)
+	require.True(t, e.NotIntrospect)
+	require.True(t, e.NotCaptcha)
+	require.True(t, e.Cache.Disabled)
+	require.Nil(t, e.Refresh)
+	require.Equal(t, 0, len(e.Limits))
+
+	// source parameters not changed
+	require.False(t, p.Cache.Disabled)
+	require.NotEqual(t, 0, len(p.Limits))
+
+	var nilParams *Parameters
+	e = nilParams.Exclude()
+	require.NotNil(t, e)
+	require.True(t, e.Cache.Disabled)
+}
+
+func TestPassThrough(t *testing.T) {
+	p := &Parameters{
+		DSN: "http://localhost:10000",
+		Cache: &cache.Config{
+			Disabled: false,
+		},
+	}
+	p.SetDefault()
+	p.Limits.SetDefault()
+
+	e := p.PassThrough()
+	require.Equal(t, p.DSN, e.DSN)
+	require.False(t, e.NotIntrospect)
+	require.True(t, e.Cache.Disabled)
+	require.Nil(t, e.Refresh)
+	require.Equal(t, len(p.Limits), len(e.Limits))
+
+	// source parameters not changed
+	require.False(t, p.Cache.Disabled)
+
+	var nilParams *Parameters
+	e = nilParams.PassThrough()
+	require.NotNil(t, e)
+	require.True(t, e.Cache.Disabled)
+}
+
+func TestMergeUpstreams(t *testing.T) {
+	p := &Parameters{
+		DSN:       "http://backend1:9000",
+		Upstreams: []string{"http://backend2:9000"},
+		Balancer:  &upstream.Config{Balancing: upstream.BalancingLeastConn},
+	}
+
+	// target without backends inherits backends of src
+	cc := p.Merge(&Parameters{Balancer: &upstream.Config{MaxFails: 3}})
+	require.Equal(t, p.DSN, cc.DSN)
+	require.Equal(t, p.Upstreams, cc.Upstreams)
+	require.Equal(t, upstream.BalancingLeastConn, cc.Balancer.Balancing)
+	require.Equal(t, 3, cc.Balancer.MaxFails)
+
+	// target with own backends overwrites all backends of src
+	cc = p.Merge(&Parameters{Upstreams: []string{"http://backend3:9000"}})
+	require.Equal(t, "", cc.DSN)
+	require.Equal(t, []string{"http://backend3:9000"}, cc.Upstreams)
+}
+
+func TestDSNList(t *testing.T) {
+	p := &Parameters{
+		DSN:       "http://backend1:9000",
+		Upstreams: []string{"http://backend2:9000", "http://backend1:9000", ""},
+	}
+	require.Equal(t, []string{"http://backend1:9000", "http://backend2:9000"}, p.DSNList())
+
+	p = &Parameters{}
+	require.Equal(t, 0, len(p.DSNList()))
+}
+
+func TestMergeBodyLimits(t *testing.T) {
+	p := &Parameters{MaxRequestBody: 1024, MaxResponseBody: 2048}
+
+	cc := p.Merge(&Parameters{})
+	require.Equal(t, int64(1024), cc.MaxRequestBody)
+	require.Equal(t, int64(2048), cc.MaxResponseBody)
+
+	cc = p.Merge(&Parameters{MaxRequestBody: 10, MaxResponseBody: 20})
+	require.Equal(t, int64(10), cc.MaxRequestBody)
+	require.Equal(t, int64(20), cc.MaxResponseBody)
+
+	// The limits are kept for excluded routes
+	require.Equal(t, int64(1024), p.Exclude().MaxRequestBody)
+}
+
+func TestMergeBreaker(t *testing.T) {
+	p := &Parameters{Breaker: &breaker.Config{Failures: 5, Cooldown: time.Minute}}
+
+	cc := p.Merge(&Parameters{})
+	require.Equal(t, p.Breaker, cc.Breaker)
+
+	cc = p.Merge(&Parameters{Breaker: &breaker.Config{Failures: 2}})
+	require.Equal(t, &breaker.Config{Failures: 2, Cooldown: time.Minute}, cc.Breaker)
+
+	cc = (&Parameters{}).Merge(&Parameters{Breaker: &breaker.Config{Failures: 2}})
+	require.Equal(t, &breaker.Config{Failures: 2}, cc.Breaker)
+}
+
+func TestMergeRetry(t *testing.T) {
+	p := &Parameters{Retry: &retry.Config{Attempts: 3, Delay: time.Second}}
+
+	cc := p.Merge(&Parameters{})
+	require.Equal(t, p.Retry, cc.Retry)
+
+	cc = p.Merge(&Parameters{Retry: &retry.Config{Attempts: 2}})
+	require.Equal(t, &retry.Config{Attempts: 2, Delay: time.Second}, cc.Retry)
+
+	// The retries are kept for excluded routes
+	require.Equal(t, 3, p.Exclude().Retry.Attempts)
+}
@@ -0,0 +1,94 @@
+package refresh
+
+import (
+	"sync"
+	"time"
+)
+
+// Backoff suspends refreshes after failure, the delay is doubled on every consecutive failure.
+// The nil backoff allows all refreshes.
+type Backoff struct {
+	min   time.Duration
+	max   time.Duration
+	mu    sync.Mutex
+	delay time.Duration
+	until time.Time
+}
+
+// NewBackoff creates backoff by config, it returns nil if backoff is disabled
+func NewBackoff(cfg *Config) *Backoff {
+	if cfg == nil || cfg.Backoff <= 0 {
+		return nil
+	}
+
+	b := &Backoff{min: cfg.Backoff, max: cfg.MaxBackoff}
+	if b.max < b.min {
+		b.max = b.min
+	}
+
+	return b
+}
+
+// Allow checks that refresh may be started. After failure only one refresh is allowed per delay,
+// so the concurrent refreshes don't pile up on failing backend.
+func (b *Backoff) Allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(b.until) {
+		return false
+	}
+
+	if b.delay > 0 {
+		b.until = now.Add(b.delay)
+	}
+
+	return true
+}
+
+// Done finishes refresh, the successful refresh resets delay
+func (b *Backoff) Done(failed bool) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		b.delay = 0
+		b.until = time.Time{}
+		return
+	}
+
+	switch {
+	case b.delay == 0:
+		b.delay = b.min
+	case b.delay < b.max/2:
+		b.delay *= 2
+	default:
+		b.delay = b.max
+	}
+	b.until = time.Now().Add(b.delay)
+}
+
+// Until returns end of current delay, it is zero if refreshes are not suspended
+func (b *Backoff) Until() time.Time {
+	if b == nil {
+		return time.Time{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if time.Now().Before(b.until) {
+		return b.until
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,44 @@
+package refresh
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBackoff(t *testing.T) {
+	require.Nil(t, NewBackoff(nil))
+	require.Nil(t, NewBackoff(&Config{}))
+
+	b := NewBackoff(&Config{Backoff: time.Second})
+	require.Equal(t, time.Second, b.max)
+}
+
+func TestBackoff(t *testing.T) {
+	var nilBackoff *Backoff
+	require.True(t, nilBackoff.Allow())
+	nilBackoff.Done(true)
+	require.True(t, nilBackoff.Until().IsZero())
+
+	b := NewBackoff(&Config{Backoff: 50 * time.Millisecond, MaxBackoff: 150 * time.Millisecond})
+	require.True(t, b.Allow())
+	require.True(t, b.Allow())
+
+	// The delay is doubled on every failure up to max
+	for _, expected := range []time.Duration{50, 100, 150, 150} {
+		b.Done(true)
+		require.Equal(t, expected*time.Millisecond, b.delay)
+		require.False(t, b.Allow())
+	}
+
+	// After delay only one refresh is allowed until it is finished
+	time.Sleep(200 * time.Millisecond)
+	require.True(t, b.Allow())
+	require.False(t, b.Allow())
+
+	b.Done(false)
+	require.True(t, b.Until().IsZero())
+	require.True(t, b.Allow())
+	require.True(t, b.Allow())
+}
@@ -5,6 +5,11 @@ import "time"
 const (
 	defaultMaxCount = 100
 	defaultTime     = 10 * time.Second
+	defaultWorkers  = 10
+	// defaultMaxBackoff is a max delay of refreshes after failures
+	defaultMaxBackoff = time.Minute
+	// defaultJitterPart is a part of refresh period which is used as jitter by default
+	defaultJitterPart = 10
 )
 
 type Config struct {
@@ -12,6 +17,21 @@ type Config struct {
 	MaxCount int
 	// Time - the refresh period
 	Time time.Duration
+	// Workers is a max count of parallel refreshes by time
+	Workers int
+	// Jitter is a max random delay which is added to refresh period of every key, so the refreshes
+	// of keys cached at the same time are spread, by default it is a tenth of period
+	Jitter time.Duration
+	// MaxRate is a max count of refreshes by time per second, zero means no limit
+	MaxRate float64
+	// HotOnly enables refresh by time only of keys which were requested since the previous refresh,
+	// the cold keys are not refreshed and expire
+	HotOnly bool
+	// Backoff is a delay of refreshes after failed refresh, it is doubled on every consecutive failure,
+	// zero disables backoff
+	Backoff time.Duration
+	// MaxBackoff is a max delay of refreshes after failures
+	MaxBackoff time.Duration
 }
 
 func (c *Config) SetDefault() {
@@ -22,6 +42,14 @@ func (c *Config) SetDefault() {
 	if c.Time == 0 {
 		c.Time = defaultTime
 	}
+
+	if c.Workers <= 0 {
+		c.Workers = defaultWorkers
+	}
+
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = defaultMaxBackoff
+	}
 }
 
 func (c *Config) Merge(target *Config) *Config {
@@ -30,8 +58,14 @@ func (c *Config) Merge(target *Config) *Config {
 	}
 
 	result := &Config{
-		MaxCount: c.MaxCount,
-		Time:     c.Time,
+		MaxCount:   c.MaxCount,
+		Time:       c.Time,
+		Workers:    c.Workers,
+		Jitter:     c.Jitter,
+		MaxRate:    c.MaxRate,
+		HotOnly:    c.HotOnly,
+		Backoff:    c.Backoff,
+		MaxBackoff: c.MaxBackoff,
 	}
 
 	if target == nil {
@@ -46,5 +80,29 @@ func (c *Config) Merge(target *Config) *Config {
 		result.Time = target.Time
 	}
 
+	if target.Workers > 0 {
+		result.Workers = target.Workers
+	}
+
+	if target.Jitter > 0 {
+		result.Jitter = target.Jitter
+	}
+
+	if target.MaxRate > 0 {
+		result.MaxRate = target.MaxRate
+	}
+
+	if target.HotOnly {
+		result.HotOnly = true
+	}
+
+	if target.Backoff > 0 {
+		result.Backoff = target.Backoff
+	}
+
+	if target.MaxBackoff > 0 {
+		result.MaxBackoff = target.MaxBackoff
+	}
+
 	return result
 }
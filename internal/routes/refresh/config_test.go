@@ -12,6 +12,10 @@ func TestSetDefault(t *testing.T) {
 	c.SetDefault()
 	require.Equal(t, defaultMaxCount, c.MaxCount)
 	require.Equal(t, defaultTime, c.Time)
+	require.Equal(t, defaultWorkers, c.Workers)
+	require.Zero(t, c.Jitter)
+	require.Zero(t, c.Backoff)
+	require.Equal(t, defaultMaxBackoff, c.MaxBackoff)
 }
 
 func TestMerge(t *testing.T) {
@@ -39,6 +43,28 @@ func TestMerge(t *testing.T) {
 			targetConfig:   &Config{MaxCount: 5, Time: 10 * time.Second},
 			expectedConfig: &Config{MaxCount: 5, Time: 10 * time.Second},
 		},
+		{
+			name:      "target overrides scheduler",
+			srcConfig: &Config{MaxCount: 1, Time: 2 * time.Second, Workers: 10, Jitter: time.Second},
+			targetConfig: &Config{
+				Workers:    2,
+				Jitter:     100 * time.Millisecond,
+				MaxRate:    5,
+				HotOnly:    true,
+				Backoff:    time.Second,
+				MaxBackoff: time.Minute,
+			},
+			expectedConfig: &Config{
+				MaxCount:   1,
+				Time:       2 * time.Second,
+				Workers:    2,
+				Jitter:     100 * time.Millisecond,
+				MaxRate:    5,
+				HotOnly:    true,
+				Backoff:    time.Second,
+				MaxBackoff: time.Minute,
+			},
+		},
 	}
 
 	for _, tt := range tests {
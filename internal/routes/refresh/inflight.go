@@ -0,0 +1,51 @@
+package refresh
+
+import "sync"
+
+// Inflight tracks running refreshes by key, so the requests which need refreshed response wait
+// for running refresh instead of starting own one
+type Inflight struct {
+	mu sync.Mutex
+	// running are channels of running refreshes, they are closed when refresh is done
+	running map[string]chan struct{}
+}
+
+func NewInflight() *Inflight {
+	return &Inflight{running: make(map[string]chan struct{})}
+}
+
+// Start marks that refresh of key started, it returns false if refresh of key is running.
+// Done must be called after refresh.
+func (f *Inflight) Start(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.running[key]; ok {
+		return false
+	}
+	f.running[key] = make(chan struct{})
+
+	return true
+}
+
+// Done finishes refresh of key and wakes up waiting requests
+func (f *Inflight) Done(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if ch, ok := f.running[key]; ok {
+		close(ch)
+		delete(f.running, key)
+	}
+}
+
+// Wait waits until running refresh of key is done, it returns at once if refresh is not running
+func (f *Inflight) Wait(key string) {
+	f.mu.Lock()
+	ch, ok := f.running[key]
+	f.mu.Unlock()
+
+	if ok {
+		<-ch
+	}
+}
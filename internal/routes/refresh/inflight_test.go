@@ -0,0 +1,41 @@
+package refresh
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInflight(t *testing.T) {
+	f := NewInflight()
+	require.True(t, f.Start("key"))
+	require.False(t, f.Start("key"))
+	require.True(t, f.Start("other"))
+
+	// The waiting request is blocked until refresh is done
+	done := make(chan struct{})
+	go func() {
+		f.Wait("key")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		require.Fail(t, "wait returned before refresh is done")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	f.Done("key")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.Fail(t, "wait didn't return after refresh is done")
+	}
+
+	// The refresh may be started again, the wait without refresh returns at once
+	require.True(t, f.Start("key"))
+	f.Done("key")
+	f.Wait("key")
+	f.Done("unknown")
+}
@@ -0,0 +1,261 @@
+package refresh
+
+import (
+	"container/heap"
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// item is a key scheduled for refresh
+type item struct {
+	key      string
+	deadline time.Time
+	// hit is true if key was requested since the previous refresh
+	hit bool
+	// index is an index of item in queue, it is -1 while key is refreshed
+	index int
+}
+
+// itemQueue is a heap of items ordered by deadline
+type itemQueue []*item
+
+func (q itemQueue) Len() int { return len(q) }
+
+func (q itemQueue) Less(i, j int) bool { return q[i].deadline.Before(q[j].deadline) }
+
+func (q itemQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *itemQueue) Push(x interface{}) {
+	it := x.(*item)
+	it.index = len(*q)
+	*q = append(*q, it)
+}
+
+func (q *itemQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	it.index = -1
+	*q = old[:n-1]
+
+	return it
+}
+
+// Scheduler refreshes keys by time. Every key has own deadline which is shifted by random jitter,
+// so the keys cached at the same time are not refreshed at the same instant. The refreshes run
+// in pool of workers and their rate is capped.
+type Scheduler struct {
+	cfg     *Config
+	refresh func(key string) bool
+	mu      sync.Mutex
+	items   map[string]*item
+	queue   itemQueue
+	// wake wakes up scheduler when deadline of the first item is changed
+	wake chan struct{}
+	jobs chan string
+}
+
+// NewScheduler creates and starts scheduler, it is stopped when ctx is done. The refresh returns
+// false if key is not cached anymore, such key is not scheduled again.
+func NewScheduler(ctx context.Context, cfg *Config, refresh func(key string) bool) *Scheduler {
+	cfg.SetDefault()
+
+	s := &Scheduler{
+		cfg:     cfg,
+		refresh: refresh,
+		items:   make(map[string]*item),
+		wake:    make(chan struct{}, 1),
+		jobs:    make(chan string),
+	}
+
+	var limit <-chan time.Time
+	if cfg.MaxRate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.MaxRate))
+		go func() {
+			<-ctx.Done()
+			ticker.Stop()
+		}()
+		limit = ticker.C
+	}
+
+	go s.run(ctx)
+	for i := 0; i < cfg.Workers; i++ {
+		go s.work(ctx, limit)
+	}
+
+	return s
+}
+
+// Add schedules refresh of key after period, the scheduled key is kept as is
+func (s *Scheduler) Add(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[key]; ok {
+		return
+	}
+
+	s.push(&item{key: key}, time.Now())
+}
+
+// Hit marks that key was requested, the key which is not scheduled is scheduled
+func (s *Scheduler) Hit(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if it, ok := s.items[key]; ok {
+		it.hit = true
+		return
+	}
+
+	s.push(&item{key: key, hit: true}, time.Now())
+}
+
+// Len returns count of scheduled keys
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.items)
+}
+
+// push schedules item after period with jitter, mu must be locked
+func (s *Scheduler) push(it *item, now time.Time) {
+	it.deadline = now.Add(s.cfg.Time)
+	if jitter := s.jitter(); jitter > 0 {
+		it.deadline = it.deadline.Add(time.Duration(rand.Int63n(int64(jitter)))) // nolint : gosec
+	}
+
+	s.items[it.key] = it
+	heap.Push(&s.queue, it)
+
+	if it.index == 0 {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// jitter returns max random delay of deadline, it depends on period if it is not set, so the
+// jitter of merged config follows its period
+func (s *Scheduler) jitter() time.Duration {
+	if s.cfg.Jitter > 0 {
+		return s.cfg.Jitter
+	}
+
+	return s.cfg.Time / defaultJitterPart
+}
+
+// due returns keys which must be refreshed at now, the cold keys are forgotten if only hot keys are refreshed
+func (s *Scheduler) due(now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]string, 0)
+	for s.queue.Len() > 0 && !s.queue[0].deadline.After(now) {
+		it := heap.Pop(&s.queue).(*item)
+		if s.cfg.HotOnly && !it.hit {
+			delete(s.items, it.key)
+			continue
+		}
+
+		it.hit = false
+		result = append(result, it.key)
+	}
+
+	return result
+}
+
+// next returns duration until the first deadline
+func (s *Scheduler) next(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.queue.Len() == 0 {
+		return s.cfg.Time
+	}
+
+	if d := s.queue[0].deadline.Sub(now); d > 0 {
+		return d
+	}
+
+	return 0
+}
+
+// done schedules key again after refresh, the key which is not cached is forgotten
+func (s *Scheduler) done(key string, keep bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.items[key]
+	if !ok {
+		return
+	}
+
+	if !keep {
+		delete(s.items, key)
+		return
+	}
+
+	s.push(it, time.Now())
+}
+
+func (s *Scheduler) run(ctx context.Context) {
+	timer := time.NewTimer(s.cfg.Time)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+
+		// The sending blocks while all workers are busy, so the keys wait in queue
+		for _, key := range s.due(time.Now()) {
+			select {
+			case s.jobs <- key:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(s.next(time.Now()))
+	}
+}
+
+func (s *Scheduler) work(ctx context.Context, limit <-chan time.Time) {
+	for {
+		var key string
+		select {
+		case <-ctx.Done():
+			return
+		case key = <-s.jobs:
+		}
+
+		if limit != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-limit:
+			}
+		}
+
+		s.done(key, s.refresh(key))
+	}
+}
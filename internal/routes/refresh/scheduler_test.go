@@ -0,0 +1,155 @@
+package refresh
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// counter counts refreshes of keys
+type counter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newCounter() *counter {
+	return &counter{counts: make(map[string]int)}
+}
+
+func (c *counter) refresh(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[key]++
+
+	return true
+}
+
+func (c *counter) get(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.counts[key]
+}
+
+func TestScheduler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := newCounter()
+	s := NewScheduler(ctx, &Config{Time: 100 * time.Millisecond, Jitter: 10 * time.Millisecond}, c.refresh)
+	s.Add("a")
+	s.Add("b")
+	s.Add("a")
+	require.Equal(t, 2, s.Len())
+
+	time.Sleep(50 * time.Millisecond)
+	require.Zero(t, c.get("a"))
+
+	time.Sleep(300 * time.Millisecond)
+	require.GreaterOrEqual(t, c.get("a"), 2)
+	require.GreaterOrEqual(t, c.get("b"), 2)
+	require.Equal(t, 2, s.Len())
+}
+
+func TestSchedulerForget(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var count int32
+	s := NewScheduler(ctx, &Config{Time: 50 * time.Millisecond}, func(string) bool {
+		atomic.AddInt32(&count, 1)
+		return false
+	})
+	s.Add("a")
+
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, int32(1), atomic.LoadInt32(&count))
+	require.Zero(t, s.Len())
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := NewScheduler(ctx, &Config{Time: time.Hour, Jitter: time.Minute}, func(string) bool { return true })
+	for i := 0; i < 100; i++ {
+		s.Add(strconv.Itoa(i))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deadlines := make(map[time.Time]struct{})
+	for _, it := range s.queue {
+		deadlines[it.deadline] = struct{}{}
+	}
+	require.Greater(t, len(deadlines), 90)
+}
+
+func TestSchedulerHotOnly(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := newCounter()
+	s := NewScheduler(ctx, &Config{Time: 100 * time.Millisecond, HotOnly: true}, c.refresh)
+	s.Add("cold")
+	s.Hit("hot")
+
+	for i := 0; i < 6; i++ {
+		time.Sleep(50 * time.Millisecond)
+		s.Hit("hot")
+	}
+
+	require.Zero(t, c.get("cold"))
+	require.GreaterOrEqual(t, c.get("hot"), 2)
+	require.Equal(t, 1, s.Len())
+}
+
+func TestSchedulerWorkers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var running, maxRunning int32
+	s := NewScheduler(ctx, &Config{Time: 10 * time.Millisecond, Workers: 2}, func(string) bool {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+
+		return true
+	})
+	for i := 0; i < 10; i++ {
+		s.Add(strconv.Itoa(i))
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, int32(2), atomic.LoadInt32(&maxRunning))
+}
+
+func TestSchedulerMaxRate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var count int32
+	s := NewScheduler(ctx, &Config{Time: 10 * time.Millisecond, MaxRate: 20}, func(string) bool {
+		atomic.AddInt32(&count, 1)
+		return true
+	})
+	for i := 0; i < 10; i++ {
+		s.Add(strconv.Itoa(i))
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	require.LessOrEqual(t, atomic.LoadInt32(&count), int32(11))
+	require.GreaterOrEqual(t, atomic.LoadInt32(&count), int32(5))
+}
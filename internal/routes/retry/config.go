@@ -0,0 +1,96 @@
+package retry
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	defaultBudget     = 0.2
+	defaultMinRetries = 3
+)
+
+func defaultStatuses() []int {
+	return []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+}
+
+type Config struct {
+	// Attempts is a max count of attempts of request including the first one, retries are disabled
+	// if it is less than 2
+	Attempts int
+	// Statuses are status codes of backend responses which are retried, by default 502, 503 and 504
+	Statuses []int
+	// NotConnectionErrors disables retries of requests which failed without response
+	NotConnectionErrors bool
+	// Delay is a delay before retry
+	Delay time.Duration
+	// Budget is a max ratio of retries to requests per second, so retries don't multiply load
+	// of failing backend
+	Budget float64
+	// MinRetries is a count of retries per second which are allowed regardless of budget
+	MinRetries int
+}
+
+func (c *Config) SetDefault() {
+	if len(c.Statuses) == 0 {
+		c.Statuses = defaultStatuses()
+	}
+
+	if c.Budget == 0 {
+		c.Budget = defaultBudget
+	}
+
+	if c.MinRetries == 0 {
+		c.MinRetries = defaultMinRetries
+	}
+}
+
+// Enabled checks that retries are configured
+func (c *Config) Enabled() bool {
+	return c != nil && c.Attempts > 1
+}
+
+func (c *Config) Merge(target *Config) *Config {
+	if c == nil {
+		return target
+	}
+
+	result := &Config{
+		Attempts:            c.Attempts,
+		Statuses:            c.Statuses,
+		NotConnectionErrors: c.NotConnectionErrors,
+		Delay:               c.Delay,
+		Budget:              c.Budget,
+		MinRetries:          c.MinRetries,
+	}
+
+	if target == nil {
+		return result
+	}
+
+	if target.Attempts > 0 {
+		result.Attempts = target.Attempts
+	}
+
+	if len(target.Statuses) > 0 {
+		result.Statuses = target.Statuses
+	}
+
+	if target.NotConnectionErrors {
+		result.NotConnectionErrors = true
+	}
+
+	if target.Delay > 0 {
+		result.Delay = target.Delay
+	}
+
+	if target.Budget > 0 {
+		result.Budget = target.Budget
+	}
+
+	if target.MinRetries > 0 {
+		result.MinRetries = target.MinRetries
+	}
+
+	return result
+}
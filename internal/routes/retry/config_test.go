@@ -0,0 +1,73 @@
+package retry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDefault(t *testing.T) {
+	c := &Config{}
+	c.SetDefault()
+	require.Equal(t, defaultStatuses(), c.Statuses)
+	require.Equal(t, defaultBudget, c.Budget)
+	require.Equal(t, defaultMinRetries, c.MinRetries)
+	require.False(t, c.Enabled())
+	require.True(t, (&Config{Attempts: 2}).Enabled())
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name           string
+		srcConfig      *Config
+		targetConfig   *Config
+		expectedConfig *Config
+	}{
+		{
+			name:           "src is nil",
+			srcConfig:      nil,
+			targetConfig:   &Config{Attempts: 2},
+			expectedConfig: &Config{Attempts: 2},
+		},
+		{
+			name:           "target is nil",
+			srcConfig:      &Config{Attempts: 2, Delay: time.Second},
+			targetConfig:   nil,
+			expectedConfig: &Config{Attempts: 2, Delay: time.Second},
+		},
+		{
+			name:      "target is not nil",
+			srcConfig: &Config{Attempts: 2, Statuses: []int{http.StatusBadGateway}, Budget: 0.1, MinRetries: 1},
+			targetConfig: &Config{
+				Attempts:            3,
+				Statuses:            []int{http.StatusServiceUnavailable},
+				NotConnectionErrors: true,
+				Delay:               time.Second,
+			},
+			expectedConfig: &Config{
+				Attempts:            3,
+				Statuses:            []int{http.StatusServiceUnavailable},
+				NotConnectionErrors: true,
+				Delay:               time.Second,
+				Budget:              0.1,
+				MinRetries:          1,
+			},
+		},
+		{
+			name:           "target doesn't reset flag",
+			srcConfig:      &Config{Attempts: 2, NotConnectionErrors: true},
+			targetConfig:   &Config{Attempts: 3},
+			expectedConfig: &Config{Attempts: 3, NotConnectionErrors: true},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cc := tt.srcConfig.Merge(tt.targetConfig)
+			require.Equal(t, tt.expectedConfig, cc)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package retry
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// budgetWindow is a window of retry budget
+const budgetWindow = time.Second
+
+// Policy decides which requests to backend are retried. The nil policy doesn't retry requests.
+type Policy struct {
+	cfg *Config
+	mu  sync.Mutex
+	// windowStart is a start of current window of budget
+	windowStart time.Time
+	requests    int
+	retries     int
+}
+
+// NewPolicy creates policy by config, it returns nil if retries are disabled
+func NewPolicy(cfg *Config) *Policy {
+	if !cfg.Enabled() {
+		return nil
+	}
+	cfg.SetDefault()
+
+	return &Policy{cfg: cfg}
+}
+
+// Idempotent checks that request with method may be sent again
+func Idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// Replayable checks that body of request may be sent again
+func Replayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// window resets counters of expired window, mu must be locked
+func (p *Policy) window(now time.Time) {
+	if now.Sub(p.windowStart) >= budgetWindow {
+		p.windowStart = now
+		p.requests = 0
+		p.retries = 0
+	}
+}
+
+// Start counts request in budget, it must be called once per request before attempts
+func (p *Policy) Start() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.window(time.Now())
+	p.requests++
+}
+
+// retryable checks that result of attempt may be retried
+func (p *Policy) retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !p.cfg.NotConnectionErrors
+	}
+
+	for _, v := range p.cfg.Statuses {
+		if resp.StatusCode == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Retry checks that request must be sent again after attempt, the allowed retry is withdrawn from budget.
+// The request canceled by client or timed out is not retried.
+func (p *Policy) Retry(req *http.Request, attempt int, resp *http.Response, err error) bool {
+	if p == nil ||
+		attempt >= p.cfg.Attempts ||
+		req.Context().Err() != nil ||
+		!Idempotent(req.Method) ||
+		!Replayable(req) ||
+		!p.retryable(resp, err) {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.window(time.Now())
+	if float64(p.retries) >= float64(p.cfg.MinRetries)+p.cfg.Budget*float64(p.requests) {
+		return false
+	}
+	p.retries++
+
+	return true
+}
+
+// Delay returns delay before retry
+func (p *Policy) Delay() time.Duration {
+	if p == nil {
+		return 0
+	}
+
+	return p.cfg.Delay
+}
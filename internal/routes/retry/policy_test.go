@@ -0,0 +1,86 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPolicy(t *testing.T) {
+	require.Nil(t, NewPolicy(nil))
+	require.Nil(t, NewPolicy(&Config{Attempts: 1}))
+	require.NotNil(t, NewPolicy(&Config{Attempts: 2}))
+}
+
+func TestReplayable(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPut, "/", strings.NewReader("body"))
+	require.Nil(t, err)
+	require.True(t, Replayable(req))
+
+	req.GetBody = nil
+	require.False(t, Replayable(req))
+
+	req.Body = http.NoBody
+	require.True(t, Replayable(req))
+}
+
+func TestRetry(t *testing.T) {
+	var nilPolicy *Policy
+	nilPolicy.Start()
+	require.False(t, nilPolicy.Retry(nil, 1, nil, errors.New("failed")))
+	require.Zero(t, nilPolicy.Delay())
+
+	p := NewPolicy(&Config{Attempts: 3, MinRetries: 100})
+	get, err := http.NewRequest(http.MethodGet, "/", nil)
+	require.Nil(t, err)
+	post, err := http.NewRequest(http.MethodPost, "/", nil)
+	require.Nil(t, err)
+	streamed, err := http.NewRequest(http.MethodPut, "/", ioutil.NopCloser(strings.NewReader("body")))
+	require.Nil(t, err)
+
+	connErr := errors.New("connection refused")
+	unavailable := &http.Response{StatusCode: http.StatusServiceUnavailable}
+	failed := &http.Response{StatusCode: http.StatusInternalServerError}
+
+	p.Start()
+	require.True(t, p.Retry(get, 1, nil, connErr))
+	require.True(t, p.Retry(get, 2, unavailable, nil))
+	// The attempts are exhausted
+	require.False(t, p.Retry(get, 3, unavailable, nil))
+	// The status is not retried
+	require.False(t, p.Retry(get, 1, failed, nil))
+	// The method is not idempotent
+	require.False(t, p.Retry(post, 1, unavailable, nil))
+	// The body can't be sent again
+	require.False(t, p.Retry(streamed, 1, unavailable, nil))
+
+	// The request is canceled by client
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.False(t, p.Retry(get.WithContext(ctx), 1, nil, context.Canceled))
+
+	p.cfg.NotConnectionErrors = true
+	require.False(t, p.Retry(get, 1, nil, connErr))
+}
+
+func TestBudget(t *testing.T) {
+	p := NewPolicy(&Config{Attempts: 2, Budget: 0.5, MinRetries: 1})
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	require.Nil(t, err)
+	resp := &http.Response{StatusCode: http.StatusBadGateway}
+
+	// The budget allows min retries and half of requests
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		p.Start()
+		if p.Retry(req, 1, resp, nil) {
+			allowed++
+		}
+	}
+	require.Equal(t, 6, allowed)
+}
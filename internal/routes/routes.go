@@ -1,9 +1,13 @@
 package routes
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -11,7 +15,6 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/soldatov-s/accp/internal/cache"
-	"github.com/soldatov-s/accp/internal/cache/cachedata"
 	cacheerrors "github.com/soldatov-s/accp/internal/cache/errors"
 	"github.com/soldatov-s/accp/internal/captcha"
 	"github.com/soldatov-s/accp/internal/httpclient"
@@ -23,6 +26,10 @@ import (
 	"github.com/soldatov-s/accp/internal/rabbitmq"
 	"github.com/soldatov-s/accp/internal/redis"
 	rrdata "github.com/soldatov-s/accp/internal/request_response_data"
+	"github.com/soldatov-s/accp/internal/routes/breaker"
+	"github.com/soldatov-s/accp/internal/routes/refresh"
+	"github.com/soldatov-s/accp/internal/routes/retry"
+	"github.com/soldatov-s/accp/internal/upstream"
 )
 
 const (
@@ -31,6 +38,7 @@ const (
 	hydrationIntrospectHeader    = "Accp-Introspect-Body"
 	disabledCachedHeader         = "Accp-Cache-Disable"
 	disabledCapchaHeader         = "Accp-Captcha-Disable"
+	excludedByParameters         = "cache, introspection, captcha and limits are disabled in route parameters"
 )
 
 type empty struct{}
@@ -42,14 +50,26 @@ type Route struct {
 	parameters     *Parameters
 	cache          *cache.Cache
 	pool           *httpclient.Pool
+	balancer       *upstream.Balancer
 	waitAnswerList map[string]chan struct{}
 	waiteAnswerMu  map[string]*sync.Mutex
 	publisher      publisher.Publisher
-	refreshTimer   *time.Timer
+	refresher      *refresh.Scheduler
 	limits         map[string]*limits.LimitTable
 	route          string
 	introspector   introspection.Introspector
 	captcher       *captcha.GoogleCaptcha
+	excludedReason string
+	// compression is a compression of cached bodies, it is nil if bodies are not compressed
+	compression *cache.CompressionConfig
+	// breaker stops requests to failing backend, it is nil if breaker is disabled
+	breaker *breaker.Breaker
+	// refreshBackoff suspends refreshes after failures, it is nil if backoff is disabled
+	refreshBackoff *refresh.Backoff
+	// revalidating are running revalidations of expired responses
+	revalidating *refresh.Inflight
+	// retry is a policy of retries of requests to backend, it is nil if retries are disabled
+	retry *retry.Policy
 }
 
 func NewRoute(ctx context.Context, routeName string, params *Parameters) *Route {
@@ -70,7 +90,22 @@ func NewRoute(ctx context.Context, routeName string, params *Parameters) *Route
 		Routes:         make(MapRoutes),
 		waitAnswerList: make(map[string]chan struct{}),
 		waiteAnswerMu:  make(map[string]*sync.Mutex),
+		revalidating:   refresh.NewInflight(),
 		pool:           httpclient.NewPool(params.Pool),
+		balancer:       upstream.NewBalancer(ctx, params.Balancer, params.DSNList()),
+	}
+
+	if err := registerMetrics(r.ctx); err != nil {
+		r.log.Err(err).Msg("failed to register metrics of routes")
+	}
+
+	r.retry = retry.NewPolicy(params.Retry)
+
+	if params.Breaker.Enabled() {
+		r.breaker = breaker.NewBreaker(params.Breaker, func(state breaker.State) {
+			r.log.Warn().Msgf("breaker of route %s is %s", r.route, state)
+			breakerStateMetric.WithLabelValues(r.route).Set(float64(state))
+		})
 	}
 
 	if !params.NotCaptcha {
@@ -86,14 +121,26 @@ func NewRoute(ctx context.Context, routeName string, params *Parameters) *Route
 	}
 
 	if !params.Cache.Disabled {
+		cacheCfg := params.Cache
+		// Every route keeps own files, so the same keys of different routes don't collide on disk
+		if cacheCfg.Disk.Enabled() {
+			routeCfg := *cacheCfg
+			routeCfg.Disk = cacheCfg.Disk.Subdir(r.route)
+			cacheCfg = &routeCfg
+		}
+
 		if externalCache := redis.Get(r.ctx); externalCache != nil {
-			r.cache = cache.NewCache(r.ctx, params.Cache, externalCache)
+			r.cache = cache.NewCache(r.ctx, cacheCfg, externalCache)
 		} else {
-			r.cache = cache.NewCache(r.ctx, params.Cache, nil)
+			r.cache = cache.NewCache(r.ctx, cacheCfg, nil)
 		}
 
+		// The encoding is checked on validation of config
+		r.compression = params.Cache.Compression
+
+		r.refreshBackoff = refresh.NewBackoff(params.Refresh)
 		if params.Refresh.Time > 0 {
-			r.refreshTimer = time.AfterFunc(params.Refresh.Time, r.refreshByTime)
+			r.refresher = refresh.NewScheduler(r.ctx, params.Refresh, r.refreshByTime)
 		}
 
 		if r.parameters.RouteKey != "" {
@@ -114,13 +161,33 @@ func NewRoute(ctx context.Context, routeName string, params *Parameters) *Route
 	return r
 }
 
-// route is fully exluded if disabled cache, introspection and limits
+// route is fully exluded if disabled cache, introspection, captcha and limits
 func (r *Route) isExcluded() bool {
 	return r.parameters.NotIntrospect &&
+		r.parameters.NotCaptcha &&
 		r.parameters.Cache.Disabled &&
 		len(r.parameters.Limits) == 0
 }
 
+// Parameters returns parameters of route
+func (r *Route) Parameters() *Parameters {
+	return r.parameters
+}
+
+// ExcludedReason returns the reason why route is excluded, it returns empty string
+// for not excluded route
+func (r *Route) ExcludedReason() string {
+	if !r.isExcluded() {
+		return ""
+	}
+
+	if r.excludedReason != "" {
+		return r.excludedReason
+	}
+
+	return excludedByParameters
+}
+
 func (r *Route) checkLimits(req *http.Request) (*bool, error) {
 	result := false
 	if len(r.parameters.Limits) == 0 {
@@ -157,50 +224,367 @@ func (r *Route) refreshHandler(hk string, data *rrdata.RequestResponseData) erro
 		return nil
 	}
 
+	// The previous response is kept while refreshes are suspended after failures or breaker is open
+	if !r.refreshBackoff.Allow() {
+		return r.suspendRefresh(data, ErrRefreshSuspended)
+	}
+
+	if !r.allowBackend() {
+		return r.suspendRefresh(data, ErrBackendUnavailable)
+	}
+
 	req, err := data.Request.BuildRequest()
 	if err != nil {
+		r.breaker.Cancel()
+		return errors.Wrap(err, "failed to build request")
+	}
+
+	up, err := r.balancer.Next(req, hk)
+	if err != nil {
+		r.refreshDone(err, true)
+		return errors.Wrap(err, "failed to select upstream")
+	}
+
+	// Stored request may be sent to another upstream or may be without DSN if it was got from redis
+	if req.URL, err = url.Parse(r.balancer.Rebase(req.URL.String(), up)); err != nil {
+		r.balancer.Done(up, false)
+		r.breaker.Cancel()
 		return errors.Wrap(err, "failed to build request")
 	}
 
 	client := r.pool.GetFromPool()
 	defer r.pool.PutToPool(client)
 
-	if err := data.UpdateByRequest(client, req); err != nil {
-		if err = r.cache.Delete(hk); err != nil {
-			return errors.Wrap(err, "failed to update request/response data, delete key failed")
+	// Previous response is kept if refresh failed and it is not too old
+	// The response which became larger than max size is not read and it is removed from cache
+	maxSize := r.maxCacheBodySize()
+	if r.canServeStaleIfError(data) {
+		err = data.TryUpdateByRequest(client, req, maxSize)
+		tooLarge := errors.Is(err, rrdata.ErrBodyTooLarge)
+		r.balancer.Done(up, err != nil && !tooLarge)
+		r.refreshDone(err, err != nil && !tooLarge)
+		if tooLarge {
+			r.oversized(hk)
+			return r.cache.Delete(hk)
+		} else if err != nil {
+			data.Response.MarkStale()
+			return errors.Wrap(err, "failed to update request/response data, stale response is kept")
+		}
+	} else {
+		err = data.UpdateByRequest(client, req, maxSize)
+		tooLarge := errors.Is(err, rrdata.ErrBodyTooLarge)
+		failed := (err != nil && !tooLarge) || data.GetStatusCode() >= http.StatusInternalServerError
+		r.balancer.Done(up, failed)
+		r.refreshDone(err, failed)
+		if tooLarge {
+			r.oversized(hk)
+			return r.cache.Delete(hk)
+		} else if err != nil {
+			if err = r.cache.Delete(hk); err != nil {
+				return errors.Wrap(err, "failed to update request/response data, delete key failed")
+			}
+			return errors.Wrap(err, "failed to update request/response data")
 		}
-		return errors.Wrap(err, "failed to update request/response data")
 	}
 
 	r.log.Debug().Msgf("%s: cache refreshed", hk)
 
-	if r.cache.External == nil {
-		return nil
+	if _, ok := r.applyCachePolicy(data); !ok {
+		r.log.Debug().Msgf("%s: backend forbade to cache response", hk)
+		return r.cache.Delete(hk)
 	}
+	r.compress(hk, data)
 
-	if err := r.cache.External.Update(hk, data); err != nil {
+	// Tags of response may be changed by refresh
+	if err := r.cache.Update(hk, data); err != nil {
 		return errors.Wrap(err, "failed to update external cache")
 	}
 
-	r.log.Debug().Msgf("%s: external cache refreshed", hk)
+	if r.cache.External != nil {
+		r.log.Debug().Msgf("%s: external cache refreshed", hk)
+	}
+
 	return nil
 }
 
-func (r *Route) refreshByTime() {
-	r.cache.Memory.Range(func(k, v interface{}) bool {
-		data := v.(*cachedata.CacheItem).Data.(*rrdata.RequestResponseData)
-		hk := k.(string)
-		go func() {
-			r.log.Debug().Msgf("try to refersh %s by time", hk)
-			if err := r.refreshHandler(hk, data); err != nil {
-				r.log.Error().Err(err).Msgf("%s: refresh cache failed", hk)
-			}
-		}()
+// PurgeTag deletes cached responses tagged by tag, it returns count of deleted responses which were not in purged,
+// purged is shared by routes with the same external cache
+func (r *Route) PurgeTag(tag string, purged *cache.Purged) (int, error) {
+	if r.cache == nil {
+		return 0, nil
+	}
+
+	count, err := r.cache.PurgeTag(tag, purged)
+	if err != nil {
+		return 0, err
+	}
+
+	r.log.Debug().Msgf("%s: purged %d responses by tag %s", r.route, count, tag)
+
+	return count, nil
+}
+
+// PurgeURL deletes cached responses to request URI, it returns count of deleted responses which were not in purged
+func (r *Route) PurgeURL(uri string, purged *cache.Purged) (int, error) {
+	if r.cache == nil {
+		return 0, nil
+	}
+
+	count, err := r.cache.PurgeURL(uri, purged)
+	if err != nil {
+		return 0, err
+	}
+
+	r.log.Debug().Msgf("%s: purged %d responses by url %s", r.route, count, uri)
+
+	return count, nil
+}
+
+// Purge deletes cached responses to request URIs matched by match, it returns count of deleted responses
+// which were not in purged
+func (r *Route) Purge(match func(uri string) bool, purged *cache.Purged) (int, error) {
+	if r.cache == nil {
+		return 0, nil
+	}
+
+	count, err := r.cache.Purge(match, purged)
+	if err != nil {
+		return 0, err
+	}
+
+	r.log.Debug().Msgf("%s: purged %d responses by url matcher", r.route, count)
+
+	return count, nil
+}
+
+// cacheKey returns key of request in cache, it is hash of request and headers from Vary of response
+func (r *Route) cacheKey(hk string, req *http.Request) string {
+	if !r.parameters.Cache.RespectCacheControl {
+		return hk
+	}
+
+	return r.cache.Key(hk, req)
+}
+
+// applyCachePolicy applies Cache-Control and Expires of response if it is enabled for route,
+// it returns headers from Vary of response and false if response must not be cached. The lifetime
+// of response is capped by TTL of memory cache.
+func (r *Route) applyCachePolicy(data *rrdata.RequestResponseData) ([]string, bool) {
+	if !r.parameters.Cache.RespectCacheControl {
+		return nil, true
+	}
+
+	p := httputils.ParseCachePolicy(data.Response.Header, time.Now())
+	if p.NoStore || (p.TTL != nil && *p.TTL <= 0) {
+		return nil, false
+	}
+
+	if p.TTL != nil {
+		ttl := *p.TTL
+		if ttl > r.parameters.Cache.Memory.TTL {
+			ttl = r.parameters.Cache.Memory.TTL
+		}
+		data.Response.SetTTL(ttl)
+	}
+
+	return p.Vary, true
+}
+
+// maxCacheBodySize returns max size of cached response body, it is the least of MaxCacheBodySize
+// of cache and MaxResponseBody of route, zero means no limit
+func (r *Route) maxCacheBodySize() int64 {
+	result := r.parameters.Cache.MaxCacheBodySize
+	if limit := r.parameters.MaxResponseBody; limit > 0 && (result == 0 || limit < result) {
+		result = limit
+	}
+
+	return result
+}
+
+// oversized counts response which is passed through uncached because it is too large
+func (r *Route) oversized(hk string) {
+	r.log.Debug().Msgf("%s: response is larger than %d bytes, it is not cached", hk, r.maxCacheBodySize())
+	oversizedMetric.WithLabelValues(r.route).Inc()
+}
+
+// allowBackend checks that breaker allows request to backend, the allowed request must be finished
+// by breaker
+func (r *Route) allowBackend() bool {
+	if r.breaker.Allow() {
+		return true
+	}
+
+	breakerRejectedMetric.WithLabelValues(r.route).Inc()
+
+	return false
+}
+
+// suspendRefresh keeps previous response if refresh was not started, the response is marked stale
+// as after failed refresh
+func (r *Route) suspendRefresh(data *rrdata.RequestResponseData, err error) error {
+	if r.canServeStaleIfError(data) {
+		data.Response.MarkStale()
+	}
+
+	return err
+}
+
+// logRefreshError logs error of refresh, the suspended refresh is logged as debug
+func (r *Route) logRefreshError(hk, msg string, err error) {
+	if errors.Is(err, ErrRefreshSuspended) || errors.Is(err, ErrBackendUnavailable) {
+		r.log.Debug().Err(err).Msgf("%s: %s", hk, msg)
+		return
+	}
+
+	r.log.Error().Err(err).Msgf("%s: %s", hk, msg)
+}
+
+// refreshDone finishes refresh in backoff and breaker, the canceled refresh is not a failure of backend
+func (r *Route) refreshDone(err error, failed bool) {
+	if errors.Is(err, context.Canceled) {
+		r.breaker.Cancel()
+		return
+	}
+
+	r.refreshBackoff.Done(failed)
+	r.breaker.Done(failed)
+}
+
+// backendDone finishes request in breaker, the request canceled by client is not a failure of backend
+func (r *Route) backendDone(err error, failed bool) {
+	if errors.Is(err, context.Canceled) {
+		r.breaker.Cancel()
+		return
+	}
+
+	r.breaker.Done(failed)
+}
+
+// BreakerStatus returns status of breaker, it returns nil if breaker is disabled
+func (r *Route) BreakerStatus() *breaker.Status {
+	return r.breaker.Status()
+}
+
+// limitRequestBody answers 413 if request body is larger than MaxRequestBody, it returns false
+// if request must not be handled. The body of unknown length is read up to limit.
+func (r *Route) limitRequestBody(w http.ResponseWriter, req *http.Request) bool {
+	limit := r.parameters.MaxRequestBody
+	if limit <= 0 || req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+
+	tooLarge := func() bool {
+		r.log.Debug().Str("requestID", httputils.GetRequestID(req)).Msgf("request body is larger than %d bytes", limit)
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return false
+	}
+
+	if req.ContentLength > limit {
+		return tooLarge()
+	}
+
+	// The server doesn't read body beyond known length
+	if req.ContentLength >= 0 {
+		return true
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to read request body")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	if int64(len(body)) > limit {
+		return tooLarge()
+	}
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	return true
+}
+
+// compress compresses body of response if compression is enabled for route
+func (r *Route) compress(hk string, data *rrdata.RequestResponseData) {
+	if r.compression == nil {
+		return
+	}
+
+	if err := data.Response.Compress(r.compression.Encoding, r.compression.MinSize); err != nil {
+		r.log.Err(err).Msgf("%s: failed to compress body", hk)
+	}
+}
+
+// staleAge returns time since response became stale, it is negative for fresh response
+func (r *Route) staleAge(data *rrdata.RequestResponseData) time.Duration {
+	return data.Response.Age() - r.parameters.Cache.MaxAge
+}
 
+// isStale checks that response is older than MaxAge or the last refresh of response failed
+func (r *Route) isStale(data *rrdata.RequestResponseData) bool {
+	if data.Response.Stale() {
 		return true
-	})
+	}
+
+	return r.parameters.Cache.MaxAge > 0 && r.staleAge(data) > 0
+}
+
+// canServeStaleIfError checks that response may be served if refresh failed
+func (r *Route) canServeStaleIfError(data *rrdata.RequestResponseData) bool {
+	return r.parameters.Cache.StaleIfError > 0 &&
+		data.GetStatusCode() < http.StatusInternalServerError &&
+		r.staleAge(data) <= r.parameters.Cache.StaleIfError
+}
+
+// canServeStaleWhileRevalidate checks that stale response may be served while background refresh runs
+func (r *Route) canServeStaleWhileRevalidate(data *rrdata.RequestResponseData) bool {
+	return r.parameters.Cache.StaleWhileRevalidate > 0 &&
+		r.staleAge(data) <= r.parameters.Cache.StaleWhileRevalidate
+}
+
+// revalidate refreshes response if other refresh of response is not running
+func (r *Route) revalidate(hk string, data *rrdata.RequestResponseData) {
+	if !r.revalidating.Start(hk) {
+		return
+	}
+	defer r.revalidating.Done(hk)
+
+	r.log.Debug().Msgf("try to revalidate stale %s", hk)
+	if err := r.refreshHandler(hk, data); err != nil {
+		r.logRefreshError(hk, "revalidate cache failed", err)
+	}
+}
+
+// revalidateSync refreshes response before answer, concurrent requests wait for running refresh
+func (r *Route) revalidateSync(hk string, data *rrdata.RequestResponseData) {
+	if !r.revalidating.Start(hk) {
+		r.revalidating.Wait(hk)
+		return
+	}
+	defer r.revalidating.Done(hk)
+
+	r.log.Debug().Msgf("try to refresh expired %s", hk)
+	if err := r.refreshHandler(hk, data); err != nil {
+		r.logRefreshError(hk, "refresh cache failed", err)
+	}
+}
+
+// refreshByTime refreshes cached response by the scheduler, it returns false if response is not cached
+func (r *Route) refreshByTime(hk string) bool {
+	// The scheduler must not prolong lifetime of response, so the cold responses expire,
+	// the response which is only on disk is refreshed as well
+	data, err := r.cache.Peek(hk)
+	if err != nil {
+		return false
+	}
 
-	r.refreshTimer.Reset(r.parameters.Refresh.Time)
+	r.log.Debug().Msgf("try to refresh %s by time", hk)
+	if err := r.refreshHandler(hk, data); err != nil {
+		r.logRefreshError(hk, "refresh cache failed", err)
+	}
+
+	return r.cache.Has(hk)
 }
 
 // Publish publishes request from client to message queue
@@ -211,41 +595,167 @@ func (r *Route) Publish(message interface{}) error {
 	return r.publisher.SendMessage(message, r.parameters.RouteKey)
 }
 
+// requestToBack proxies request to backend and writes response to client, it returns nil if response
+// can't be cached because it is larger than MaxCacheBodySize or it was not fully streamed
 func (r *Route) requestToBack(hk string, w http.ResponseWriter, req *http.Request) *rrdata.RequestResponseData {
 	var err error
 	// Proxy request to backend
 	client := r.pool.GetFromPool()
 	defer r.pool.PutToPool(client)
 
+	// The miss is answered without request to backend while breaker is open, the stale copy
+	// of response is served if it exists
+	if !r.allowBackend() {
+		r.log.Debug().Str("requestID", httputils.GetRequestID(req)).Msgf("%s: request is rejected by open breaker", hk)
+		if !r.serveStale(hk, w, req) {
+			r.breaker.WriteResponse(w, ErrBackendUnavailable.Error())
+		}
+		return nil
+	}
+
 	rrData := rrdata.NewRequestResponseData(hk, r.parameters.Refresh.MaxCount, r.cache.External)
 
-	var resp *http.Response
-	proxyReq, err := httputils.CopyRequestWithDSN(req, r.parameters.DSN)
-	if err != nil {
+	var (
+		resp     *http.Response
+		proxyReq *http.Request
+		up       *upstream.Upstream
+	)
+	if up, err = r.balancer.Next(req, hk); err != nil {
+		r.breaker.Done(true)
+		resp = httputils.ErrResponse(err.Error(), http.StatusServiceUnavailable)
+		rrData.Request = nil
+	} else if proxyReq, err = httputils.CopyRequestWithDSN(req, up.DSN); err != nil {
+		r.balancer.Done(up, false)
+		r.breaker.Cancel()
 		resp = httputils.ErrResponse(err.Error(), http.StatusServiceUnavailable)
 		rrData.Request = nil
 	} else {
+		// The cached response is shared, so backend must answer full response, the validators
+		// of client are checked on writing of response
+		httputils.RemoveConditionalHeaders(proxyReq.Header)
 		// nolint : bodyclose
 		if err = rrData.Request.Read(proxyReq); err != nil {
+			r.balancer.Done(up, false)
+			r.breaker.Cancel()
 			resp = httputils.ErrResponse(err.Error(), http.StatusServiceUnavailable)
 			rrData.Request = nil
-		} else if resp, err = client.Do(proxyReq); err != nil {
+		} else if resp, err = r.do(client, proxyReq, up, hk); err != nil {
+			r.backendDone(err, true)
+			// The client is gone, the response is not cached
+			if errors.Is(err, context.Canceled) {
+				r.log.Debug().Str("requestID", httputils.GetRequestID(req)).Msgf("%s: request is canceled by client", hk)
+				return nil
+			}
 			resp = httputils.ErrResponse(err.Error(), http.StatusServiceUnavailable)
+		} else {
+			r.breaker.Done(resp.StatusCode >= http.StatusInternalServerError)
 		}
 	}
 	defer resp.Body.Close()
 
+	if maxSize := r.maxCacheBodySize(); maxSize > 0 {
+		if err = rrData.Response.Stream(w, req, resp, rrdata.ResponseBack, maxSize); errors.Is(err, rrdata.ErrBodyTooLarge) {
+			r.oversized(hk)
+			return nil
+		} else if err != nil {
+			r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to stream response to client")
+			return nil
+		}
+
+		return rrData
+	}
+
 	if err := rrData.Response.Read(resp); err != nil {
 		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to read request/response data")
 	}
 
-	if err := rrData.Response.Write(w, rrdata.ResponseBack); err != nil {
+	if err := rrData.Response.WriteConditional(w, req, rrdata.ResponseBack); err != nil {
 		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to write data to client from response")
 	}
 
 	return rrData
 }
 
+// serveStale writes stale copy of response from cache if it may be served after failure, it returns
+// false if there is no such copy
+func (r *Route) serveStale(hk string, w http.ResponseWriter, req *http.Request) bool {
+	data, err := r.cache.Peek(hk)
+	if err != nil || !r.canServeStaleIfError(data) {
+		return false
+	}
+
+	data.Response.MarkStale()
+	if err := data.Response.WriteConditional(w, req, rrdata.ResponseStale); err != nil {
+		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to write stale data from cache")
+	}
+
+	return true
+}
+
+// do sends request to upstream, the failed request is sent again by retry policy to upstream
+// selected by balancer. It returns result of the last attempt.
+func (r *Route) do(client *http.Client, req *http.Request, up *upstream.Upstream, key string) (*http.Response, error) {
+	r.retry.Start()
+	for attempt := 1; ; attempt++ {
+		// nolint : bodyclose
+		resp, err := client.Do(req)
+		// The request canceled by client is not a failure of upstream
+		failed := err != nil && !errors.Is(err, context.Canceled) || err == nil && resp.StatusCode >= http.StatusInternalServerError
+		r.balancer.Done(up, failed)
+		if !r.retry.Retry(req, attempt, resp, err) {
+			return resp, err
+		}
+
+		if delay := r.retry.Delay(); delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-req.Context().Done():
+				if resp != nil {
+					resp.Body.Close()
+				}
+				return nil, req.Context().Err()
+			}
+		}
+
+		nextUp, nextReq, errRetry := r.retryRequest(req, key)
+		if errRetry != nil {
+			r.log.Err(errRetry).Msgf("failed to retry request %s", req.URL.RequestURI())
+			return resp, err
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		r.log.Debug().Msgf("retry request %s, attempt %d", req.URL.RequestURI(), attempt+1)
+		up, req = nextUp, nextReq
+	}
+}
+
+// retryRequest returns copy of request to the next upstream
+func (r *Route) retryRequest(req *http.Request, key string) (*upstream.Upstream, *http.Request, error) {
+	up, err := r.balancer.Next(req, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := req.Clone(req.Context())
+	if result.URL, err = url.Parse(r.balancer.Rebase(req.URL.String(), up)); err != nil {
+		r.balancer.Done(up, false)
+		return nil, nil, err
+	}
+	result.Host = result.URL.Host
+
+	if req.GetBody != nil {
+		if result.Body, err = req.GetBody(); err != nil {
+			r.balancer.Done(up, false)
+			return nil, nil, err
+		}
+	}
+
+	return up, result, nil
+}
+
 // notCached is handler for proxy requests to excluded routes and routes which not need to cache
 func (r *Route) notCached(w http.ResponseWriter, req *http.Request) {
 	client := r.pool.GetFromPool()
@@ -253,16 +763,36 @@ func (r *Route) notCached(w http.ResponseWriter, req *http.Request) {
 
 	r.log.Debug().Msg(req.URL.String())
 
-	var err error
-	proxyReq, err := httputils.CopyRequestWithDSN(req, r.parameters.DSN)
+	if !r.allowBackend() {
+		r.log.Debug().Str("requestID", httputils.GetRequestID(req)).Msg("request is rejected by open breaker")
+		r.breaker.WriteResponse(w, ErrBackendUnavailable.Error())
+		return
+	}
+
+	key := req.URL.RequestURI()
+	up, err := r.balancer.Next(req, key)
 	if err != nil {
-		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("request duplication failed")
+		r.breaker.Done(true)
+		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to select upstream")
 		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
 
-	resp, err := client.Do(proxyReq)
+	proxyReq, err := httputils.CopyRequestWithDSN(req, up.DSN)
 	if err != nil {
+		r.balancer.Done(up, false)
+		r.breaker.Cancel()
+		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("request duplication failed")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	resp, err := r.do(client, proxyReq, up, key)
+	r.backendDone(err, err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	if errors.Is(err, context.Canceled) {
+		r.log.Debug().Str("requestID", httputils.GetRequestID(req)).Msg("request is canceled by client")
+		return
+	} else if err != nil {
 		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("request to back failed")
 		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
@@ -278,17 +808,20 @@ func (r *Route) notCached(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func (r *Route) hydrationIntrospect(req *http.Request) error {
+// hydrationIntrospect introspects request and returns request with result of introspection in context
+func (r *Route) hydrationIntrospect(req *http.Request) (*http.Request, error) {
 	if r.parameters.NotIntrospect || r.introspector == nil {
 		r.log.Debug().Str("requestID", httputils.GetRequestID(req)).Msgf("no introspector or disabled introspection: %s", r.route)
-		return nil
+		return req, nil
 	}
 
 	content, err := r.introspector.IntrospectRequest(req)
 	if err != nil {
-		return err
+		return req, err
 	}
 
+	req = httputils.WithIntrospection(req, content)
+
 	var str string
 	switch r.parameters.IntrospectHydration {
 	case hydrationIntrospectPlainText:
@@ -296,13 +829,13 @@ func (r *Route) hydrationIntrospect(req *http.Request) error {
 	case hydrationIntrospectBase64:
 		str = base64.StdEncoding.EncodeToString(content)
 	default:
-		return nil
+		return req, nil
 	}
 
 	req.Header.Add(hydrationIntrospectHeader, str)
 	r.log.Debug().Str("requestID", httputils.GetRequestID(req)).Msgf("introspect header: %s", str)
 
-	return nil
+	return req, nil
 }
 
 // Checking captcha
@@ -352,12 +885,12 @@ func (r *Route) refresh(data *rrdata.RequestResponseData, hk string) {
 
 	r.log.Debug().Msgf("try to refersh %s by counter", hk)
 	if err := r.refreshHandler(hk, data); err != nil {
-		r.log.Error().Err(err).Msgf("%s: refresh cache failed", hk)
+		r.logRefreshError(hk, "refresh cache failed", err)
 	}
 }
 
 func (r *Route) responseHandle(data *rrdata.RequestResponseData, w http.ResponseWriter, req *http.Request, hk string) {
-	// If data was getted from redis, the request will be empty
+	// If data was getted from redis or disk, the request and refresh counter will be empty
 	if data.Request == nil {
 		var err error
 		if data.Request, err = rrdata.NewRequestData(req); err != nil {
@@ -365,7 +898,37 @@ func (r *Route) responseHandle(data *rrdata.RequestResponseData, w http.Response
 		}
 	}
 
-	if err := data.Response.Write(w, rrdata.ResponseCache); err != nil {
+	if data.Response.Refresh == nil {
+		data.Response.Refresh = rrdata.NewRefreshData(hk, r.parameters.Refresh.MaxCount, r.cache.External)
+	}
+
+	if r.refresher != nil {
+		r.refresher.Hit(hk)
+	}
+
+	// Expired response is refreshed in background or before answer
+	if r.parameters.Cache.MaxAge > 0 && r.staleAge(data) > 0 {
+		if r.canServeStaleWhileRevalidate(data) || (data.Response.Stale() && r.canServeStaleIfError(data)) {
+			go r.revalidate(hk, data)
+		} else {
+			r.revalidateSync(hk, data)
+		}
+	}
+
+	src := rrdata.ResponseCache
+	if r.isStale(data) {
+		src = rrdata.ResponseStale
+	}
+
+	if err := data.Response.WriteConditional(w, req, src); errors.Is(err, rrdata.ErrBodyUnavailable) {
+		// The body on disk was removed or broken, nothing is written yet, so the request is handled as miss
+		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msgf("%s: cached body is unavailable", hk)
+		if err = r.cache.DeleteLocal(hk); err != nil {
+			r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to delete data from cache")
+		}
+		r.requestToBack(hk, w, req)
+		return
+	} else if err != nil {
 		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to write data from cache")
 	}
 
@@ -376,14 +939,20 @@ func (r *Route) responseHandle(data *rrdata.RequestResponseData, w http.Response
 	go r.refresh(data, hk)
 }
 
-func (r *Route) waitAnswer(w http.ResponseWriter, req *http.Request, hk string, ch chan struct{}) {
+func (r *Route) waitAnswer(w http.ResponseWriter, req *http.Request, baseHK string, ch chan struct{}) {
 	<-ch
 
 	var (
 		data *rrdata.RequestResponseData
 		err  error
 	)
-	if data, err = r.cache.Select(hk); err != nil {
+	// Vary of response may be learned by the waited request
+	hk := r.cacheKey(baseHK, req)
+	if data, err = r.cache.Select(hk); errors.Is(err, cacheerrors.ErrNotFound) {
+		// Response was not cached, e.g. backend forbade it
+		r.requestToBack(hk, w, req)
+		return
+	} else if err != nil {
 		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to get data from cache")
 		http.Error(w, "failed to get data from cache", http.StatusServiceUnavailable)
 		return
@@ -392,13 +961,53 @@ func (r *Route) waitAnswer(w http.ResponseWriter, req *http.Request, hk string,
 	r.responseHandle(data, w, req, hk)
 }
 
+// store saves response to cache if cache policy allows it, the key is calculated again
+// because Vary of response may be changed
+func (r *Route) store(baseHK string, req *http.Request, rrData *rrdata.RequestResponseData) {
+	vary, ok := r.applyCachePolicy(rrData)
+	if !ok {
+		return
+	}
+
+	key := httputils.HashWithHeaders(baseHK, req, vary)
+	r.compress(key, rrData)
+	if err := r.cache.Add(key, rrData); err != nil {
+		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to save data to cache")
+		return
+	}
+
+	if r.parameters.Cache.RespectCacheControl {
+		if err := r.cache.SetVary(baseHK, key, vary); err != nil {
+			r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to save vary to cache")
+		}
+	}
+
+	if r.refresher != nil {
+		r.refresher.Add(key)
+	}
+
+	if err := r.cache.AddURL(key, req.URL.RequestURI()); err != nil {
+		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to index data in cache")
+	}
+
+	if err := r.rememberRequest(req, vary); err != nil {
+		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to remember request for warm-up")
+	}
+}
+
 func (r *Route) cachedHandler(w http.ResponseWriter, req *http.Request) {
-	hk, err := httputils.HashRequest(req)
-	if err != nil {
+	baseHK, err := r.parameters.Cache.Key.HashRequest(req)
+	if errors.Is(err, cacheerrors.ErrMissingClaim) {
+		// The response of the request can't be told apart from responses to other users
+		r.log.Debug().Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("cache is bypassed")
+		r.notCached(w, req)
+		return
+	} else if err != nil {
 		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to calculate request hash")
 		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
+	hk := r.cacheKey(baseHK, req)
 
 	// Finding a response to a request in the memory cache
 	if data, err1 := r.cache.Select(hk); err1 == nil {
@@ -426,12 +1035,8 @@ func (r *Route) cachedHandler(w http.ResponseWriter, req *http.Request) {
 			r.waitAnswerList[hk] = ch
 			mu.Unlock() // unlock mutex fast as possible
 
-			// Proxy request to backend
-			rrData := r.requestToBack(hk, w, req)
-			// Save answer to mem cache
-			if err := r.cache.Add(hk, rrData); err != nil {
-				r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("failed to save data to cache")
-			}
+			// Proxy request to backend and save answer to cache
+			r.fetch(baseHK, hk, w, req)
 
 			close(ch)
 			delete(r.waitAnswerList, hk)
@@ -439,15 +1044,15 @@ func (r *Route) cachedHandler(w http.ResponseWriter, req *http.Request) {
 			delete(r.waiteAnswerMu, hk)
 		} else {
 			mu.Unlock()
-			r.waitAnswer(w, req, hk, waitCh1)
+			r.waitAnswer(w, req, baseHK, waitCh1)
 		}
 	} else {
-		r.waitAnswer(w, req, hk, waitCh)
+		r.waitAnswer(w, req, baseHK, waitCh)
 	}
 }
 func (r *Route) proxyHandler(w http.ResponseWriter, req *http.Request) {
 	// Checking an authorization token
-	err := r.hydrationIntrospect(req)
+	req, err := r.hydrationIntrospect(req)
 	var e *introspection.ErrTokenInactive
 	if errors.As(err, &e) || errors.Is(err, introspection.ErrBadAuthRequest) {
 		r.log.Err(err).Str("requestID", httputils.GetRequestID(req)).Msg("intropsection failed")
@@ -485,11 +1090,23 @@ func (r *Route) proxyHandler(w http.ResponseWriter, req *http.Request) {
 func (r *Route) ProxyHandler(w http.ResponseWriter, req *http.Request) {
 	r.log.Debug().Msgf("proxy route: %s", r.route)
 
-	if r.parameters.DSN == "" {
+	if r.balancer.Len() == 0 {
 		r.log.Error().Msgf("route %s not found", req.URL.String())
 		http.Error(w, "route "+req.URL.String()+" not found", http.StatusNotFound)
 		return
 	}
 
+	// The size of request is checked before introspection and hashing which read body
+	if !r.limitRequestBody(w, req) {
+		return
+	}
+
+	// Excluded route passes request to backend without any checks
+	if r.isExcluded() {
+		r.log.Debug().Str("requestID", httputils.GetRequestID(req)).Msgf("route %s is excluded", r.route)
+		r.notCached(w, req)
+		return
+	}
+
 	r.validateCaptcha(w, req)
 }
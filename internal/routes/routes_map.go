@@ -3,70 +3,252 @@ package routes
 import (
 	"context"
 	"net/http"
+	"sort"
 	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/soldatov-s/accp/internal/httputils"
+)
+
+const (
+	// PathWildcard is a segment of route which matches the rest of path,
+	// it must be the last segment of route
+	PathWildcard   = "*"
+	pathParamBegin = "{"
+	pathParamEnd   = "}"
 )
 
+// isPathParam checks that segment of route is a named parameter, e.g. {id}
+func isPathParam(s string) bool {
+	return len(s) > len(pathParamBegin+pathParamEnd) &&
+		strings.HasPrefix(s, pathParamBegin) &&
+		strings.HasSuffix(s, pathParamEnd)
+}
+
+func pathParamName(s string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(s, pathParamBegin), pathParamEnd)
+}
+
+func splitPath(path string) []string {
+	strs := strings.Split(strings.Trim(path, "/"), "/")
+	result := make([]string, 0, len(strs))
+	for _, s := range strs {
+		if s == "" {
+			continue
+		}
+		result = append(result, s)
+	}
+
+	return result
+}
+
 type MapRoutes map[string]*Route
 
+// paramKey returns the key of named parameter on this level of routes
+func (m MapRoutes) paramKey() string {
+	for k := range m {
+		if isPathParam(k) {
+			return k
+		}
+	}
+
+	return ""
+}
+
+// FindRouteByPath finds route by path, see FindRouteByPathWithParams
 func (m MapRoutes) FindRouteByPath(path string) *Route {
-	path = strings.Trim(path, "/")
-	strs := strings.Split(path, "/")
+	route, _ := m.FindRouteByPathWithParams(path)
+	return route
+}
+
+// FindRouteByPathWithParams finds route matched to path and returns it with values of matched
+// named parameters and wildcard. On each level literal segments have priority over named parameters
+// and named parameters over wildcard, the next candidate is tried if the deeper segments are not matched.
+// If path is not fully matched, the deepest route matched to beginning of path is returned.
+func (m MapRoutes) FindRouteByPathWithParams(path string) (*Route, httputils.PathParams) {
+	strs := splitPath(path)
+	if len(strs) == 0 {
+		return nil, nil
+	}
+
+	params := make(httputils.PathParams)
+	if route, ok := m.match(strs, params); ok {
+		if len(params) == 0 {
+			params = nil
+		}
+
+		return route, params
+	}
+
+	return m.deepestRoute(strs)
+}
+
+// match matches all segments to routes by priority, params are filled by matched values
+func (m MapRoutes) match(strs []string, params httputils.PathParams) (*Route, bool) {
+	s, rest := strs[0], strs[1:]
+
+	if next, ok := m[s]; ok && !isPathParam(s) && s != PathWildcard {
+		if route, ok := next.matchRest(rest, params); ok {
+			return route, true
+		}
+	}
+
+	if k := m.paramKey(); k != "" {
+		name := pathParamName(k)
+		params[name] = s
+		if route, ok := m[k].matchRest(rest, params); ok {
+			return route, true
+		}
+		delete(params, name)
+	}
+
+	if next, ok := m[PathWildcard]; ok {
+		params[PathWildcard] = strings.Join(strs, "/")
+		return next, true
+	}
+
+	return nil, false
+}
+
+// matchRest matches rest of segments to subroutes of route
+func (r *Route) matchRest(rest []string, params httputils.PathParams) (*Route, bool) {
+	if len(rest) == 0 {
+		return r, true
+	}
+
+	return r.Routes.match(rest, params)
+}
+
+// deepestRoute finds the deepest route matched to beginning of segments
+func (m MapRoutes) deepestRoute(strs []string) (*Route, httputils.PathParams) {
 	var (
-		route *Route
-		ok    bool
+		route  *Route
+		params httputils.PathParams
 	)
 
 	routes := m
 
 	for _, s := range strs {
-		if s == "" {
-			continue
-		}
-		tmp := route
-		if route, ok = routes[s]; !ok {
-			return tmp
+		if next, ok := routes[s]; ok && !isPathParam(s) && s != PathWildcard {
+			route = next
+		} else if k := routes.paramKey(); k != "" {
+			route = routes[k]
+			if params == nil {
+				params = make(httputils.PathParams)
+			}
+			params[pathParamName(k)] = s
+		} else {
+			return route, params
 		}
 		routes = route.Routes
 	}
 
-	return route
+	return route, params
 }
 
 func (m MapRoutes) FindRouteByHTTPRequest(r *http.Request) *Route {
 	return m.FindRouteByPath(r.URL.Path)
 }
 
+// FindRouteByHTTPRequestWithParams finds route by request and returns request with
+// matched path parameters in context
+func (m MapRoutes) FindRouteByHTTPRequestWithParams(r *http.Request) (*Route, *http.Request) {
+	route, params := m.FindRouteByPathWithParams(r.URL.Path)
+	return route, httputils.WithPathParams(r, params)
+}
+
+func (m MapRoutes) validateSegment(s string, last bool) error {
+	if s == PathWildcard && !last {
+		return ErrWildcardNotLast
+	}
+
+	if isPathParam(s) {
+		if k := m.paramKey(); k != "" && k != s {
+			return errors.Wrapf(ErrPathParamConflict, "%s and %s", k, s)
+		}
+	}
+
+	return nil
+}
+
 func (m MapRoutes) AddRouteByPath(ctx context.Context, path, routeName string, params *Parameters) (*Route, error) {
-	path = strings.Trim(path, "/")
-	strs := strings.Split(path, "/")
+	return m.addRouteByPath(ctx, path, routeName, params, params)
+}
+
+// AddExcludedRouteByPath adds excluded route, requests to it bypass introspection, captcha,
+// limits and cache. The missing intermediate routes are created as pass-through routes without cache.
+func (m MapRoutes) AddExcludedRouteByPath(ctx context.Context, path, routeName string, params *Parameters, reason string) (*Route, error) {
+	route, err := m.addRouteByPath(ctx, path, routeName, params.PassThrough(), params.Exclude())
+	if err != nil {
+		return nil, err
+	}
+
+	route.excludedReason = reason
+
+	return route, nil
+}
+
+// addRouteByPath adds route with leafParams, missing intermediate routes are created with params
+func (m MapRoutes) addRouteByPath(ctx context.Context, path, routeName string, params, leafParams *Parameters) (*Route, error) {
+	strs := splitPath(path)
+	if len(strs) == 0 {
+		return nil, errors.Wrap(ErrEmptyRoute, path)
+	}
+
 	var (
 		route *Route
 		ok    bool
 	)
 
-	var previousLevelRoutes MapRoutes
 	tmp := m
 
 	for i, s := range strs {
-		if s == "" {
-			continue
+		last := i+1 == len(strs)
+		if err := tmp.validateSegment(s, last); err != nil {
+			return nil, errors.Wrap(err, path)
 		}
+
 		if route, ok = tmp[s]; !ok {
-			tmp[s] = NewRoute(ctx, routeName, params)
-			previousLevelRoutes = tmp
-			tmp = tmp[s].Routes
-		} else {
-			if i+1 == len(strs) {
-				return nil, &ErrDuplicatedRoute{route: path}
+			if last {
+				route = NewRoute(ctx, routeName, leafParams)
+			} else {
+				// The intermediate route has own name, so it doesn't share disk cache and metrics with leaf
+				route = NewRoute(ctx, intermediateName(routeName, strs, i), params)
 			}
-			tmp = route.Routes
+			tmp[s] = route
+		} else if last {
+			return nil, &ErrDuplicatedRoute{route: path}
 		}
+		tmp = route.Routes
+	}
+
+	return route, nil
+}
+
+// intermediateName returns name of intermediate route which is i-th segment of path of route with routeName
+func intermediateName(routeName string, strs []string, i int) string {
+	if name := strings.TrimSuffix(routeName, "/"+strings.Join(strs[i+1:], "/")); name != routeName {
+		return name
 	}
 
-	lastPartOfRoute := strs[len(strs)-1]
-	if lastPartOfRoute == "" {
-		lastPartOfRoute = strs[len(strs)-2]
+	return "/" + strings.Join(strs[:i+1], "/")
+}
+
+// Walk calls f for each route in map and its subroutes, path is a full path of route
+func (m MapRoutes) Walk(f func(path string, route *Route)) {
+	m.walk("", f)
+}
+
+func (m MapRoutes) walk(parentPath string, f func(path string, route *Route)) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
-	return previousLevelRoutes[lastPartOfRoute], nil
+	for _, k := range keys {
+		path := parentPath + "/" + k
+		f(path, m[k])
+		m[k].Routes.walk(path, f)
+	}
 }
@@ -2,9 +2,12 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"testing"
 
+	"github.com/soldatov-s/accp/internal/cache"
+	"github.com/soldatov-s/accp/internal/httputils"
 	"github.com/soldatov-s/accp/internal/logger"
 	"github.com/soldatov-s/accp/internal/meta"
 	"github.com/stretchr/testify/require"
@@ -78,6 +81,31 @@ func TestAddRouteByPath(t *testing.T) {
 	}
 }
 
+func TestAddRouteByPathIntermediateName(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	rm := make(MapRoutes)
+
+	// The intermediate routes are named by own path, so they don't share disk cache of leaf route
+	_, err := rm.AddRouteByPath(ctx, "v1/users", "/api/v1/users", &Parameters{})
+	require.Nil(t, err)
+	_, err = rm.AddRouteByPath(ctx, "v2/orders", "other", &Parameters{})
+	require.Nil(t, err)
+
+	names := make(map[string]string)
+	rm.Walk(func(path string, route *Route) {
+		names[path] = route.route
+	})
+	require.Equal(t, map[string]string{
+		"/v1":        "/api/v1",
+		"/v1/users":  "/api/v1/users",
+		"/v2":        "/v2",
+		"/v2/orders": "other",
+	}, names)
+}
+
 func TestFindRouteByPath(t *testing.T) {
 	ctx := context.Background()
 	ctx = initApp(ctx)
@@ -172,3 +200,167 @@ func TestFindRouteByHTTPRequest(t *testing.T) {
 
 	t.Logf("route: %+v", r)
 }
+
+// nolint : funlen
+func TestFindRouteByPathWithParams(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	rm := make(MapRoutes)
+
+	for _, path := range []string{
+		"/api/v1/users",
+		"/api/v1/users/me",
+		"/api/v1/users/{id}/orders",
+		"/api/v1/users/*",
+		"/static/*",
+	} {
+		_, err := rm.AddRouteByPath(ctx, path, path, &Parameters{})
+		require.Nil(t, err)
+	}
+
+	// The intermediate routes are matched too, so routes are compared by their real paths
+	byPath := make(map[string]*Route)
+	rm.Walk(func(path string, route *Route) {
+		byPath[path] = route
+	})
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedRoute  string
+		expectedParams httputils.PathParams
+	}{
+		{
+			name:          "literal segment has priority over parameter",
+			path:          "/api/v1/users/me",
+			expectedRoute: "/api/v1/users/me",
+		},
+		{
+			name:           "named parameter",
+			path:           "/api/v1/users/42/orders",
+			expectedRoute:  "/api/v1/users/{id}/orders",
+			expectedParams: httputils.PathParams{"id": "42"},
+		},
+		{
+			name:           "named parameter has priority over wildcard",
+			path:           "/api/v1/users/42",
+			expectedRoute:  "/api/v1/users/{id}",
+			expectedParams: httputils.PathParams{"id": "42"},
+		},
+		{
+			name:           "wildcard is matched if named parameter has not subroute",
+			path:           "/api/v1/users/42/foo",
+			expectedRoute:  "/api/v1/users/*",
+			expectedParams: httputils.PathParams{PathWildcard: "42/foo"},
+		},
+		{
+			name:           "named parameter is matched if literal segment has not subroute",
+			path:           "/api/v1/users/me/orders",
+			expectedRoute:  "/api/v1/users/{id}/orders",
+			expectedParams: httputils.PathParams{"id": "me"},
+		},
+		{
+			name:           "wildcard matches the rest of path",
+			path:           "/static/css/main.css",
+			expectedRoute:  "/static/*",
+			expectedParams: httputils.PathParams{PathWildcard: "css/main.css"},
+		},
+		{
+			name:          "not matched subpath returns parent route",
+			path:          "/api/v2",
+			expectedRoute: "/api",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r, params := rm.FindRouteByPathWithParams(tt.path)
+			require.NotNil(t, r)
+			require.True(t, byPath[tt.expectedRoute] == r, "expected route %s", tt.expectedRoute)
+			require.Equal(t, tt.expectedParams, params)
+		})
+	}
+}
+
+func TestAddRouteByPathWithParams(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	rm := make(MapRoutes)
+
+	_, err := rm.AddRouteByPath(ctx, "/api/v1/users/{id}", "/api/v1/users/{id}", &Parameters{})
+	require.Nil(t, err)
+
+	_, err = rm.AddRouteByPath(ctx, "/api/v1/users/{uid}/orders", "/api/v1/users/{uid}/orders", &Parameters{})
+	require.True(t, errors.Is(err, ErrPathParamConflict))
+
+	_, err = rm.AddRouteByPath(ctx, "/static/*/css", "/static/*/css", &Parameters{})
+	require.True(t, errors.Is(err, ErrWildcardNotLast))
+
+	_, err = rm.AddRouteByPath(ctx, "/", "/", &Parameters{})
+	require.True(t, errors.Is(err, ErrEmptyRoute))
+}
+
+func TestFindRouteByHTTPRequestWithParams(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	rm := make(MapRoutes)
+
+	_, err := rm.AddRouteByPath(ctx, "/api/v1/users/{id}", "/api/v1/users/{id}", &Parameters{})
+	require.Nil(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:10000"+"/api/v1/users/42", nil)
+	require.Nil(t, err)
+
+	r, req := rm.FindRouteByHTTPRequestWithParams(req)
+	require.NotNil(t, r)
+	require.Equal(t, "42", httputils.GetPathParams(req).Get("id"))
+}
+
+func TestAddExcludedRouteByPath(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	rm := make(MapRoutes)
+
+	params := &Parameters{
+		Cache: &cache.Config{},
+	}
+
+	_, err := rm.AddRouteByPath(ctx, "/api/v1/users", "/api/v1/users", params)
+	require.Nil(t, err)
+
+	r, err := rm.AddExcludedRouteByPath(ctx, "/api/v1/users/avatar", "/api/v1/users/avatar", params, "test reason")
+	require.Nil(t, err)
+	require.NotNil(t, r)
+	require.True(t, r.isExcluded())
+	require.Equal(t, "test reason", r.ExcludedReason())
+
+	// intermediate routes are not excluded
+	r, err = rm.AddExcludedRouteByPath(ctx, "/api/v2/health", "/api/v2/health", params, "test reason")
+	require.Nil(t, err)
+	require.True(t, r.isExcluded())
+	require.False(t, rm.FindRouteByPath("/api/v2").isExcluded())
+	require.False(t, rm.FindRouteByPath("/api/v1/users").isExcluded())
+	// intermediate routes pass requests through without cache
+	require.True(t, rm.FindRouteByPath("/api/v2").parameters.Cache.Disabled)
+	require.False(t, rm.FindRouteByPath("/api/v1/users").parameters.Cache.Disabled)
+
+	_, err = rm.AddExcludedRouteByPath(ctx, "/api/v1/users", "/api/v1/users", params, "test reason")
+	require.NotNil(t, err)
+
+	var excluded []string
+	rm.Walk(func(path string, route *Route) {
+		if route.ExcludedReason() != "" {
+			excluded = append(excluded, path)
+		}
+	})
+	require.Equal(t, []string{"/api/v1/users/avatar", "/api/v2/health"}, excluded)
+}
@@ -9,10 +9,14 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/soldatov-s/accp/internal/cache"
 	"github.com/soldatov-s/accp/internal/cache/external"
 	"github.com/soldatov-s/accp/internal/cache/memory"
@@ -23,7 +27,10 @@ import (
 	"github.com/soldatov-s/accp/internal/rabbitmq"
 	"github.com/soldatov-s/accp/internal/redis"
 	rrdata "github.com/soldatov-s/accp/internal/request_response_data"
+	"github.com/soldatov-s/accp/internal/routes/breaker"
 	"github.com/soldatov-s/accp/internal/routes/refresh"
+	"github.com/soldatov-s/accp/internal/routes/retry"
+	"github.com/soldatov-s/accp/internal/upstream"
 	"github.com/soldatov-s/accp/x/dockertest"
 	testproxyhelpers "github.com/soldatov-s/accp/x/test_helpers/proxy"
 	rabbitMQConsumer "github.com/soldatov-s/accp/x/test_helpers/rabbitmq"
@@ -221,7 +228,7 @@ func TestNewRoute(t *testing.T) {
 
 				require.NotNil(t, r.cache)
 				require.NotNil(t, r.limits)
-				require.NotNil(t, r.refreshTimer)
+				require.NotNil(t, r.refresher)
 			},
 		},
 		{
@@ -236,7 +243,7 @@ func TestNewRoute(t *testing.T) {
 
 				require.Nil(t, r.cache)
 				require.Nil(t, r.limits)
-				require.Nil(t, r.refreshTimer)
+				require.Nil(t, r.refresher)
 			},
 		},
 	}
@@ -262,8 +269,15 @@ func TestIsExcluded(t *testing.T) {
 	r := NewRoute(ctx, "/api/v1/users", params)
 	require.NotNil(t, r)
 
+	// captcha is still enabled
 	result := r.isExcluded()
+	require.False(t, result)
+	require.Empty(t, r.ExcludedReason())
+
+	params.NotCaptcha = true
+	result = r.isExcluded()
 	require.True(t, result)
+	require.Equal(t, excludedByParameters, r.ExcludedReason())
 }
 
 // nolint : dupl
@@ -402,7 +416,7 @@ func TestHydrationIntrospect(t *testing.T) {
 
 				req.Header.Add("Authorization", "bearer "+testproxyhelpers.TestToken)
 
-				err = r.hydrationIntrospect(req)
+				req, err = r.hydrationIntrospect(req)
 				require.Nil(t, err)
 
 				header := req.Header.Get(hydrationIntrospectHeader)
@@ -418,7 +432,7 @@ func TestHydrationIntrospect(t *testing.T) {
 
 				req.Header.Add("Authorization", "bearer "+testproxyhelpers.TestToken)
 
-				err = r.hydrationIntrospect(req)
+				req, err = r.hydrationIntrospect(req)
 				require.Nil(t, err)
 
 				header := req.Header.Get(hydrationIntrospectHeader)
@@ -434,7 +448,7 @@ func TestHydrationIntrospect(t *testing.T) {
 
 				req.Header.Add("Authorization", "bearer "+testproxyhelpers.TestToken)
 
-				err = r.hydrationIntrospect(req)
+				req, err = r.hydrationIntrospect(req)
 				require.Nil(t, err)
 
 				header := req.Header.Get(hydrationIntrospectHeader)
@@ -449,7 +463,7 @@ func TestHydrationIntrospect(t *testing.T) {
 
 				req.Header.Set("Authorization", "bearer "+testproxyhelpers.BadToken)
 
-				err = r.hydrationIntrospect(req)
+				req, err = r.hydrationIntrospect(req)
 				require.NotNil(t, err)
 			},
 		},
@@ -599,6 +613,129 @@ func TestNotCached(t *testing.T) {
 	}
 }
 
+func TestNotCachedWithUpstreams(t *testing.T) {
+	server := testproxyhelpers.FakeBackendService(t, testproxyhelpers.DefaultFakeServiceHost)
+	server.Start()
+	defer server.Close()
+
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	params := initParameters()
+	// The second upstream is unavailable
+	params.Upstreams = []string{"http://localhost:1"}
+	params.Balancer = &upstream.Config{MaxFails: 1, Cooldown: time.Minute}
+
+	r := NewRoute(ctx, testproxyhelpers.GetEndpoint, params)
+	require.NotNil(t, r)
+
+	expected := []int{http.StatusOK, http.StatusServiceUnavailable, http.StatusOK, http.StatusOK}
+	for _, code := range expected {
+		req, err := http.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil)
+		require.Nil(t, err)
+
+		w := httptest.NewRecorder()
+		r.notCached(w, req)
+
+		resp := w.Result()
+		resp.Body.Close()
+		// After the first failure the unavailable upstream is ejected
+		require.Equal(t, code, resp.StatusCode)
+	}
+}
+
+func TestNotCachedWithRetry(t *testing.T) {
+	server := testproxyhelpers.FakeBackendService(t, testproxyhelpers.DefaultFakeServiceHost)
+	server.Start()
+	defer server.Close()
+
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	params := initParameters()
+	// The request to unavailable upstream is retried to the first one
+	params.Upstreams = []string{"http://localhost:1"}
+	params.Retry = &retry.Config{Attempts: 2}
+
+	r := NewRoute(ctx, testproxyhelpers.GetEndpoint, params)
+	require.NotNil(t, r)
+
+	for i := 0; i < 4; i++ {
+		req, err := http.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil)
+		require.Nil(t, err)
+
+		w := httptest.NewRecorder()
+		r.notCached(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+}
+
+func TestRetryStatuses(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every third request succeeds
+		if atomic.AddInt32(&hits, 1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{})
+	r.retry = retry.NewPolicy(&retry.Config{Attempts: 3, MinRetries: 10})
+
+	w := httptest.NewRecorder()
+	r.notCached(w, httptest.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "ok", w.Body.String())
+	require.Equal(t, int32(3), atomic.LoadInt32(&hits))
+
+	// The cache miss is retried too
+	status, _, body := cachedRequest(t, r)
+	require.Equal(t, "200", status)
+	require.Equal(t, "ok", body)
+	require.Equal(t, int32(6), atomic.LoadInt32(&hits))
+
+	// The not idempotent request is not retried
+	w = httptest.NewRecorder()
+	r.notCached(w, httptest.NewRequest(http.MethodPost, testproxyhelpers.GetEndpoint, strings.NewReader("body")))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, int32(7), atomic.LoadInt32(&hits))
+}
+
+func TestNotCachedWithBreaker(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	params := initParameters()
+	params.DSN = "http://localhost:1"
+	params.Breaker = &breaker.Config{
+		Failures: 1,
+		Status:   http.StatusOK,
+		Body:     "maintenance",
+		Headers:  map[string]string{"Content-Type": "text/html"},
+	}
+
+	r := NewRoute(ctx, testproxyhelpers.GetEndpoint, params)
+	require.NotNil(t, r)
+
+	w := httptest.NewRecorder()
+	r.notCached(w, httptest.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// The open breaker fails fast with configured response
+	w = httptest.NewRecorder()
+	r.notCached(w, httptest.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/html", w.Header().Get("Content-Type"))
+	require.NotEmpty(t, w.Header().Get("Retry-After"))
+	require.Equal(t, "maintenance", w.Body.String())
+}
+
 // nolint : funlen
 func TestRequestToBack(t *testing.T) {
 	ctx := context.Background()
@@ -797,6 +934,229 @@ func TestCachedHandler(t *testing.T) {
 	require.Equal(t, workers, successCount)
 }
 
+// countingBackend returns server which answers with number of request in body
+// and with statusCode, if it is not 0
+func countingBackend(statusCode *int32) (*httptest.Server, *int32) {
+	counter := int32(0)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if code := atomic.LoadInt32(statusCode); code != 0 {
+			w.WriteHeader(int(code))
+			return
+		}
+		_, _ = w.Write([]byte(strconv.Itoa(int(atomic.AddInt32(&counter, 1)))))
+	})), &counter
+}
+
+func initStaleRoute(t *testing.T, dsn string, cacheCfg *cache.Config) *Route {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+
+	cacheCfg.Memory = &memory.Config{TTL: time.Minute, TTLErr: time.Minute}
+	params := &Parameters{
+		DSN:           dsn,
+		Cache:         cacheCfg,
+		Refresh:       &refresh.Config{MaxCount: 1000, Time: time.Hour},
+		NotIntrospect: true,
+		NotCaptcha:    true,
+	}
+
+	r := NewRoute(ctx, testproxyhelpers.GetEndpoint, params)
+	require.NotNil(t, r)
+
+	return r
+}
+
+func cachedRequest(t *testing.T, r *Route) (status, source, body string) {
+	req, err := http.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil)
+	require.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	r.cachedHandler(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+
+	return strconv.Itoa(resp.StatusCode), resp.Header.Get(rrdata.ResponseSourceHeader), string(data)
+}
+
+func TestStaleIfError(t *testing.T) {
+	statusCode := int32(0)
+	server, _ := countingBackend(&statusCode)
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{StaleIfError: time.Minute})
+
+	status, src, body := cachedRequest(t, r)
+	require.Equal(t, "200", status)
+	require.Equal(t, rrdata.ResponseBack.String(), src)
+	require.Equal(t, "1", body)
+
+	req, err := http.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil)
+	require.Nil(t, err)
+	hk, err := httputils.HashRequest(req)
+	require.Nil(t, err)
+	data, err := r.cache.Select(hk)
+	require.Nil(t, err)
+
+	// Refresh failed, previous response is served as stale
+	atomic.StoreInt32(&statusCode, http.StatusInternalServerError)
+	require.NotNil(t, r.refreshHandler(hk, data))
+
+	status, src, body = cachedRequest(t, r)
+	require.Equal(t, "200", status)
+	require.Equal(t, rrdata.ResponseStale.String(), src)
+	require.Equal(t, "1", body)
+
+	// Refresh succeeded
+	atomic.StoreInt32(&statusCode, 0)
+	require.Nil(t, r.refreshHandler(hk, data))
+
+	status, src, body = cachedRequest(t, r)
+	require.Equal(t, "200", status)
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Equal(t, "2", body)
+
+	// Without stale-if-error failed refresh replaces response
+	r.parameters.Cache.StaleIfError = 0
+	atomic.StoreInt32(&statusCode, http.StatusInternalServerError)
+	require.Nil(t, r.refreshHandler(hk, data))
+
+	status, src, _ = cachedRequest(t, r)
+	require.Equal(t, "500", status)
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	statusCode := int32(0)
+	server, counter := countingBackend(&statusCode)
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{MaxAge: time.Second, StaleWhileRevalidate: time.Minute})
+
+	_, src, body := cachedRequest(t, r)
+	require.Equal(t, rrdata.ResponseBack.String(), src)
+	require.Equal(t, "1", body)
+
+	_, src, body = cachedRequest(t, r)
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Equal(t, "1", body)
+
+	// Response is expired, stale response is served while it is refreshed in background
+	time.Sleep(2100 * time.Millisecond)
+	_, src, body = cachedRequest(t, r)
+	require.Equal(t, rrdata.ResponseStale.String(), src)
+	require.Equal(t, "1", body)
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(counter) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		_, src, body = cachedRequest(t, r)
+		return src == rrdata.ResponseCache.String() && body == "2"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestExpiredWithoutStaleWhileRevalidate(t *testing.T) {
+	statusCode := int32(0)
+	server, _ := countingBackend(&statusCode)
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{MaxAge: time.Second})
+
+	_, _, body := cachedRequest(t, r)
+	require.Equal(t, "1", body)
+
+	// Response is expired, it is refreshed before answer
+	time.Sleep(2100 * time.Millisecond)
+	_, src, body := cachedRequest(t, r)
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Equal(t, "2", body)
+}
+
+// nolint : funlen
+func TestRespectCacheControl(t *testing.T) {
+	var (
+		counter int32
+		header  atomic.Value
+	)
+	header.Store(http.Header{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httputils.CopyHeader(w.Header(), header.Load().(http.Header))
+		_, _ = w.Write([]byte(strconv.Itoa(int(atomic.AddInt32(&counter, 1)))))
+	}))
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{RespectCacheControl: true})
+
+	request := func(path, language string) (source, body string) {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		require.Nil(t, err)
+		req.Header.Set("Accept-Language", language)
+
+		w := httptest.NewRecorder()
+		r.cachedHandler(w, req)
+
+		resp := w.Result()
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		require.Nil(t, err)
+
+		return resp.Header.Get(rrdata.ResponseSourceHeader), string(data)
+	}
+
+	// Response is not cached
+	header.Store(http.Header{"Cache-Control": {"no-store"}})
+	src, body := request("/nostore", "en")
+	require.Equal(t, rrdata.ResponseBack.String(), src)
+	require.Equal(t, "1", body)
+	src, body = request("/nostore", "en")
+	require.Equal(t, rrdata.ResponseBack.String(), src)
+	require.Equal(t, "2", body)
+
+	// Response is cached for max-age
+	header.Store(http.Header{"Cache-Control": {"max-age=1"}})
+	_, body = request("/maxage", "en")
+	require.Equal(t, "3", body)
+	src, body = request("/maxage", "en")
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Equal(t, "3", body)
+
+	time.Sleep(1100 * time.Millisecond)
+	src, body = request("/maxage", "en")
+	require.Equal(t, rrdata.ResponseBack.String(), src)
+	require.Equal(t, "4", body)
+
+	// Lifetime is capped by TTL from config
+	header.Store(http.Header{"Cache-Control": {"max-age=3600"}})
+	_, body = request("/cap", "en")
+	require.Equal(t, "5", body)
+	req, err := http.NewRequest(http.MethodGet, "/cap", nil)
+	require.Nil(t, err)
+	hk, err := httputils.HashRequest(req)
+	require.Nil(t, err)
+	data, err := r.cache.Select(hk)
+	require.Nil(t, err)
+	require.True(t, time.Until(data.ExpiresAt()) <= r.parameters.Cache.Memory.TTL)
+
+	// Vary headers go into the key
+	header.Store(http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"Accept-Language"}})
+	_, body = request("/vary", "en")
+	require.Equal(t, "6", body)
+	src, body = request("/vary", "ru")
+	require.Equal(t, rrdata.ResponseBack.String(), src)
+	require.Equal(t, "7", body)
+	src, body = request("/vary", "en")
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Equal(t, "6", body)
+	src, body = request("/vary", "ru")
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Equal(t, "7", body)
+}
+
 // nolint : funlen
 func TestRefresh(t *testing.T) {
 	ctx := context.Background()
@@ -1059,3 +1419,497 @@ func TestProxyHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestConditionalRequests(t *testing.T) {
+	const etag = `"v1"`
+	var full, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(httputils.ETagHeader, etag)
+		if r.Header.Get(httputils.IfNoneMatchHeader) == etag {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte(strconv.Itoa(int(atomic.AddInt32(&full, 1)))))
+	}))
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{})
+
+	request := func(ifNoneMatch string) (status int, source, body string) {
+		req, err := http.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil)
+		require.Nil(t, err)
+		req.Header.Set(httputils.IfNoneMatchHeader, ifNoneMatch)
+
+		w := httptest.NewRecorder()
+		r.cachedHandler(w, req)
+
+		resp := w.Result()
+		defer resp.Body.Close()
+		require.Equal(t, etag, resp.Header.Get(httputils.ETagHeader))
+		data, err := ioutil.ReadAll(resp.Body)
+		require.Nil(t, err)
+
+		return resp.StatusCode, resp.Header.Get(rrdata.ResponseSourceHeader), string(data)
+	}
+
+	// The validator of client is not passed to backend, the full response is cached
+	status, src, body := request(etag)
+	require.Equal(t, http.StatusNotModified, status)
+	require.Equal(t, rrdata.ResponseBack.String(), src)
+	require.Empty(t, body)
+	require.Equal(t, int32(1), atomic.LoadInt32(&full))
+	require.Equal(t, int32(0), atomic.LoadInt32(&notModified))
+
+	status, src, body = request(`"other"`)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Equal(t, "1", body)
+
+	status, src, body = request(etag)
+	require.Equal(t, http.StatusNotModified, status)
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Empty(t, body)
+
+	// Refresh revalidates response by conditional request, the response is kept
+	req, err := http.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil)
+	require.Nil(t, err)
+	hk, err := httputils.HashRequest(req)
+	require.Nil(t, err)
+	data, err := r.cache.Select(hk)
+	require.Nil(t, err)
+	require.Nil(t, r.refreshHandler(hk, data))
+	require.Equal(t, int32(1), atomic.LoadInt32(&full))
+	require.Equal(t, int32(1), atomic.LoadInt32(&notModified))
+
+	status, src, body = request("")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Equal(t, "1", body)
+}
+
+func TestCompression(t *testing.T) {
+	var counter int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&counter, 1)
+		_, _ = w.Write([]byte(strings.Repeat(strconv.Itoa(int(n)), 2048)))
+	}))
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{Compression: &cache.CompressionConfig{Encoding: httputils.EncodingZstd}})
+
+	request := func(acceptEncoding string) (source, encoding, body string) {
+		req, err := http.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil)
+		require.Nil(t, err)
+		req.Header.Set(httputils.AcceptEncodingHeader, acceptEncoding)
+
+		w := httptest.NewRecorder()
+		r.cachedHandler(w, req)
+
+		return w.Header().Get(rrdata.ResponseSourceHeader), w.Header().Get(httputils.ContentEncodingHeader), w.Body.String()
+	}
+
+	// The response from backend is sent as is
+	src, encoding, body := request("zstd")
+	require.Equal(t, rrdata.ResponseBack.String(), src)
+	require.Empty(t, encoding)
+	require.Equal(t, strings.Repeat("1", 2048), body)
+
+	src, encoding, body = request("gzip, zstd")
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Equal(t, httputils.EncodingZstd, encoding)
+	decompressed, err := httputils.Decompress(httputils.EncodingZstd, []byte(body))
+	require.Nil(t, err)
+	require.Equal(t, strings.Repeat("1", 2048), string(decompressed))
+
+	src, encoding, body = request("gzip")
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Empty(t, encoding)
+	require.Equal(t, strings.Repeat("1", 2048), body)
+
+	// The refreshed response is compressed too
+	req, err := http.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil)
+	require.Nil(t, err)
+	hk, err := httputils.HashRequest(req)
+	require.Nil(t, err)
+	data, err := r.cache.Select(hk)
+	require.Nil(t, err)
+	require.Nil(t, r.refreshHandler(hk, data))
+	require.Equal(t, httputils.EncodingZstd, data.Response.Encoding)
+
+	_, _, body = request("")
+	require.Equal(t, strings.Repeat("2", 2048), body)
+}
+
+func TestMaxCacheBodySize(t *testing.T) {
+	size := int32(4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", int(atomic.LoadInt32(&size)))))
+	}))
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{MaxCacheBodySize: 8})
+
+	// The small response is captured while it is streamed
+	_, src, body := cachedRequest(t, r)
+	require.Equal(t, rrdata.ResponseBack.String(), src)
+	require.Equal(t, "xxxx", body)
+
+	_, src, body = cachedRequest(t, r)
+	require.Equal(t, rrdata.ResponseCache.String(), src)
+	require.Equal(t, "xxxx", body)
+
+	// The response which became large is removed by refresh
+	atomic.StoreInt32(&size, 16)
+	req, err := http.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil)
+	require.Nil(t, err)
+	hk, err := httputils.HashRequest(req)
+	require.Nil(t, err)
+	data, err := r.cache.Select(hk)
+	require.Nil(t, err)
+	require.Nil(t, r.refreshHandler(hk, data))
+
+	// The large response is streamed and never stored
+	for i := 0; i < 2; i++ {
+		_, src, body = cachedRequest(t, r)
+		require.Equal(t, rrdata.ResponseBack.String(), src)
+		require.Equal(t, strings.Repeat("x", 16), body)
+	}
+}
+
+func TestMaxRequestBody(t *testing.T) {
+	statusCode := int32(0)
+	server, counter := countingBackend(&statusCode)
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{})
+	r.parameters.MaxRequestBody = 4
+
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		expected      int
+	}{
+		{
+			name:          "small body",
+			body:          "1234",
+			contentLength: 4,
+			expected:      http.StatusOK,
+		},
+		{
+			name:          "large body",
+			body:          "12345",
+			contentLength: 5,
+			expected:      http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:          "small body of unknown length",
+			body:          "123",
+			contentLength: -1,
+			expected:      http.StatusOK,
+		},
+		{
+			name:          "large body of unknown length",
+			body:          "12345",
+			contentLength: -1,
+			expected:      http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			before := atomic.LoadInt32(counter)
+
+			req, err := http.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, strings.NewReader(tt.body))
+			require.Nil(t, err)
+			req.ContentLength = tt.contentLength
+
+			w := httptest.NewRecorder()
+			r.ProxyHandler(w, req)
+			require.Equal(t, tt.expected, w.Code)
+
+			// The large request doesn't reach backend
+			if tt.expected == http.StatusRequestEntityTooLarge {
+				require.Equal(t, before, atomic.LoadInt32(counter))
+			}
+		})
+	}
+}
+
+func TestMaxResponseBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 16)))
+	}))
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{})
+	r.parameters.MaxResponseBody = 8
+
+	before := testutil.ToFloat64(oversizedMetric.WithLabelValues(r.route))
+
+	// The large response is passed through uncached
+	for i := 0; i < 2; i++ {
+		_, src, body := cachedRequest(t, r)
+		require.Equal(t, rrdata.ResponseBack.String(), src)
+		require.Equal(t, strings.Repeat("x", 16), body)
+	}
+
+	require.Equal(t, before+2, testutil.ToFloat64(oversizedMetric.WithLabelValues(r.route)))
+}
+
+func TestDistributedCoalescing(t *testing.T) {
+	ctx := context.Background()
+	ctx = initApp(ctx)
+	ctx = initLogger(ctx)
+	ctx = initExternalCache(ctx, t)
+	defer dockertest.KillAllDockers()
+
+	var counter int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&counter, 1)
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte("coalesced"))
+	}))
+	defer server.Close()
+
+	// The routes with own memory caches are replicas which share external cache
+	replicas := make([]*Route, 3)
+	for i := range replicas {
+		params := &Parameters{
+			DSN: server.URL,
+			Cache: &cache.Config{
+				Memory:     &memory.Config{TTL: time.Minute, TTLErr: time.Minute},
+				External:   &external.Config{TTL: time.Minute, TTLErr: time.Minute, KeyPrefix: "accp_coalescing_"},
+				Coalescing: &cache.CoalescingConfig{Distributed: true},
+			},
+			Refresh:       &refresh.Config{MaxCount: 1000, Time: time.Hour},
+			NotIntrospect: true,
+			NotCaptcha:    true,
+		}
+		replicas[i] = NewRoute(ctx, testproxyhelpers.GetEndpoint, params)
+		require.NotNil(t, replicas[i])
+	}
+
+	var wg sync.WaitGroup
+	bodies := make([]string, len(replicas))
+	for i, r := range replicas {
+		wg.Add(1)
+		go func(i int, r *Route) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil)
+			w := httptest.NewRecorder()
+			r.cachedHandler(w, req)
+			bodies[i] = w.Body.String()
+		}(i, r)
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&counter))
+	for _, body := range bodies {
+		require.Equal(t, "coalesced", body)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var hits, failing int32 = 0, 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{})
+	r.breaker = breaker.NewBreaker(&breaker.Config{Failures: 2, Cooldown: 200 * time.Millisecond}, func(state breaker.State) {
+		breakerStateMetric.WithLabelValues(r.route).Set(float64(state))
+	})
+	rejected := testutil.ToFloat64(breakerRejectedMetric.WithLabelValues(r.route))
+
+	// The failed responses are cached, so every request is unique
+	request := func(i int) (status int, body string) {
+		w := httptest.NewRecorder()
+		r.cachedHandler(w, httptest.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint+"?i="+strconv.Itoa(i), nil))
+
+		return w.Code, w.Body.String()
+	}
+
+	for i := 0; i < 2; i++ {
+		status, _ := request(i)
+		require.Equal(t, http.StatusInternalServerError, status)
+	}
+	require.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	require.Equal(t, "open", r.BreakerStatus().State)
+	require.Equal(t, float64(breaker.StateOpen), testutil.ToFloat64(breakerStateMetric.WithLabelValues(r.route)))
+
+	// The open breaker answers without request to backend
+	status, body := request(2)
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Contains(t, body, ErrBackendUnavailable.Error())
+	require.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	require.Equal(t, rejected+1, testutil.ToFloat64(breakerRejectedMetric.WithLabelValues(r.route)))
+
+	// After cooldown the request checks backend and closes breaker
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(250 * time.Millisecond)
+	status, body = request(3)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "ok", body)
+	require.Equal(t, "closed", r.BreakerStatus().State)
+	require.Equal(t, float64(breaker.StateClosed), testutil.ToFloat64(breakerStateMetric.WithLabelValues(r.route)))
+}
+
+func TestRefreshBackoff(t *testing.T) {
+	statusCode := int32(0)
+	server, counter := countingBackend(&statusCode)
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{StaleIfError: time.Minute})
+	r.refreshBackoff = refresh.NewBackoff(&refresh.Config{Backoff: 200 * time.Millisecond, MaxBackoff: time.Second})
+
+	_, _, body := cachedRequest(t, r)
+	require.Equal(t, "1", body)
+
+	req, err := http.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil)
+	require.Nil(t, err)
+	hk, err := httputils.HashRequest(req)
+	require.Nil(t, err)
+	data, err := r.cache.Select(hk)
+	require.Nil(t, err)
+
+	// The failed refresh suspends next refreshes
+	atomic.StoreInt32(&statusCode, http.StatusInternalServerError)
+	require.NotNil(t, r.refreshHandler(hk, data))
+	require.False(t, r.refreshBackoff.Until().IsZero())
+
+	// The suspended refresh is reported and response is kept as stale
+	atomic.StoreInt32(&statusCode, 0)
+	require.True(t, errors.Is(r.refreshHandler(hk, data), ErrRefreshSuspended))
+	require.Equal(t, int32(1), atomic.LoadInt32(counter))
+	require.True(t, data.Response.Stale())
+
+	status, src, body := cachedRequest(t, r)
+	require.Equal(t, "200", status)
+	require.Equal(t, rrdata.ResponseStale.String(), src)
+	require.Equal(t, "1", body)
+
+	// After delay the refresh reaches backend again
+	time.Sleep(250 * time.Millisecond)
+	require.Nil(t, r.refreshHandler(hk, data))
+	require.Equal(t, int32(2), atomic.LoadInt32(counter))
+	require.True(t, r.refreshBackoff.Until().IsZero())
+}
+
+func TestBreakerServesStale(t *testing.T) {
+	statusCode := int32(0)
+	server, counter := countingBackend(&statusCode)
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{StaleIfError: time.Minute})
+	r.breaker = breaker.NewBreaker(&breaker.Config{Failures: 1, Cooldown: time.Minute}, nil)
+
+	_, _, body := cachedRequest(t, r)
+	require.Equal(t, "1", body)
+
+	req, err := http.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil)
+	require.Nil(t, err)
+	hk, err := httputils.HashRequest(req)
+	require.Nil(t, err)
+	data, err := r.cache.Select(hk)
+	require.Nil(t, err)
+
+	// The failed refresh opens breaker
+	atomic.StoreInt32(&statusCode, http.StatusInternalServerError)
+	require.NotNil(t, r.refreshHandler(hk, data))
+	require.Equal(t, "open", r.BreakerStatus().State)
+
+	// The refresh rejected by open breaker is reported, the counter counts only successful requests
+	atomic.StoreInt32(&statusCode, 0)
+	require.True(t, errors.Is(r.refreshHandler(hk, data), ErrBackendUnavailable))
+	require.Equal(t, int32(1), atomic.LoadInt32(counter))
+
+	// The miss rejected by open breaker gets stale copy of response
+	w := httptest.NewRecorder()
+	require.Nil(t, r.requestToBack(hk, w, req))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, rrdata.ResponseStale.String(), w.Header().Get(rrdata.ResponseSourceHeader))
+	require.Equal(t, "1", w.Body.String())
+
+	// Without stale copy the miss gets response of breaker
+	require.Nil(t, r.cache.Delete(hk))
+	w = httptest.NewRecorder()
+	require.Nil(t, r.requestToBack(hk, w, req))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, int32(1), atomic.LoadInt32(counter))
+}
+
+func TestResponseHandleWithoutRefresh(t *testing.T) {
+	statusCode := int32(0)
+	server, _ := countingBackend(&statusCode)
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{})
+
+	_, src, _ := cachedRequest(t, r)
+	require.Equal(t, rrdata.ResponseBack.String(), src)
+
+	req, err := http.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil)
+	require.Nil(t, err)
+	hk, err := httputils.HashRequest(req)
+	require.Nil(t, err)
+	data, err := r.cache.Select(hk)
+	require.Nil(t, err)
+
+	// Responses loaded from redis or disk have no refresh counter
+	data.Request = nil
+	data.Response.Refresh = nil
+
+	w := httptest.NewRecorder()
+	require.NotPanics(t, func() { r.responseHandle(data, w, req, hk) })
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotNil(t, data.Response.Refresh)
+	require.NotNil(t, data.Request)
+}
+
+func TestRetryCanceled(t *testing.T) {
+	var (
+		hits   int32
+		cancel context.CancelFunc
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The client disconnects after the first failed attempt
+		atomic.AddInt32(&hits, 1)
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	r := initStaleRoute(t, server.URL, &cache.Config{})
+	r.retry = retry.NewPolicy(&retry.Config{Attempts: 3, Delay: time.Minute, MinRetries: 10})
+	r.breaker = breaker.NewBreaker(&breaker.Config{Failures: 1, Cooldown: time.Minute}, nil)
+
+	request := func() *http.Request {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		return httptest.NewRequest(http.MethodGet, testproxyhelpers.GetEndpoint, nil).WithContext(ctx)
+	}
+
+	start := time.Now()
+	r.notCached(httptest.NewRecorder(), request())
+	require.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	// The miss of canceled request is not cached
+	req := request()
+	hk, err := httputils.HashRequest(req)
+	require.Nil(t, err)
+	require.Nil(t, r.requestToBack(hk, httptest.NewRecorder(), req))
+	require.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	require.Less(t, int64(time.Since(start)), int64(time.Minute))
+
+	// The canceled requests are not failures of backend
+	require.Equal(t, "closed", r.BreakerStatus().State)
+}
@@ -0,0 +1,214 @@
+package routes
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	cacheerrors "github.com/soldatov-s/accp/internal/cache/errors"
+)
+
+const (
+	hostHeader   = "Host"
+	cookieHeader = "Cookie"
+)
+
+// WarmUpRequest is a request which is replayed on start to fill cache
+type WarmUpRequest struct {
+	// Method is a method of request, by default GET
+	Method string `json:"method,omitempty"`
+	// URL is a request URI or absolute URL, the host of absolute URL is used for matching of variants
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// HTTPRequest returns request to proxy
+func (w *WarmUpRequest) HTTPRequest() (*http.Request, error) {
+	method := w.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if w.Body != "" {
+		body = strings.NewReader(w.Body)
+	}
+
+	// The request URI is proxied to upstream, so the URL of request must be relative
+	req, err := http.NewRequest(method, u.RequestURI(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Host = u.Host
+	for k, v := range w.Headers {
+		if strings.EqualFold(k, hostHeader) {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+
+	return req, nil
+}
+
+// discardWriter is a response writer of warm-up requests, the response is only cached
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = make(http.Header)
+	}
+
+	return w.header
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteHeader(int) {}
+
+// Caches checks that route caches responses to req
+func (r *Route) Caches(req *http.Request) bool {
+	return r.cache != nil &&
+		!r.isExcluded() &&
+		!r.parameters.Cache.Disabled &&
+		r.parameters.Methods.Has(req.Method) &&
+		r.balancer.Len() > 0
+}
+
+// WarmUp requests response to req from backend and caches it, the cached response is not requested
+// again. The introspection is checked, the limits and captcha are skipped.
+func (r *Route) WarmUp(req *http.Request) error {
+	if !r.Caches(req) {
+		return ErrNotCachedRequest
+	}
+
+	req, err := r.hydrationIntrospect(req)
+	if err != nil {
+		return err
+	}
+
+	baseHK, err := r.parameters.Cache.Key.HashRequest(req)
+	if err != nil {
+		return err
+	}
+
+	hk := r.cacheKey(baseHK, req)
+	if _, err = r.cache.Select(hk); err == nil {
+		return nil
+	} else if !errors.Is(err, cacheerrors.ErrNotFound) {
+		return err
+	}
+
+	rrData := r.requestToBack(hk, &discardWriter{}, req)
+	if rrData == nil {
+		return ErrNotCachedRequest
+	}
+
+	if rrData.Response.StatusCode >= http.StatusInternalServerError {
+		return errors.Errorf("backend answered %d", rrData.Response.StatusCode)
+	}
+
+	r.store(baseHK, req, rrData)
+
+	return nil
+}
+
+// credentialHeaders are headers which are never remembered, they may carry tokens and sessions
+var credentialHeaders = map[string]struct{}{
+	"Authorization":       {},
+	"Proxy-Authorization": {},
+	cookieHeader:          {},
+}
+
+// rememberRequest remembers request of cached response in external cache, so other instances
+// may warm up by it
+func (r *Route) rememberRequest(req *http.Request, vary []string) error {
+	if r.cache.External == nil {
+		return nil
+	}
+
+	w := r.recentRequest(req, vary)
+	if w == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	return r.cache.External.AddRecent(string(data))
+}
+
+// recentRequest returns request for warm-up by req or nil if req can't be remembered. Only headers
+// of cache key and vary headers of response are remembered, credentials and cookies are never remembered.
+// The requests of introspected routes aren't remembered, they can't be replayed without token.
+func (r *Route) recentRequest(req *http.Request, vary []string) *WarmUpRequest {
+	// The bodies are not remembered, they may be large
+	if req.ContentLength > 0 || (!r.parameters.NotIntrospect && r.introspector != nil) {
+		return nil
+	}
+
+	w := &WarmUpRequest{Method: req.Method, URL: req.URL.RequestURI(), Headers: make(map[string]string)}
+	if req.Host != "" {
+		w.Headers[hostHeader] = req.Host
+	}
+
+	names := make([]string, 0)
+	if key := r.parameters.Cache.Key; key != nil {
+		names = append(names, key.Headers...)
+	}
+
+	names = append(names, vary...)
+
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		if _, ok := credentialHeaders[name]; ok {
+			continue
+		}
+
+		if v := req.Header.Get(name); v != "" {
+			w.Headers[name] = v
+		}
+	}
+
+	return w
+}
+
+// RecentRequests returns latest requests of cached responses remembered in external cache
+func (r *Route) RecentRequests() ([]*WarmUpRequest, error) {
+	if r.cache == nil || r.cache.External == nil {
+		return nil, nil
+	}
+
+	recent, err := r.cache.External.Recent()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*WarmUpRequest, 0, len(recent))
+	for _, v := range recent {
+		w := &WarmUpRequest{}
+		if err := json.Unmarshal([]byte(v), w); err != nil {
+			r.log.Err(err).Msg("failed to decode recent request")
+			continue
+		}
+		result = append(result, w)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soldatov-s/accp/internal/cache"
+	"github.com/soldatov-s/accp/internal/introspection"
+	"github.com/soldatov-s/accp/x/helper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmUpRequest(t *testing.T) {
+	w := &WarmUpRequest{
+		URL:     "https://example.com/api/v1/users?page=2",
+		Headers: map[string]string{"Accept-Language": "ru"},
+	}
+
+	req, err := w.HTTPRequest()
+	require.Nil(t, err)
+	require.Equal(t, http.MethodGet, req.Method)
+	require.Equal(t, "/api/v1/users?page=2", req.URL.String())
+	require.Equal(t, "example.com", req.Host)
+	require.Equal(t, "ru", req.Header.Get("Accept-Language"))
+
+	w = &WarmUpRequest{
+		Method:  http.MethodPost,
+		URL:     "/api/v1/search",
+		Headers: map[string]string{"host": "api.example.com"},
+		Body:    `{"query":"test"}`,
+	}
+
+	req, err = w.HTTPRequest()
+	require.Nil(t, err)
+	require.Equal(t, "api.example.com", req.Host)
+	require.Empty(t, req.Header.Get("Host"))
+
+	body, err := ioutil.ReadAll(req.Body)
+	require.Nil(t, err)
+	require.Equal(t, `{"query":"test"}`, string(body))
+}
+
+func TestRecentRequest(t *testing.T) {
+	r := &Route{
+		parameters: &Parameters{
+			Cache: &cache.Config{
+				Key: &cache.KeyConfig{
+					Headers: helper.Arguments{"Accept-Language", "Authorization"},
+					Cookies: helper.Arguments{"session"},
+				},
+			},
+		},
+	}
+	vary := []string{"Proxy-Authorization", "X-Region", "cookie"}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/api/v1/users?page=2", nil)
+	req.Header.Set("Accept-Language", "ru")
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Proxy-Authorization", "Basic secret")
+	req.Header.Set("X-Region", "eu")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "secret"})
+
+	w := r.recentRequest(req, vary)
+	require.NotNil(t, w)
+	require.Equal(t, http.MethodGet, w.Method)
+	require.Equal(t, "/api/v1/users?page=2", w.URL)
+	require.Equal(t, map[string]string{
+		"Host":            "example.com",
+		"Accept-Language": "ru",
+		"X-Region":        "eu",
+	}, w.Headers)
+
+	r.introspector = &introspection.Introspect{}
+	require.Nil(t, r.recentRequest(req, vary))
+
+	r.parameters.NotIntrospect = true
+	require.NotNil(t, r.recentRequest(req, vary))
+}
@@ -0,0 +1,151 @@
+package upstream
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	BalancingRoundRobin = "roundrobin"
+	BalancingLeastConn  = "leastconn"
+	BalancingHash       = "hash"
+
+	defaultBalancing = BalancingRoundRobin
+	defaultCooldown  = 10 * time.Second
+
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 2 * time.Second
+)
+
+// HealthCheckConfig is a configuration of active health checks of upstreams
+type HealthCheckConfig struct {
+	// Path is a path of health endpoint of upstream, health checks are disabled if it is empty
+	Path string
+	// Interval is a period between checks
+	Interval time.Duration
+	// Timeout is a timeout of check
+	Timeout time.Duration
+}
+
+func (c *HealthCheckConfig) SetDefault() {
+	if c.Interval == 0 {
+		c.Interval = defaultHealthCheckInterval
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = defaultHealthCheckTimeout
+	}
+}
+
+func (c *HealthCheckConfig) Merge(target *HealthCheckConfig) *HealthCheckConfig {
+	if c == nil {
+		return target
+	}
+
+	result := &HealthCheckConfig{
+		Path:     c.Path,
+		Interval: c.Interval,
+		Timeout:  c.Timeout,
+	}
+
+	if target == nil {
+		return result
+	}
+
+	if target.Path != "" {
+		result.Path = target.Path
+	}
+
+	if target.Interval > 0 {
+		result.Interval = target.Interval
+	}
+
+	if target.Timeout > 0 {
+		result.Timeout = target.Timeout
+	}
+
+	return result
+}
+
+type Config struct {
+	// Balancing is a strategy of balancing:
+	// - roundrobin, default
+	// - leastconn - upstream with least active requests
+	// - hash - consistent hash on HashHeader or on the cache key
+	Balancing string
+	// HashHeader is a header for consistent hash balancing, if it is empty
+	// or request has not the header the cache key is used
+	HashHeader string
+	// MaxFails is a number of consecutive failures after which upstream is ejected,
+	// zero disables ejection
+	MaxFails int
+	// Cooldown is a period after which ejected upstream is re-admitted
+	Cooldown time.Duration
+	// HealthCheck is a configuration of active health checks, unhealthy upstreams are taken out of rotation
+	HealthCheck *HealthCheckConfig
+}
+
+func (c *Config) SetDefault() {
+	if c.Balancing == "" {
+		c.Balancing = defaultBalancing
+	}
+
+	if c.Cooldown == 0 {
+		c.Cooldown = defaultCooldown
+	}
+
+	if c.HealthCheck != nil {
+		c.HealthCheck.SetDefault()
+	}
+}
+
+// Validate checks that balancing strategy is known
+func (c *Config) Validate() error {
+	switch c.Balancing {
+	case "", BalancingRoundRobin, BalancingLeastConn, BalancingHash:
+		return nil
+	default:
+		return errors.Wrap(ErrUnknownBalancing, c.Balancing)
+	}
+}
+
+func (c *Config) Merge(target *Config) *Config {
+	if c == nil {
+		return target
+	}
+
+	result := &Config{
+		Balancing:   c.Balancing,
+		HashHeader:  c.HashHeader,
+		MaxFails:    c.MaxFails,
+		Cooldown:    c.Cooldown,
+		HealthCheck: c.HealthCheck,
+	}
+
+	if target == nil {
+		return result
+	}
+
+	if target.Balancing != "" {
+		result.Balancing = target.Balancing
+	}
+
+	if target.HashHeader != "" {
+		result.HashHeader = target.HashHeader
+	}
+
+	if target.MaxFails > 0 {
+		result.MaxFails = target.MaxFails
+	}
+
+	if target.Cooldown > 0 {
+		result.Cooldown = target.Cooldown
+	}
+
+	if target.HealthCheck != nil {
+		result.HealthCheck = c.HealthCheck.Merge(target.HealthCheck)
+	}
+
+	return result
+}
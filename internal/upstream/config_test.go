@@ -0,0 +1,76 @@
+package upstream
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDefault(t *testing.T) {
+	c := &Config{}
+	c.SetDefault()
+	require.Equal(t, defaultBalancing, c.Balancing)
+	require.Equal(t, defaultCooldown, c.Cooldown)
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name           string
+		srcConfig      *Config
+		targetConfig   *Config
+		expectedConfig *Config
+	}{
+		{
+			name:           "src is nil",
+			srcConfig:      nil,
+			targetConfig:   &Config{Balancing: BalancingHash, MaxFails: 1},
+			expectedConfig: &Config{Balancing: BalancingHash, MaxFails: 1},
+		},
+		{
+			name:           "target is nil",
+			srcConfig:      &Config{Balancing: BalancingHash, MaxFails: 1},
+			targetConfig:   nil,
+			expectedConfig: &Config{Balancing: BalancingHash, MaxFails: 1},
+		},
+		{
+			name:         "target is not nil",
+			srcConfig:    &Config{Balancing: BalancingHash, HashHeader: "X-User", MaxFails: 1, Cooldown: time.Second},
+			targetConfig: &Config{Balancing: BalancingLeastConn, MaxFails: 3},
+			expectedConfig: &Config{
+				Balancing:  BalancingLeastConn,
+				HashHeader: "X-User",
+				MaxFails:   3,
+				Cooldown:   time.Second,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cc := tt.srcConfig.Merge(tt.targetConfig)
+			require.Equal(t, tt.expectedConfig, cc)
+		})
+	}
+}
+
+func TestMergeHealthCheck(t *testing.T) {
+	src := &Config{HealthCheck: &HealthCheckConfig{Path: "/health", Interval: time.Second}}
+	cc := src.Merge(&Config{HealthCheck: &HealthCheckConfig{Interval: 5 * time.Second}})
+	require.Equal(t, &HealthCheckConfig{Path: "/health", Interval: 5 * time.Second}, cc.HealthCheck)
+
+	cc.SetDefault()
+	require.Equal(t, defaultHealthCheckTimeout, cc.HealthCheck.Timeout)
+	// src is not changed
+	require.Equal(t, time.Duration(0), src.HealthCheck.Timeout)
+}
+
+func TestValidate(t *testing.T) {
+	for _, v := range []string{"", BalancingRoundRobin, BalancingLeastConn, BalancingHash} {
+		require.Nil(t, (&Config{Balancing: v}).Validate())
+	}
+
+	require.True(t, errors.Is((&Config{Balancing: "leastcon"}).Validate(), ErrUnknownBalancing))
+}
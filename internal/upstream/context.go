@@ -0,0 +1,26 @@
+package upstream
+
+import (
+	"context"
+
+	accp "github.com/soldatov-s/accp/internal"
+)
+
+const (
+	ProviderName = "upstream"
+)
+
+func Registrate(ctx context.Context) context.Context {
+	if Get(ctx) != nil {
+		return ctx
+	}
+
+	return accp.RegistrateByName(ctx, ProviderName, NewHealthCheckers(ctx))
+}
+
+func Get(ctx context.Context) *HealthCheckers {
+	if v, ok := accp.GetByName(ctx, ProviderName).(*HealthCheckers); ok {
+		return v
+	}
+	return nil
+}
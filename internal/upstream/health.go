@@ -0,0 +1,278 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/soldatov-s/accp/internal/admin"
+	"github.com/soldatov-s/accp/internal/logger"
+	"github.com/soldatov-s/accp/internal/metrics"
+	"github.com/soldatov-s/accp/internal/utils"
+)
+
+const (
+	statusMetricName = ProviderName + "_status"
+)
+
+type empty struct{}
+
+// HealthChecker checks health endpoint of upstream
+type HealthChecker struct {
+	dsn    string
+	cfg    *HealthCheckConfig
+	client *http.Client
+	log    zerolog.Logger
+	// healthy is 1 if last check was successful
+	healthy int32
+	mu      sync.RWMutex
+	lastErr string
+}
+
+func newHealthChecker(ctx context.Context, dsn string, cfg *HealthCheckConfig) *HealthChecker {
+	return &HealthChecker{
+		dsn:     dsn,
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		log:     logger.GetPackageLogger(ctx, empty{}),
+		healthy: 1,
+	}
+}
+
+// Healthy returns result of last check, upstream is healthy before first check
+func (h *HealthChecker) Healthy() bool {
+	return atomic.LoadInt32(&h.healthy) == 1
+}
+
+// Status returns result of last check and error message if check failed
+func (h *HealthChecker) Status() (healthy bool, msg string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.Healthy(), h.lastErr
+}
+
+func (h *HealthChecker) URL() string {
+	return h.dsn + h.cfg.Path
+}
+
+func (h *HealthChecker) setStatus(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err == nil {
+		if !h.Healthy() {
+			h.log.Info().Msgf("upstream %s is healthy", utils.RedactedDSN(h.dsn))
+		}
+		atomic.StoreInt32(&h.healthy, 1)
+		h.lastErr = ""
+		return
+	}
+
+	if h.Healthy() {
+		h.log.Error().Err(err).Msgf("upstream %s is unhealthy", utils.RedactedDSN(h.dsn))
+	}
+	atomic.StoreInt32(&h.healthy, 0)
+	h.lastErr = err.Error()
+}
+
+// Check requests health endpoint of upstream, only 2xx and 3xx answers are healthy
+func (h *HealthChecker) Check() {
+	resp, err := h.client.Get(h.URL())
+	if err != nil {
+		h.setStatus(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		h.setStatus(fmt.Errorf("unexpected status code %d", resp.StatusCode))
+		return
+	}
+
+	h.setStatus(nil)
+}
+
+func (h *HealthChecker) loop(done chan struct{}) {
+	ticker := time.NewTicker(h.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			h.Check()
+		}
+	}
+}
+
+// HealthCheckers is a provider which holds health checkers of all upstreams,
+// routes with the same upstream and health path share the one checker
+type HealthCheckers struct {
+	ctx      context.Context
+	log      zerolog.Logger
+	mu       sync.Mutex
+	checkers map[string]*HealthChecker
+	done     chan struct{}
+	started  bool
+	// metricOnce registers metric of checkers, the metric can't be registered twice
+	metricOnce sync.Once
+}
+
+func NewHealthCheckers(ctx context.Context) *HealthCheckers {
+	return &HealthCheckers{
+		ctx:      ctx,
+		log:      logger.GetPackageLogger(ctx, empty{}),
+		checkers: make(map[string]*HealthChecker),
+		done:     make(chan struct{}),
+	}
+}
+
+// Get returns health checker for upstream, it creates checker if it not exists.
+// The checker created after provider started is started and registered in admin at once.
+func (c *HealthCheckers) Get(dsn string, cfg *HealthCheckConfig) *HealthChecker {
+	c.mu.Lock()
+	key := dsn + cfg.Path
+	if h, ok := c.checkers[key]; ok {
+		c.mu.Unlock()
+		return h
+	}
+
+	h := newHealthChecker(c.ctx, dsn, cfg)
+	c.checkers[key] = h
+	started, done := c.started, c.done
+	c.mu.Unlock()
+
+	if started {
+		go func() {
+			h.Check()
+			h.loop(done)
+		}()
+
+		if err := c.registerInAdmin([]*HealthChecker{h}); err != nil {
+			c.log.Err(err).Msgf("failed to register health check of %s in admin", utils.RedactedDSN(h.URL()))
+		}
+	}
+
+	return h
+}
+
+// Checkers returns all health checkers
+func (c *HealthCheckers) Checkers() []*HealthChecker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make([]*HealthChecker, 0, len(c.checkers))
+	for _, h := range c.checkers {
+		result = append(result, h)
+	}
+
+	return result
+}
+
+func readyCheckName(h *HealthChecker) string {
+	return strings.ToUpper(ProviderName) + "_" + utils.RedactedDSN(h.URL())
+}
+
+// registerInAdmin registers ready checks of checkers and metric of all checkers, the ready check
+// is registered again after restart, it replaces previous one
+func (c *HealthCheckers) registerInAdmin(checkers []*HealthChecker) error {
+	a := admin.Get(c.ctx)
+	if a == nil || len(checkers) == 0 {
+		return nil
+	}
+
+	for _, h := range checkers {
+		h := h
+		if err := a.RegisterReadyCheck(readyCheckName(h), func() (bool, string) {
+			return h.Status()
+		}); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	c.metricOnce.Do(func() {
+		err = c.registerMetric(a)
+	})
+
+	return err
+}
+
+func (c *HealthCheckers) registerMetric(a *admin.Admin) error {
+	return a.RegisterMetric(statusMetricName, &metrics.MetricOptions{
+		Metric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: statusMetricName,
+				Help: "status of upstream by active health check",
+			}, []string{"upstream"}),
+		MetricFunc: func(m interface{}) {
+			for _, h := range c.Checkers() {
+				value := 0.0
+				if h.Healthy() {
+					value = 1
+				}
+				(m.(*prometheus.GaugeVec)).WithLabelValues(utils.RedactedDSN(h.URL())).Set(value)
+			}
+		},
+	})
+}
+
+// Start checks all upstreams and starts periodic checks
+func (c *HealthCheckers) Start() error {
+	c.mu.Lock()
+	if c.started {
+		c.mu.Unlock()
+		return nil
+	}
+	c.started = true
+	done := c.done
+	checkers := make([]*HealthChecker, 0, len(c.checkers))
+	for _, h := range c.checkers {
+		checkers = append(checkers, h)
+	}
+	c.mu.Unlock()
+
+	if len(checkers) == 0 {
+		return nil
+	}
+
+	// The first check is synchronous, so /health/ready is correct after start
+	var wg sync.WaitGroup
+	for _, h := range checkers {
+		wg.Add(1)
+		go func(h *HealthChecker) {
+			defer wg.Done()
+			h.Check()
+		}(h)
+	}
+	wg.Wait()
+
+	for _, h := range checkers {
+		go h.loop(done)
+	}
+
+	c.log.Info().Msgf("started health checks of %d upstreams", len(checkers))
+
+	return c.registerInAdmin(checkers)
+}
+
+func (c *HealthCheckers) Shutdown() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.started {
+		close(c.done)
+		c.done = make(chan struct{})
+		c.started = false
+	}
+
+	return nil
+}
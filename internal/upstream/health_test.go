@@ -0,0 +1,165 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/soldatov-s/accp/internal/admin"
+	"github.com/soldatov-s/accp/internal/logger"
+	"github.com/soldatov-s/accp/internal/meta"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testHealthPath  = "/health"
+	testAdminListen = "127.0.0.1:19100"
+	// testDownDSN is a DSN of unavailable upstream
+	testDownDSN = "http://127.0.0.1:1"
+)
+
+func initContext() context.Context {
+	ctx := meta.SetAppInfo(context.Background(), "accp", "", "", "", "test")
+	return logger.RegistrateAndInitilize(ctx, &logger.Config{
+		Level:           logger.LoggerLevelDebug,
+		NoColoredOutput: true,
+	})
+}
+
+// healthServer returns server with health endpoint, its status is switched by healthy
+func healthServer(healthy *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != testHealthPath || atomic.LoadInt32(healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestHealthCheckerCheck(t *testing.T) {
+	healthy := int32(1)
+	server := healthServer(&healthy)
+	defer server.Close()
+
+	cfg := &HealthCheckConfig{Path: testHealthPath}
+	cfg.SetDefault()
+	h := newHealthChecker(initContext(), server.URL, cfg)
+
+	h.Check()
+	ok, msg := h.Status()
+	require.True(t, ok)
+	require.Empty(t, msg)
+
+	atomic.StoreInt32(&healthy, 0)
+	h.Check()
+	ok, msg = h.Status()
+	require.False(t, ok)
+	require.NotEmpty(t, msg)
+
+	server.Close()
+	atomic.StoreInt32(&healthy, 1)
+	h.Check()
+	require.False(t, h.Healthy())
+}
+
+func TestHealthCheckersGet(t *testing.T) {
+	c := NewHealthCheckers(initContext())
+	cfg := &HealthCheckConfig{Path: testHealthPath}
+	cfg.SetDefault()
+
+	h1 := c.Get(testDSN1, cfg)
+	require.Equal(t, h1, c.Get(testDSN1, cfg))
+	require.NotEqual(t, h1, c.Get(testDSN2, cfg))
+	require.Equal(t, 2, len(c.Checkers()))
+}
+
+func TestHealthCheckersRestart(t *testing.T) {
+	healthy := int32(1)
+	server := healthServer(&healthy)
+	defer server.Close()
+
+	c := NewHealthCheckers(initContext())
+	cfg := &HealthCheckConfig{Path: testHealthPath, Interval: 50 * time.Millisecond}
+	cfg.SetDefault()
+
+	// The checker created after start is checked at once
+	require.Nil(t, c.Start())
+	h := c.Get(testDownDSN, cfg)
+	require.Eventually(t, func() bool { return !h.Healthy() }, time.Second, 10*time.Millisecond)
+
+	// The checks are stopped on shutdown and started again after restart
+	up := c.Get(server.URL, cfg)
+	require.Eventually(t, up.Healthy, time.Second, 10*time.Millisecond)
+	require.Nil(t, c.Shutdown())
+	require.Nil(t, c.Start())
+	defer func() {
+		require.Nil(t, c.Shutdown())
+	}()
+
+	atomic.StoreInt32(&healthy, 0)
+	require.Eventually(t, func() bool { return !up.Healthy() }, time.Second, 10*time.Millisecond)
+}
+
+func TestBalancerWithHealthChecks(t *testing.T) {
+	healthy := int32(1)
+	server := healthServer(&healthy)
+	defer server.Close()
+
+	ctx := initContext()
+	ctx, err := admin.Registrate(ctx, &admin.Config{Listen: testAdminListen})
+	require.Nil(t, err)
+	ctx = Registrate(ctx)
+	a := admin.Get(ctx)
+	require.NotNil(t, a)
+
+	cfg := &Config{HealthCheck: &HealthCheckConfig{Path: testHealthPath, Interval: 50 * time.Millisecond}}
+	b := NewBalancer(ctx, cfg, []string{server.URL, testDownDSN})
+	// The second route with the same upstreams shares checkers
+	_ = NewBalancer(ctx, cfg, []string{server.URL, testDownDSN})
+	require.Equal(t, 2, len(Get(ctx).Checkers()))
+
+	require.Nil(t, Get(ctx).Start())
+	defer func() {
+		require.Nil(t, Get(ctx).Shutdown())
+	}()
+	require.Nil(t, a.Start(nil, nil, nil))
+	defer func() {
+		require.Nil(t, a.Shutdown())
+	}()
+
+	// The second upstream is unavailable, all requests are passed to the first
+	for i := 0; i < 4; i++ {
+		u, err := b.Next(nil, "")
+		require.Nil(t, err)
+		require.Equal(t, server.URL, u.DSN)
+		b.Done(u, false)
+	}
+
+	// The ready check fails because of the second upstream
+	resp, err := http.Get("http://" + testAdminListen + admin.ReadyEndpoint)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusFailedDependency, resp.StatusCode)
+
+	var answ admin.ErrorAnswer
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&answ))
+	require.Equal(t, readyCheckName(Get(ctx).Get(testDownDSN, cfg.HealthCheck)), answ.Body.Code)
+
+	// The first upstream becomes unhealthy
+	atomic.StoreInt32(&healthy, 0)
+	require.Eventually(t, func() bool {
+		_, err := b.Next(nil, "")
+		return err == ErrNoAvailableUpstreams
+	}, time.Second, 10*time.Millisecond)
+
+	// The metric of health is exposed
+	mresp, err := http.Get("http://" + testAdminListen + admin.MetricsEndpoint)
+	require.Nil(t, err)
+	defer mresp.Body.Close()
+	require.Equal(t, http.StatusOK, mresp.StatusCode)
+}
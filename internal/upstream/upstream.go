@@ -0,0 +1,239 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// virtualNodes is a number of points of each upstream on hash ring
+	virtualNodes = 100
+)
+
+var (
+	ErrNoUpstreams          = errors.New("no upstreams")
+	ErrNoAvailableUpstreams = errors.New("all upstreams are ejected or unhealthy")
+	ErrUnknownBalancing     = errors.New("unknown balancing strategy")
+)
+
+// Upstream is a backend of route
+type Upstream struct {
+	DSN string
+	// active is a number of active requests
+	active int64
+	// fails is a number of consecutive failures
+	fails int64
+	// ejectedUntil is unix time in nanoseconds until upstream is ejected
+	ejectedUntil int64
+	// health is an active health checker, it is nil if health checks are disabled
+	health *HealthChecker
+}
+
+// Available checks that upstream is not ejected and it is healthy
+func (u *Upstream) Available() bool {
+	if u.health != nil && !u.health.Healthy() {
+		return false
+	}
+
+	return time.Now().UnixNano() >= atomic.LoadInt64(&u.ejectedUntil)
+}
+
+// Active returns number of active requests
+func (u *Upstream) Active() int64 {
+	return atomic.LoadInt64(&u.active)
+}
+
+type ringPoint struct {
+	hash     uint32
+	upstream *Upstream
+}
+
+// Balancer selects upstream for request
+type Balancer struct {
+	cfg       *Config
+	upstreams []*Upstream
+	counter   uint64
+	ring      []ringPoint
+}
+
+// NewBalancer creates balancer for upstreams, the health checkers of upstreams are
+// taken from the provider in context, health checks are disabled without provider
+func NewBalancer(ctx context.Context, cfg *Config, dsns []string) *Balancer {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	cfg.SetDefault()
+
+	b := &Balancer{
+		cfg:       cfg,
+		upstreams: make([]*Upstream, 0, len(dsns)),
+	}
+
+	var checkers *HealthCheckers
+	if cfg.HealthCheck != nil && cfg.HealthCheck.Path != "" {
+		checkers = Get(ctx)
+	}
+
+	for _, dsn := range dsns {
+		u := &Upstream{DSN: dsn}
+		if checkers != nil {
+			u.health = checkers.Get(dsn, cfg.HealthCheck)
+		}
+		b.upstreams = append(b.upstreams, u)
+	}
+
+	if cfg.Balancing == BalancingHash {
+		b.buildRing()
+	}
+
+	return b
+}
+
+func (b *Balancer) buildRing() {
+	b.ring = make([]ringPoint, 0, len(b.upstreams)*virtualNodes)
+	for _, u := range b.upstreams {
+		for i := 0; i < virtualNodes; i++ {
+			b.ring = append(b.ring, ringPoint{
+				hash:     crc32.ChecksumIEEE([]byte(u.DSN + "#" + strconv.Itoa(i))),
+				upstream: u,
+			})
+		}
+	}
+
+	sort.Slice(b.ring, func(i, j int) bool {
+		return b.ring[i].hash < b.ring[j].hash
+	})
+}
+
+// Upstreams returns all upstreams
+func (b *Balancer) Upstreams() []*Upstream {
+	return b.upstreams
+}
+
+// Len returns number of upstreams
+func (b *Balancer) Len() int {
+	return len(b.upstreams)
+}
+
+// Next selects upstream for request, key is the cache key of request,
+// it is used for hash balancing if request has not HashHeader
+func (b *Balancer) Next(req *http.Request, key string) (*Upstream, error) {
+	if len(b.upstreams) == 0 {
+		return nil, ErrNoUpstreams
+	}
+
+	var u *Upstream
+	switch b.cfg.Balancing {
+	case BalancingLeastConn:
+		u = b.leastConn()
+	case BalancingHash:
+		if b.cfg.HashHeader != "" && req != nil {
+			if h := req.Header.Get(b.cfg.HashHeader); h != "" {
+				key = h
+			}
+		}
+		u = b.hash(key)
+	default:
+		u = b.roundRobin()
+	}
+
+	if u == nil {
+		return nil, ErrNoAvailableUpstreams
+	}
+
+	atomic.AddInt64(&u.active, 1)
+
+	return u, nil
+}
+
+func (b *Balancer) roundRobin() *Upstream {
+	n := uint64(len(b.upstreams))
+	start := atomic.AddUint64(&b.counter, 1) - 1
+	for i := uint64(0); i < n; i++ {
+		if u := b.upstreams[(start+i)%n]; u.Available() {
+			return u
+		}
+	}
+
+	return nil
+}
+
+func (b *Balancer) leastConn() *Upstream {
+	var result *Upstream
+	n := uint64(len(b.upstreams))
+	// start from different upstream for equal number of active requests
+	start := atomic.AddUint64(&b.counter, 1) - 1
+	for i := uint64(0); i < n; i++ {
+		u := b.upstreams[(start+i)%n]
+		if !u.Available() {
+			continue
+		}
+
+		if result == nil || u.Active() < result.Active() {
+			result = u
+		}
+	}
+
+	return result
+}
+
+func (b *Balancer) hash(key string) *Upstream {
+	h := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(b.ring), func(i int) bool {
+		return b.ring[i].hash >= h
+	})
+
+	for i := 0; i < len(b.ring); i++ {
+		if u := b.ring[(idx+i)%len(b.ring)].upstream; u.Available() {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// Done must be called after request to upstream, failed request increments
+// the number of consecutive failures, upstream is ejected for cooldown after MaxFails.
+// The upstream re-admitted after cooldown is ejected again after first failure,
+// successful request resets the number of failures.
+func (b *Balancer) Done(u *Upstream, failed bool) {
+	atomic.AddInt64(&u.active, -1)
+
+	if !failed {
+		atomic.StoreInt64(&u.fails, 0)
+		return
+	}
+
+	fails := atomic.AddInt64(&u.fails, 1)
+	if b.cfg.MaxFails > 0 && fails >= int64(b.cfg.MaxFails) {
+		atomic.StoreInt64(&u.ejectedUntil, time.Now().Add(b.cfg.Cooldown).UnixNano())
+	}
+}
+
+// Rebase replaces DSN of known upstream in url by DSN of upstream u,
+// relative url is prefixed by DSN of upstream u
+func (b *Balancer) Rebase(url string, u *Upstream) string {
+	if strings.HasPrefix(url, "/") {
+		return u.DSN + url
+	}
+
+	for _, v := range b.upstreams {
+		if !strings.HasPrefix(url, v.DSN) {
+			continue
+		}
+
+		rest := strings.TrimPrefix(url, v.DSN)
+		if rest == "" || strings.HasPrefix(rest, "/") || strings.HasPrefix(rest, "?") {
+			return u.DSN + rest
+		}
+	}
+
+	return url
+}
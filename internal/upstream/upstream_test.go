@@ -0,0 +1,176 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testDSN1       = "http://backend1:9000"
+	testDSN2       = "http://backend2:9000"
+	testDSN3       = "http://backend3:9000"
+	testHashHeader = "X-User"
+)
+
+func testDSNs() []string {
+	return []string{testDSN1, testDSN2, testDSN3}
+}
+
+func TestNextRoundRobin(t *testing.T) {
+	b := NewBalancer(context.Background(), nil, testDSNs())
+
+	for i := 0; i < 6; i++ {
+		u, err := b.Next(nil, "")
+		require.Nil(t, err)
+		require.Equal(t, testDSNs()[i%3], u.DSN)
+		b.Done(u, false)
+	}
+}
+
+func TestNextLeastConn(t *testing.T) {
+	b := NewBalancer(context.Background(), &Config{Balancing: BalancingLeastConn}, testDSNs())
+
+	u1, err := b.Next(nil, "")
+	require.Nil(t, err)
+	u2, err := b.Next(nil, "")
+	require.Nil(t, err)
+	require.NotEqual(t, u1.DSN, u2.DSN)
+
+	// the third upstream has no active requests
+	u3, err := b.Next(nil, "")
+	require.Nil(t, err)
+	require.NotEqual(t, u1.DSN, u3.DSN)
+	require.NotEqual(t, u2.DSN, u3.DSN)
+
+	b.Done(u2, false)
+	u, err := b.Next(nil, "")
+	require.Nil(t, err)
+	require.Equal(t, u2.DSN, u.DSN)
+}
+
+func TestNextHash(t *testing.T) {
+	b := NewBalancer(context.Background(), &Config{Balancing: BalancingHash, HashHeader: testHashHeader}, testDSNs())
+
+	// the same key is routed to the same upstream
+	for i := 0; i < 10; i++ {
+		key := "key" + strconv.Itoa(i)
+		u1, err := b.Next(nil, key)
+		require.Nil(t, err)
+		b.Done(u1, false)
+		u2, err := b.Next(nil, key)
+		require.Nil(t, err)
+		b.Done(u2, false)
+		require.Equal(t, u1.DSN, u2.DSN)
+	}
+
+	// the header has priority over the key
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set(testHashHeader, "user1")
+	expected, err := b.Next(nil, "user1")
+	require.Nil(t, err)
+	b.Done(expected, false)
+
+	for i := 0; i < 10; i++ {
+		u, err := b.Next(req, "key"+strconv.Itoa(i))
+		require.Nil(t, err)
+		b.Done(u, false)
+		require.Equal(t, expected.DSN, u.DSN)
+	}
+
+	// keys of ejected upstream are moved to other upstreams
+	b.cfg.MaxFails = 1
+	b.Done(expected, true)
+	u, err := b.Next(req, "")
+	require.Nil(t, err)
+	require.NotEqual(t, expected.DSN, u.DSN)
+}
+
+func TestEjection(t *testing.T) {
+	b := NewBalancer(context.Background(), &Config{MaxFails: 2, Cooldown: 100 * time.Millisecond}, []string{testDSN1, testDSN2})
+	u1, u2 := b.Upstreams()[0], b.Upstreams()[1]
+
+	done := func(u *Upstream, failed bool) {
+		atomic.AddInt64(&u.active, 1)
+		b.Done(u, failed)
+	}
+
+	// one failure doesn't eject upstream
+	done(u1, true)
+	require.True(t, u1.Available())
+
+	// success resets counter of failures
+	done(u1, false)
+	done(u1, true)
+	require.True(t, u1.Available())
+
+	done(u1, true)
+	require.False(t, u1.Available())
+
+	for i := 0; i < 4; i++ {
+		u, err := b.Next(nil, "")
+		require.Nil(t, err)
+		require.Equal(t, testDSN2, u.DSN)
+		b.Done(u, false)
+	}
+
+	// all upstreams are ejected
+	done(u2, true)
+	done(u2, true)
+	_, err := b.Next(nil, "")
+	require.Equal(t, ErrNoAvailableUpstreams, err)
+
+	// re-admitted after cooldown, but ejected again after first failure
+	time.Sleep(150 * time.Millisecond)
+	require.True(t, u1.Available())
+	done(u1, true)
+	require.False(t, u1.Available())
+	require.True(t, u2.Available())
+}
+
+func TestNextWithoutUpstreams(t *testing.T) {
+	b := NewBalancer(context.Background(), nil, nil)
+	require.Equal(t, 0, b.Len())
+	_, err := b.Next(nil, "")
+	require.Equal(t, ErrNoUpstreams, err)
+}
+
+func TestRebase(t *testing.T) {
+	b := NewBalancer(context.Background(), nil, []string{testDSN1, testDSN2})
+	u := b.Upstreams()[1]
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{
+			name:     "url of other upstream",
+			url:      testDSN1 + "/test?id=1",
+			expected: testDSN2 + "/test?id=1",
+		},
+		{
+			name:     "relative url",
+			url:      "/test",
+			expected: testDSN2 + "/test",
+		},
+		{
+			name:     "url of unknown host",
+			url:      testDSN1 + "0/test",
+			expected: testDSN1 + "0/test",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, b.Rebase(tt.url, u))
+		})
+	}
+}
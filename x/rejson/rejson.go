@@ -14,14 +14,15 @@ type redisProcessor struct {
 }
 
 /*
-Client is an extended redis.Client, stores a pointer to the original redis.Client
+Client is an extended redis.UniversalClient, stores the original client, so it works
+with single node, sentinel and cluster clients
 */
 type Client struct {
-	*redis.Client
+	redis.UniversalClient
 	*redisProcessor
 }
 
-func ExtendClient(client *redis.Client) *Client {
+func ExtendClient(client redis.UniversalClient) *Client {
 	return &Client{
 		client,
 		&redisProcessor{